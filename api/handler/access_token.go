@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type accessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0"`
+}
+
+// accessTokenResponse is a personal access token as the API returns it. The token itself is never stored.
+type accessTokenResponse struct {
+	ID          uint       `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// createdAccessTokenResponse is a new personal access token with the token, which is only returned once.
+type createdAccessTokenResponse struct {
+	Token string `json:"token"`
+	accessTokenResponse
+}
+
+// CreateAccessToken - Creates a personal access token for the logged in user
+// @Summary Create a personal access token
+// @Description The token is only returned once. Without expires_in_days the token does not expire.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param token body accessTokenRequest true "Token Name and Scopes"
+// @Success 200 {object} utils.Response{data=createdAccessTokenResponse}
+// @Router /api/v1/user/tokens [post]
+func (a *App) CreateAccessToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+
+	var data accessTokenRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+	for _, scope := range data.Scopes {
+		if !isKnownScope(scope) {
+			utils.ResponseInvalidParam(c)
+			return
+		}
+	}
+
+	tokenString, err := utils.GenerateAccessToken()
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	token := model.PersonalAccessToken{
+		Name:        data.Name,
+		TokenHash:   utils.HashAccessToken(tokenString),
+		TokenPrefix: tokenString[:len(utils.AccessTokenPrefix)+4],
+		Scopes:      strings.Join(data.Scopes, ","),
+		UserID:      uid,
+	}
+	if data.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, data.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	err = a.audited(c, model.AuditCreate, model.AuditAccessToken, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.AccessTokens.CreatePersonalAccessToken(&token); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: token.ID, After: newAccessTokenResponse(&token)}, nil
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, createdAccessTokenResponse{Token: tokenString, accessTokenResponse: newAccessTokenResponse(&token)})
+}
+
+// GetAccessTokenList - Lists the personal access tokens of the logged in user
+// @Summary List personal access tokens
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]accessTokenResponse}
+// @Router /api/v1/user/tokens [get]
+func (a *App) GetAccessTokenList(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+
+	tokens, err := a.with(c).AccessTokens.GetPersonalAccessTokenList(int(uid))
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	list := make([]accessTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		list = append(list, newAccessTokenResponse(&tokens[i]))
+	}
+	utils.ResponseSuccess(c, list)
+}
+
+// DeleteAccessToken - Revokes a personal access token of the logged in user
+// @Summary Revoke a personal access token
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/tokens/{id} [delete]
+func (a *App) DeleteAccessToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	err = a.audited(c, model.AuditDelete, model.AuditAccessToken, func(repos repository.Repositories) (auditChange, error) {
+		snapshot := func(repos repository.Repositories, id int) (interface{}, error) {
+			return accessTokenSnapshot(repos, int(uid), id)
+		}
+		return deleteWith(repos, id, snapshot, func() error {
+			return repos.AccessTokens.DeletePersonalAccessToken(int(uid), id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range model.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func newAccessTokenResponse(token *model.PersonalAccessToken) accessTokenResponse {
+	return accessTokenResponse{
+		ID:          token.ID,
+		Name:        token.Name,
+		TokenPrefix: token.TokenPrefix,
+		Scopes:      token.ScopeList(),
+		ExpiresAt:   token.ExpiresAt,
+		LastUsedAt:  token.LastUsedAt,
+		CreatedAt:   token.CreatedAt,
+	}
+}
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"blog-go/internal/lockout"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type unlockLoginRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// UnlockLogin - Removes the login lockout of a username and/or a client IP
+// @Summary Unlock a login
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param unlock body unlockLoginRequest true "Username and/or IP"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/login/unlock [post]
+func (a *App) UnlockLogin(c *gin.Context) {
+	var data unlockLoginRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+	if data.Username == "" && data.IP == "" {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	err := a.audited(c, model.AuditUnlock, model.AuditLockout, func(repos repository.Repositories) (auditChange, error) {
+		if err := lockout.Unlock(data.Username, data.IP); err != nil {
+			return auditChange{}, utils.WrapError(utils.UnknownErr, err)
+		}
+		return auditChange{Before: data}, nil
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+type userRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+type disableUserRequest struct {
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+// adminUserResponse is a user with the account state that only admins see.
+type adminUserResponse struct {
+	userResponse
+	Disabled              bool   `json:"disabled"`
+	DisabledReason        string `json:"disabled_reason,omitempty"`
+	PasswordResetRequired bool   `json:"password_reset_required"`
+}
+
+// GetAdminUserList - Gets a list of users filtered for admins with pagination
+// @Summary List users for admins
+// @Description Takes the filters and sorts of the user list, and filters on email (eq, ne, contains), role (eq, ne) and disabled (eq).
+// @Description The username, email, role and disabled parameters are kept for older clients.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param username query string false "Username contains"
+// @Param email query string false "Email contains"
+// @Param role query string false "Role"
+// @Param disabled query bool false "Disabled"
+// @Param page_size query int false "Page Size"
+// @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Success 200 {object} utils.Response{data=listResponse[adminUserResponse]}
+// @Router /api/v1/admin/users [get]
+func (a *App) GetAdminUserList(c *gin.Context) {
+	page, err := bindPage(c)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	query, err := bindQuery(c, repository.AdminUserSchema)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if username := c.Query("username"); username != "" {
+		query.Filters = append(query.Filters, repository.Filter{Field: "username", Op: repository.OpContains, Value: username})
+	}
+	if email := c.Query("email"); email != "" {
+		query.Filters = append(query.Filters, repository.Filter{Field: "email", Op: repository.OpContains, Value: email})
+	}
+	if role := c.Query("role"); role != "" {
+		query.Filters = append(query.Filters, repository.Filter{Field: "role", Op: repository.OpEq, Value: role})
+	}
+	if disabled := c.Query("disabled"); disabled != "" {
+		value, err := strconv.ParseBool(disabled)
+		if err != nil {
+			utils.ResponseInvalidParam(c)
+			return
+		}
+		query.Filters = append(query.Filters, repository.Filter{Field: "disabled", Op: repository.OpEq, Value: value})
+	}
+
+	users, err := a.with(c).Users.GetUserStatusList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, newListResponse(users, newAdminUserList))
+}
+
+// UpdateUserRole - Changes the role of a user
+// @Summary Change a user's role
+// @Description The last admin cannot be demoted.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body userRoleRequest true "Role"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/user/{id}/role [put]
+func (a *App) UpdateUserRole(c *gin.Context) {
+	id, ok := otherUserID(c)
+	if !ok {
+		return
+	}
+
+	var data userRoleRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.UpdateUserRole(id, data.Role)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// DisableUser - Disables a user, who can no longer login or use existing tokens
+// @Summary Disable a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param reason body disableUserRequest false "Reason"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/user/{id}/disable [post]
+func (a *App) DisableUser(c *gin.Context) {
+	id, ok := otherUserID(c)
+	if !ok {
+		return
+	}
+
+	var data disableUserRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&data); err != nil {
+			utils.ResponseBindError(c, err)
+			return
+		}
+	}
+	if len(data.Reason) > 200 {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.SetUserDisabled(id, true, data.Reason)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// EnableUser - Enables a disabled user
+// @Summary Enable a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/user/{id}/enable [post]
+func (a *App) EnableUser(c *gin.Context) {
+	id, ok := otherUserID(c)
+	if !ok {
+		return
+	}
+
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.SetUserDisabled(id, false, "")
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// RequirePasswordReset - Makes a user choose a new password at the next login
+// @Summary Force a password reset
+// @Description Existing tokens of the user are revoked.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/user/{id}/password-reset [post]
+func (a *App) RequirePasswordReset(c *gin.Context) {
+	id, ok := otherUserID(c)
+	if !ok {
+		return
+	}
+
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.RequireUserPasswordReset(id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// AdminDeleteUser - Deletes a user and optionally gives the user's content to another author
+// @Summary Delete a user as an admin
+// @Description A soft delete keeps the user's content. A hard delete removes the user's comments and unsets the author of the user's articles, unless they are given to another author first.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param hard query bool false "Hard Delete"
+// @Param reassign_to query int false "New Author ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/admin/user/{id} [delete]
+func (a *App) AdminDeleteUser(c *gin.Context) {
+	id, ok := otherUserID(c)
+	if !ok {
+		return
+	}
+
+	hard, err := strconv.ParseBool(c.DefaultQuery("hard", "false"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+	reassignTo, err := strconv.Atoi(c.DefaultQuery("reassign_to", "0"))
+	if err != nil || reassignTo < 0 {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	err = a.audited(c, model.AuditDelete, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return deleteWith(repos, id, userSnapshot, func() error {
+			return repos.Users.DeleteUserByAdmin(id, hard, reassignTo)
+		})
+	})
+	if utils.IsCode(err, utils.ErrorInvalidParam) {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// otherUserID returns the user ID in the path if it is not the admin's own,
+// otherwise it writes the error response. Admins cannot demote, disable or delete themselves,
+// so that the blog is never left without an admin by accident.
+func otherUserID(c *gin.Context) (int, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return 0, false
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return 0, false
+	}
+
+	if uid == uint(id) {
+		utils.ResponseError(c, utils.NewError(utils.ErrorModifySelf))
+		return 0, false
+	}
+	return id, true
+}
+
+func newAdminUserList(users []model.User) []adminUserResponse {
+	list := make([]adminUserResponse, 0, len(users))
+	for i := range users {
+		list = append(list, adminUserResponse{
+			userResponse:          newUserResponse(&users[i]),
+			Disabled:              users[i].Disabled,
+			DisabledReason:        users[i].DisabledReason,
+			PasswordResetRequired: users[i].PasswordResetRequired,
+		})
+	}
+	return list
+}
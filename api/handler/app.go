@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"blog-go/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// App holds what the handlers depend on. It is built once in main, and tests can build it on other repositories.
+type App struct {
+	repository.Repositories
+	// HealthChecks are the dependencies that /readyz checks.
+	HealthChecks []HealthCheck
+}
+
+// NewApp creates the handlers on the repositories.
+func NewApp(repos repository.Repositories) *App {
+	return &App{Repositories: repos}
+}
+
+// with returns the repositories bound to the context of a request, so that the queries are part of its trace and
+// stop when the client goes away.
+func (a *App) with(c *gin.Context) repository.Repositories {
+	return a.WithContext(c.Request.Context())
+}
@@ -5,207 +5,464 @@ import (
 	"blog-go/internal/repository"
 	"blog-go/utils"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// articleRequest is the body of the article create and update endpoints.
+// The categories must exist, they are created at /api/v1/category.
+type articleRequest struct {
+	Title       string `json:"title" validate:"required,max=100"`
+	Content     string `json:"content" validate:"required,max=100000"`
+	CategoryIDs []uint `json:"category_ids" validate:"max=20"`
+}
+
+// articleAuthor is the author of an article, which expand=author adds.
+type articleAuthor struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// articleResponse is an article as the API returns it. Lists leave out the content unless fields selects it.
+// The author and the comments are only added by expand.
+type articleResponse struct {
+	ID           uint               `json:"id"`
+	Title        string             `json:"title"`
+	Content      string             `json:"content,omitempty"`
+	UserID       *uint              `json:"user_id"`
+	CommentCount int                `json:"comment_count"`
+	ReadCount    int                `json:"read_count"`
+	Categories   []categoryResponse `json:"categories"`
+	Author       *articleAuthor     `json:"author,omitempty"`
+	Comments     []commentResponse  `json:"comments,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
 // CreateArticle - Creates an article
 // @Summary Create an article
 // @Tags article
 // @Accept json
 // @Produce json
-// @Param article body model.Article true "Article"
-// @Success 200 {object} utils.Response
-// @Router /api/article [post]
-func CreateArticle(c *gin.Context) {
-	var article model.Article
-	if err := c.ShouldBindJSON(&article); err != nil {
-		utils.ResponseInvalidParam(c)
+// @Param article body articleRequest true "Article"
+// @Success 200 {object} utils.Response{data=articleResponse}
+// @Router /api/v1/article [post]
+func (a *App) CreateArticle(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+
+	var data articleRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+	article, err := a.newArticle(c, &data)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
+	// The author is the logged in user.
+	article.UserID = &uid
 
-	code := repository.CreateArticle(&article)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditCreate, model.AuditArticle, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Articles.CreateArticle(article); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: article.ID, After: newArticleResponse(article)}, nil
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, article)
+	utils.ResponseSuccess(c, newArticleResponse(article))
 }
 
 // GetArticle - Retrieves an article based on its ID
 // @Summary Retrieve an article
+// @Description The ETag header holds the version of the article, for If-Match on updates.
+// @Description Fields: title, content, user_id, comment_count, read_count, created_at, updated_at.
+// @Description Expand: categories (default), author, comments.
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param id path int true "Article ID"
-// @Success 200 {object} utils.Response
-// @Router /api/article/{id} [get]
-func GetArticle(c *gin.Context) {
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
+// @Success 200 {object} utils.Response{data=articleResponse}
+// @Header 200 {string} ETag "Article version"
+// @Router /api/v1/article/{id} [get]
+func (a *App) GetArticle(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	article, code := repository.GetArticle(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
-
-	utils.ResponseSuccess(c, article)
+	a.responseArticle(c, id)
 }
 
 // GetArticleList - Retrieves a list of articles with pagination
 // @Summary Retrieve list of articles
+// @Description Filters: category (eq), user_id (eq, ne), title (eq, ne, contains), read_count and comment_count (eq, ne, gt, gte, lt, lte), created_at and updated_at (gt, gte, lt, lte).
+// @Description Sorts: title, read_count, comment_count, created_at, updated_at.
+// @Description Fields: title, content, user_id, comment_count, read_count, created_at, updated_at. Expand: categories (default), author.
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param page_size query int false "Page Size" default(10)
 // @Param page_num query int false "Page Number" default(1)
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
 // @Success 200 {object} utils.Response
-// @Router /api/articles [get]
-func GetArticleList(c *gin.Context) {
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-
-	articles, code := repository.GetArticleList(pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
-
-	utils.ResponseSuccess(c, articles)
+// @Router /api/v1/articles [get]
+func (a *App) GetArticleList(c *gin.Context) {
+	a.listArticles(c)
 }
 
 // GetArticleListByCategory - Retrieves a list of articles by category with pagination
 // @Summary Retrieve articles by category
+// @Description Same as /api/v1/articles with filter[category]={id}, which newer clients use.
+// @Description Deprecated, see the Deprecation and Sunset headers.
+// @Deprecated
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
 // @Param page_size query int false "Page Size" default(10)
 // @Param page_num query int false "Page Number" default(1)
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
 // @Success 200 {object} utils.Response
-// @Router /api/articles/category/{id} [get]
-func GetArticleListByCategory(c *gin.Context) {
+// @Router /api/v1/articles/category/{id} [get]
+func (a *App) GetArticleListByCategory(c *gin.Context) {
 	categoryId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-
-	articles, code := repository.GetArticleListByCategory(categoryId, pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
 
-	utils.ResponseSuccess(c, articles)
+	a.listArticles(c, repository.Filter{Field: "category", Op: repository.OpEq, Value: int64(categoryId)})
 }
 
 // GetArticleListByTitle - Retrieves a list of articles by title with pagination
 // @Summary Retrieve articles by title
+// @Description Same as /api/v1/articles with filter[title][contains]={title}, which newer clients use.
+// @Description Deprecated, see the Deprecation and Sunset headers.
+// @Deprecated
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param title path string true "Article Title"
 // @Param page_size query int false "Page Size" default(10)
 // @Param page_num query int false "Page Number" default(1)
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
 // @Success 200 {array} utils.Response
-// @Router /api/articles/{title} [get]
-func GetArticleListByTitle(c *gin.Context) {
-	title := c.Param("title")
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+// @Router /api/v1/articles/{title} [get]
+func (a *App) GetArticleListByTitle(c *gin.Context) {
+	a.listArticles(c, repository.Filter{Field: "title", Op: repository.OpContains, Value: c.Param("title")})
+}
+
+// listArticles renders a page of the articles that match the query of the request and the filters, in the view of
+// the request.
+func (a *App) listArticles(c *gin.Context, filters ...repository.Filter) {
+	page, err := bindPage(c)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
 		return
 	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	query, err := bindQuery(c, repository.ArticleSchema)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
+		return
+	}
+	if query.View, err = bindView(c, repository.ArticleSchema, true); err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	articles, code := repository.GetArticleListByTitle(title, pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	query.Filters = append(query.Filters, filters...)
+	articles, err := a.with(c).Articles.GetArticleList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, articles)
+	utils.ResponseSuccess(c, newListResponse(articles, func(articles []model.Article) []interface{} {
+		return viewList(newArticleList(articles), query.View, repository.ArticleSchema)
+	}))
 }
 
 // UpdateArticle - Updates an article based on its ID
 // @Summary Update an article
+// @Description Replaces the title, content and categories. With If-Match the article is only updated if its ETag matches.
+// @Description Only the author or an admin can update an article.
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param id path int true "Article ID"
-// @Param article body model.Article true "Article Update"
-// @Success 200 {object} utils.Response
-// @Router /api/article/{id} [put]
-func UpdateArticle(c *gin.Context) {
+// @Param If-Match header string false "ETag of the article"
+// @Param article body articleRequest true "Article Update"
+// @Success 200 {object} utils.Response{data=articleResponse}
+// @Failure 403 "Permission Denied"
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/article/{id} [put]
+func (a *App) UpdateArticle(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	var article model.Article
-	if err := c.ShouldBindJSON(&article); err != nil {
+	var data articleRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	current, err := a.with(c).Articles.GetArticle(id, repository.View{})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkArticleOwner(c, current); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	a.updateArticle(c, id, current, &data)
+}
+
+// PatchArticle - Partially updates an article based on its ID
+// @Summary Patch an article
+// @Description The body is a JSON Merge Patch (RFC 7396) of the article: the given fields are replaced, and null clears a field.
+// @Description With If-Match the article is only updated if its ETag matches.
+// @Description Only the author or an admin can patch an article.
+// @Tags article
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path int true "Article ID"
+// @Param If-Match header string false "ETag of the article"
+// @Param article body articleRequest true "Article Patch"
+// @Success 200 {object} utils.Response{data=articleResponse}
+// @Failure 403 "Permission Denied"
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/article/{id} [patch]
+func (a *App) PatchArticle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	code := repository.UpdateArticle(id, &article)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	current, err := a.with(c).Articles.GetArticle(id, repository.View{})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkArticleOwner(c, current); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	var data articleRequest
+	if err := bindMergePatch(c, newArticleRequest(current), &data); err != nil {
+		utils.ResponseBindError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, nil)
+	a.updateArticle(c, id, current, &data)
 }
 
 // DeleteArticle - Deletes an article based on its ID
 // @Summary Delete an article
+// @Description Only the author or an admin can delete an article.
 // @Tags article
 // @Accept json
 // @Produce json
 // @Param id path int true "Article ID"
 // @Success 200 {object} utils.Response
-// @Router /api/article/{id} [delete]
-func DeleteArticle(c *gin.Context) {
+// @Failure 403 "Permission Denied"
+// @Router /api/v1/article/{id} [delete]
+func (a *App) DeleteArticle(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	code := repository.DeleteArticle(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	current, err := a.with(c).Articles.GetArticle(id, repository.View{})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkArticleOwner(c, current); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	err = a.audited(c, model.AuditDelete, model.AuditArticle, func(repos repository.Repositories) (auditChange, error) {
+		return deleteWith(repos, id, articleSnapshot, func() error {
+			return repos.Articles.DeleteArticle(id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
 	utils.ResponseSuccess(c, nil)
 }
+
+// checkArticleOwner only lets the author of an article or an admin change it.
+func checkArticleOwner(c *gin.Context, article *model.Article) error {
+	if role, _ := c.Get("role"); role == model.RoleAdmin {
+		return nil
+	}
+	userID, exists := c.Get("userID")
+	if !exists {
+		return utils.NewError(utils.UnknownErr)
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		return utils.NewError(utils.UnknownErr)
+	}
+	if article.UserID == nil || *article.UserID != uid {
+		return utils.NewError(utils.ErrorPermissionDenied)
+	}
+	return nil
+}
+
+// updateArticle updates the version of an article that the request was checked against, and responds with the
+// updated article. The author does not change.
+func (a *App) updateArticle(c *gin.Context, id int, current *model.Article, data *articleRequest) {
+	article, err := a.newArticle(c, data)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	article.Version = current.Version
+
+	err = a.audited(c, model.AuditUpdate, model.AuditArticle, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Articles.UpdateArticle(id, article); err != nil {
+			return auditChange{}, err
+		}
+		after, err := articleSnapshot(repos, id)
+		return auditChange{ID: uint(id), Before: newArticleResponse(current), After: after}, err
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	a.responseArticle(c, id)
+}
+
+// responseArticle responds with an article in the view of the request and its version as the ETag.
+func (a *App) responseArticle(c *gin.Context, id int) {
+	view, err := bindView(c, repository.ArticleSchema, false)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	article, err := a.with(c).Articles.GetArticle(id, view)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	setETag(c, article.Version)
+	utils.ResponseSuccess(c, viewOf(newArticleResponse(article), view, repository.ArticleSchema))
+}
+
+// newArticleRequest returns the request that would create an article as it is, which patches are applied to.
+func newArticleRequest(article *model.Article) articleRequest {
+	data := articleRequest{
+		Title:       article.Title,
+		Content:     article.Content,
+		CategoryIDs: make([]uint, 0, len(article.Categories)),
+	}
+	for _, category := range article.Categories {
+		data.CategoryIDs = append(data.CategoryIDs, category.ID)
+	}
+	return data
+}
+
+// newArticle maps an article request to an article, with the categories looked up by ID.
+func (a *App) newArticle(c *gin.Context, data *articleRequest) (*model.Article, error) {
+	article := &model.Article{
+		Title:   data.Title,
+		Content: data.Content,
+	}
+	for _, id := range data.CategoryIDs {
+		category, err := a.with(c).Categories.GetCategory(int(id))
+		if err != nil {
+			return nil, err
+		}
+		article.Categories = append(article.Categories, &model.Category{Model: gorm.Model{ID: category.ID}, Name: category.Name})
+	}
+	return article, nil
+}
+
+func newArticleResponse(article *model.Article) articleResponse {
+	response := articleResponse{
+		ID:           article.ID,
+		Title:        article.Title,
+		Content:      article.Content,
+		UserID:       article.UserID,
+		CommentCount: article.CommentCount,
+		ReadCount:    article.ReadCount,
+		Categories:   make([]categoryResponse, 0, len(article.Categories)),
+		CreatedAt:    article.CreatedAt,
+		UpdatedAt:    article.UpdatedAt,
+	}
+	for _, category := range article.Categories {
+		response.Categories = append(response.Categories, newCategoryResponse(category))
+	}
+	if article.User != nil {
+		response.Author = &articleAuthor{ID: article.User.ID, Username: article.User.Username}
+	}
+	if article.Comments != nil {
+		response.Comments = newCommentList(article.Comments)
+	}
+	return response
+}
+
+func newArticleList(articles []model.Article) []articleResponse {
+	list := make([]articleResponse, 0, len(articles))
+	for i := range articles {
+		list = append(list, newArticleResponse(&articles[i]))
+	}
+	return list
+}
@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/logging"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportPageSize is the number of audit events that an export reads at a time.
+const exportPageSize = 500
+
+// defaultExportWriteTimeout is how long an export may take to read and write a page, if the config leaves the
+// write timeout of the server unset. It is the default of the server.
+const defaultExportWriteTimeout = 30 * time.Second
+
+// auditChange is what a change did to a resource: its ID, and its snapshots before and after the change, which
+// are nil for creates and deletes. Snapshots are API responses, so that the audit trail never holds secrets such as
+// password hashes.
+type auditChange struct {
+	ID     uint
+	Before interface{}
+	After  interface{}
+}
+
+// fieldChange is the value of a field before and after a change. A side is left out if the resource did not exist.
+type fieldChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// auditEventResponse is an event of the audit trail.
+type auditEventResponse struct {
+	ID           uint            `json:"id"`
+	ActorID      *uint           `json:"actor_id"`
+	ActorName    string          `json:"actor_name,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   uint            `json:"resource_id"`
+	Changes      json.RawMessage `json:"changes"`
+	IP           string          `json:"ip"`
+	RequestID    string          `json:"request_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// audited runs a change of a resource and records it in the audit trail in one transaction, so that no change is
+// missing from the trail. change runs on the repositories of the transaction. The actor is the logged in user, if
+// any, and the event has the client IP and the request ID of the request. It returns the error of change.
+func (a *App) audited(c *gin.Context, action, resourceType string, change func(repos repository.Repositories) (auditChange, error)) error {
+	return a.with(c).Transaction(func(repos repository.Repositories) error {
+		result, err := change(repos)
+		if err != nil {
+			return err
+		}
+		changes, err := diffSnapshots(result.Before, result.After)
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+
+		event := model.AuditEvent{
+			ActorName:    c.GetString("username"),
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   result.ID,
+			Changes:      changes,
+			IP:           c.ClientIP(),
+			RequestID:    c.GetString("requestID"),
+		}
+		if userID, ok := c.Get("userID"); ok {
+			if uid, ok := userID.(uint); ok {
+				event.ActorID = &uid
+			}
+		}
+		return repos.AuditEvents.CreateAuditEvent(&event)
+	})
+}
+
+// diffSnapshots returns the JSON object of the fields whose values differ between two snapshots, with their
+// values before and after. A nil snapshot has no fields, so creates and deletes list all fields.
+func diffSnapshots(before, after interface{}) (string, error) {
+	beforeFields, err := snapshotFields(before)
+	if err != nil {
+		return "", err
+	}
+	afterFields, err := snapshotFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	changes := map[string]fieldChange{}
+	for name, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[name]) {
+			changes[name] = fieldChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = fieldChange{After: value}
+		}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// snapshotFields returns the JSON fields of a snapshot.
+func snapshotFields(snapshot interface{}) (map[string]json.RawMessage, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// updateWith runs the update of a resource, and returns the change with the snapshots of the resource before and
+// after it.
+func updateWith(repos repository.Repositories, id int, snapshot func(repository.Repositories, int) (interface{}, error), change func() error) (auditChange, error) {
+	before, err := snapshot(repos, id)
+	if err != nil {
+		return auditChange{}, err
+	}
+	if err := change(); err != nil {
+		return auditChange{}, err
+	}
+	after, err := snapshot(repos, id)
+	return auditChange{ID: uint(id), Before: before, After: after}, err
+}
+
+// deleteWith runs the delete of a resource, and returns the change with the snapshot of the resource before it.
+func deleteWith(repos repository.Repositories, id int, snapshot func(repository.Repositories, int) (interface{}, error), remove func() error) (auditChange, error) {
+	before, err := snapshot(repos, id)
+	if err != nil {
+		return auditChange{}, err
+	}
+	if err := remove(); err != nil {
+		return auditChange{}, err
+	}
+	return auditChange{ID: uint(id), Before: before}, nil
+}
+
+// articleSnapshot returns an article as the audit trail keeps it, with its categories.
+func articleSnapshot(repos repository.Repositories, id int) (interface{}, error) {
+	article, err := repos.Articles.GetArticle(id, repository.View{})
+	if err != nil {
+		return nil, err
+	}
+	return newArticleResponse(article), nil
+}
+
+// categorySnapshot returns a category as the audit trail keeps it.
+func categorySnapshot(repos repository.Repositories, id int) (interface{}, error) {
+	category, err := repos.Categories.GetCategory(id)
+	if err != nil {
+		return nil, err
+	}
+	return newCategoryResponse(category), nil
+}
+
+// commentSnapshot returns a comment as the audit trail keeps it, without its relations.
+func commentSnapshot(repos repository.Repositories, id int) (interface{}, error) {
+	comment, err := repos.Comments.GetComment(id, repository.View{Expand: []string{}})
+	if err != nil {
+		return nil, err
+	}
+	return newCommentResponse(comment), nil
+}
+
+// userSnapshot returns a user as the audit trail keeps it, with the account state that admins see.
+func userSnapshot(repos repository.Repositories, id int) (interface{}, error) {
+	user, err := repos.Users.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	status, err := repos.Users.GetUserStatus(id)
+	if err != nil {
+		return nil, err
+	}
+	return adminUserResponse{
+		userResponse:          newUserResponse(user),
+		Disabled:              status.Disabled,
+		DisabledReason:        status.DisabledReason,
+		PasswordResetRequired: status.PasswordResetRequired,
+	}, nil
+}
+
+// accessTokenSnapshot returns a personal access token of a user as the audit trail keeps it, without the token.
+func accessTokenSnapshot(repos repository.Repositories, userID, id int) (interface{}, error) {
+	tokens, err := repos.AccessTokens.GetPersonalAccessTokenList(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		if tokens[i].ID == uint(id) {
+			return newAccessTokenResponse(&tokens[i]), nil
+		}
+	}
+	return nil, utils.NewError(utils.ErrorAccessTokenNotExist)
+}
+
+// identitySnapshot returns a provider account linked to a user as the audit trail keeps it.
+func identitySnapshot(repos repository.Repositories, userID, id int) (interface{}, error) {
+	identities, err := repos.Identities.GetUserIdentityList(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range identities {
+		if identities[i].ID == uint(id) {
+			return newIdentityResponse(&identities[i]), nil
+		}
+	}
+	return nil, utils.NewError(utils.ErrorIdentityNotExist)
+}
+
+// profileSnapshot returns the profile of a user as the audit trail keeps it.
+func profileSnapshot(repos repository.Repositories, id int) (interface{}, error) {
+	user, err := repos.Users.GetUserProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	return newUserProfile(user), nil
+}
+
+// GetAuditEventList - Gets the audit trail with pagination
+// @Summary List audit events
+// @Description Filters: actor_id, action, resource_type, resource_id and request_id (eq), created_at (gt, gte, lt, lte). Sorts: created_at.
+// @Description Changes holds the changed fields of the resource with their values before and after.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param page_size query int false "Page Size"
+// @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Success 200 {object} utils.Response{data=listResponse[auditEventResponse]}
+// @Router /api/v1/admin/audit-events [get]
+func (a *App) GetAuditEventList(c *gin.Context) {
+	page, err := bindPage(c)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	query, err := bindQuery(c, repository.AuditEventSchema)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	events, err := a.with(c).AuditEvents.GetAuditEventList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, newListResponse(events, newAuditEventList))
+}
+
+// ExportAuditEvents - Exports the audit trail
+// @Summary Export audit events
+// @Description Downloads all audit events that match the filters and sorts of the audit event list, as CSV or as JSON Lines.
+// @Description The download is not cut off by the write timeout of the server.
+// @Tags admin
+// @Produce text/csv,application/x-ndjson
+// @Param format query string false "csv or json" default(csv)
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Success 200 {file} file
+// @Router /api/v1/admin/audit-events/export [get]
+func (a *App) ExportAuditEvents(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+	query, err := bindQuery(c, repository.AuditEventSchema)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	// The first page is read before the response starts, so that its errors still get an error response.
+	page := repository.Page{Size: exportPageSize, Num: 1}
+	events, err := a.with(c).AuditEvents.GetAuditEventList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	// Exports of the whole trail take longer than the write timeout of the server, which would cut them off
+	// without an error. Every page gets the write timeout again instead, so that a stalled client still times out.
+	timeout := config.GetServerConfig().WriteTimeout
+	if timeout <= 0 {
+		timeout = defaultExportWriteTimeout
+	}
+	controller := http.NewResponseController(c.Writer)
+	extendDeadline := func() {
+		if controller == nil {
+			return
+		}
+		if err := controller.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			logging.FromContext(c.Request.Context()).WithError(err).Warn("Export Audit Events Write Deadline Error")
+			controller = nil
+		}
+	}
+
+	var write func(event auditEventResponse) error
+	filename := "audit-events-" + time.Now().Format("20060102-150405")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		writer := csv.NewWriter(c.Writer)
+		defer writer.Flush()
+		if err := writer.Write(auditEventColumns); err != nil {
+			return
+		}
+		write = func(event auditEventResponse) error {
+			return writer.Write(auditEventRecord(event))
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.jsonl"`)
+		encoder := json.NewEncoder(c.Writer)
+		write = func(event auditEventResponse) error {
+			return encoder.Encode(event)
+		}
+	}
+	c.Status(http.StatusOK)
+
+	for {
+		extendDeadline()
+		for _, event := range newAuditEventList(events.Items) {
+			if err := write(event); err != nil {
+				// The client went away.
+				return
+			}
+		}
+		if events.Next == nil {
+			return
+		}
+		page.After = events.Next
+		if events, err = a.with(c).AuditEvents.GetAuditEventList(query, page); err != nil {
+			// The response has started, so the export is cut short and the error is only logged.
+			logging.FromContext(c.Request.Context()).WithError(err).Error("Export Audit Events Error")
+			return
+		}
+	}
+}
+
+// auditEventColumns are the columns of the CSV export.
+var auditEventColumns = []string{"id", "created_at", "actor_id", "actor_name", "action", "resource_type", "resource_id", "changes", "ip", "request_id"}
+
+// auditEventRecord returns the CSV record of an event. The text cells hold what users and clients sent, such as
+// usernames, so they are escaped against formulas.
+func auditEventRecord(event auditEventResponse) []string {
+	actorID := ""
+	if event.ActorID != nil {
+		actorID = strconv.FormatUint(uint64(*event.ActorID), 10)
+	}
+	return []string{
+		strconv.FormatUint(uint64(event.ID), 10),
+		event.CreatedAt.Format(time.RFC3339Nano),
+		actorID,
+		csvText(event.ActorName),
+		csvText(event.Action),
+		csvText(event.ResourceType),
+		strconv.FormatUint(uint64(event.ResourceID), 10),
+		csvText(string(event.Changes)),
+		csvText(event.IP),
+		csvText(event.RequestID),
+	}
+}
+
+// csvText prefixes a cell that spreadsheets would run as a formula with a quote, which makes it text.
+func csvText(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func newAuditEventList(events []model.AuditEvent) []auditEventResponse {
+	list := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		changes := json.RawMessage(event.Changes)
+		if len(changes) == 0 {
+			changes = json.RawMessage("{}")
+		}
+		list = append(list, auditEventResponse{
+			ID:           event.ID,
+			ActorID:      event.ActorID,
+			ActorName:    event.ActorName,
+			Action:       event.Action,
+			ResourceType: event.ResourceType,
+			ResourceID:   event.ResourceID,
+			Changes:      changes,
+			IP:           event.IP,
+			RequestID:    event.RequestID,
+			CreatedAt:    event.CreatedAt,
+		})
+	}
+	return list
+}
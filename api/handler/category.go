@@ -5,27 +5,47 @@ import (
 	"blog-go/internal/repository"
 	"blog-go/utils"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// categoryRequest is the body of the category create and update endpoints.
+type categoryRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+// categoryResponse is a category as the API returns it.
+type categoryResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // CreateCategory - Creates a category
 // @Summary Create a category
 // @Tags category
 // @Accept json
 // @Produce json
-// @Param category body model.Category true "Category"
+// @Param category body categoryRequest true "Category"
 // @Success 200 {object} utils.Response
-// @Router /api/category [post]
-func CreateCategory(c *gin.Context) {
-	var category model.Category
-	if err := c.ShouldBindJSON(&category); err != nil {
-		utils.ResponseInvalidParam(c)
+// @Router /api/v1/category [post]
+func (a *App) CreateCategory(c *gin.Context) {
+	var data categoryRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
 		return
 	}
-	code := repository.CreateCategory(&category)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	category := model.Category{Name: data.Name}
+	err := a.audited(c, model.AuditCreate, model.AuditCategory, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Categories.CreateCategory(&category); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: category.ID, After: newCategoryResponse(&category)}, nil
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
@@ -34,97 +54,212 @@ func CreateCategory(c *gin.Context) {
 
 // GetCategory - Gets a single category by ID
 // @Summary Get a category
+// @Description The ETag header holds the version of the category, for If-Match on updates.
 // @Tags category
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
-// @Success 200 {object} utils.Response
+// @Success 200 {object} utils.Response{data=categoryResponse}
+// @Header 200 {string} ETag "Category version"
 // @Failure 400 {object} utils.Response
-// @Router /api/category/{id} [get]
-func GetCategory(c *gin.Context) {
+// @Router /api/v1/category/{id} [get]
+func (a *App) GetCategory(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	category, code := repository.GetCategory(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
-
-	utils.ResponseSuccess(c, category)
+	a.responseCategory(c, id)
 }
 
-// GetCategoryList - Gets a list of categories
+// GetCategoryList - Gets a list of categories with pagination
 // @Summary List categories
+// @Description Filters: name (eq, ne, contains), created_at (gt, gte, lt, lte).
+// @Description Sorts: name, created_at.
 // @Tags category
 // @Accept json
 // @Produce json
-// @Success 200 {object} utils.Response
-// @Router /api/categories [get]
-func GetCategoryList(c *gin.Context) {
-	categories, code := repository.GetCategoryList()
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+// @Param page_size query int false "Page Size"
+// @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Success 200 {object} utils.Response{data=listResponse[categoryResponse]}
+// @Router /api/v1/categories [get]
+func (a *App) GetCategoryList(c *gin.Context) {
+	page, err := bindPage(c)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	query, err := bindQuery(c, repository.CategorySchema)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, categories)
+	categories, err := a.with(c).Categories.GetCategoryList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, newListResponse(categories, func(categories []model.Category) []categoryResponse {
+		list := make([]categoryResponse, 0, len(categories))
+		for i := range categories {
+			list = append(list, newCategoryResponse(&categories[i]))
+		}
+		return list
+	}))
 }
 
 // UpdateCategory - Updates a category
 // @Summary Update a category
+// @Description With If-Match the category is only updated if its ETag matches.
+// @Description Only admins can change categories.
 // @Tags category
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
-// @Param category body model.Category true "Category"
-// @Success 200 {object} utils.Response
-// @Router /api/category/{id} [put]
-func UpdateCategory(c *gin.Context) {
+// @Param If-Match header string false "ETag of the category"
+// @Param category body categoryRequest true "Category"
+// @Success 200 {object} utils.Response{data=categoryResponse}
+// @Failure 403 "Permission Denied"
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/category/{id} [put]
+func (a *App) UpdateCategory(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	var category model.Category
-	if err := c.ShouldBindJSON(&category); err != nil {
+	var data categoryRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	current, err := a.with(c).Categories.GetCategory(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	a.updateCategory(c, id, current, &data)
+}
+
+// PatchCategory - Partially updates a category
+// @Summary Patch a category
+// @Description The body is a JSON Merge Patch (RFC 7396) of the category. With If-Match the category is only updated if its ETag matches.
+// @Description Only admins can change categories.
+// @Tags category
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param If-Match header string false "ETag of the category"
+// @Param category body categoryRequest true "Category Patch"
+// @Success 200 {object} utils.Response{data=categoryResponse}
+// @Failure 403 "Permission Denied"
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/category/{id} [patch]
+func (a *App) PatchCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	code := repository.UpdateCategory(id, &category)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	current, err := a.with(c).Categories.GetCategory(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, nil)
+	var data categoryRequest
+	if err := bindMergePatch(c, categoryRequest{Name: current.Name}, &data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	a.updateCategory(c, id, current, &data)
 }
 
 // DeleteCategory - Deletes a category
 // @Summary Delete a category
+// @Description Only admins can delete categories.
 // @Tags category
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
 // @Success 200 {object} utils.Response
-// @Router /api/category/{id} [delete]
-func DeleteCategory(c *gin.Context) {
+// @Failure 403 "Permission Denied"
+// @Router /api/v1/category/{id} [delete]
+func (a *App) DeleteCategory(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	code := repository.DeleteCategory(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditDelete, model.AuditCategory, func(repos repository.Repositories) (auditChange, error) {
+		return deleteWith(repos, id, categorySnapshot, func() error {
+			return repos.Categories.DeleteCategory(id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
 	utils.ResponseSuccess(c, nil)
 }
+
+// updateCategory updates the version of a category that the request was checked against, and responds with the
+// updated category.
+func (a *App) updateCategory(c *gin.Context, id int, current *model.Category, data *categoryRequest) {
+	err := a.audited(c, model.AuditUpdate, model.AuditCategory, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Categories.UpdateCategory(id, &model.Category{Name: data.Name, Version: current.Version}); err != nil {
+			return auditChange{}, err
+		}
+		after, err := categorySnapshot(repos, id)
+		return auditChange{ID: uint(id), Before: newCategoryResponse(current), After: after}, err
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	a.responseCategory(c, id)
+}
+
+// responseCategory responds with a category and its version as the ETag.
+func (a *App) responseCategory(c *gin.Context, id int) {
+	category, err := a.with(c).Categories.GetCategory(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	setETag(c, category.Version)
+	utils.ResponseSuccess(c, newCategoryResponse(category))
+}
+
+func newCategoryResponse(category *model.Category) categoryResponse {
+	return categoryResponse{
+		ID:        category.ID,
+		Name:      category.Name,
+		CreatedAt: category.CreatedAt,
+		UpdatedAt: category.UpdatedAt,
+	}
+}
@@ -5,32 +5,91 @@ import (
 	"blog-go/internal/repository"
 	"blog-go/utils"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// commentRequest is the body of the comment create endpoint. The author is the logged in user.
+type commentRequest struct {
+	ArticleID uint   `json:"article_id" validate:"required"`
+	Content   string `json:"content" validate:"required,max=500"`
+}
+
+// commentUpdateRequest is the body of the comment update endpoint. Comments cannot move to another article.
+type commentUpdateRequest struct {
+	Content string `json:"content" validate:"required,max=500"`
+}
+
+type commentArticle struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+type commentUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// commentResponse is a comment as the API returns it. The author is shown without the email.
+type commentResponse struct {
+	ID        uint            `json:"id"`
+	Content   string          `json:"content"`
+	ArticleID uint            `json:"article_id"`
+	UserID    uint            `json:"user_id"`
+	Article   *commentArticle `json:"article,omitempty"`
+	User      *commentUser    `json:"user,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
 // CreateComment - Creates a comment
 // @Summary Create a comment
 // @Tags comment
 // @Accept json
 // @Produce json
-// @Param comment body model.Comment true "Comment"
-// @Success 200 {object} utils.Response
-// @Router /api/comment [post]
-func CreateComment(c *gin.Context) {
-	var data model.Comment
+// @Param comment body commentRequest true "Comment"
+// @Success 200 {object} utils.Response{data=commentResponse}
+// @Router /api/v1/comment [post]
+func (a *App) CreateComment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return
+	}
+
+	var data commentRequest
 	err := c.ShouldBindJSON(&data)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
+		return
+	}
+	if _, err := a.with(c).Articles.GetArticle(int(data.ArticleID), repository.View{}); err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	code := repository.CreateComment(&data)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	comment := model.Comment{
+		Content:   data.Content,
+		ArticleID: data.ArticleID,
+		UserID:    uid,
+	}
+	err = a.audited(c, model.AuditCreate, model.AuditComment, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Comments.CreateComment(&comment); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: comment.ID, After: newCommentResponse(&comment)}, nil
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
-	utils.ResponseSuccess(c, nil)
+	utils.ResponseSuccess(c, newCommentResponse(&comment))
 }
 
 // GetComment - Gets a single comment by ID
@@ -39,98 +98,110 @@ func CreateComment(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Comment ID"
-// @Success 200 {object} utils.Response
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
+// @Success 200 {object} utils.Response{data=commentResponse}
 // @Failure 400 {object} utils.Response
-// @Router /api/comment/{id} [get]
-func GetComment(c *gin.Context) {
+// @Router /api/v1/comment/{id} [get]
+func (a *App) GetComment(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	comment, code := repository.GetComment(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	view, err := bindView(c, repository.CommentSchema, false)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	comment, err := a.with(c).Comments.GetComment(id, view)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, comment)
+	utils.ResponseSuccess(c, viewOf(newCommentResponse(comment), view, repository.CommentSchema))
 }
 
 // GetCommentList - Gets a list of comments with pagination
 // @Summary List comments
+// @Description Filters: article_id (eq), user_id (eq), created_at (gt, gte, lt, lte). Sorts: created_at.
+// @Description Fields: content, article_id, user_id, created_at, updated_at. Expand: article (default), user (default).
 // @Tags comment
 // @Accept json
 // @Produce json
 // @Param page_size query int false "Page Size"
 // @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
 // @Success 200 {object} utils.Response
-// @Router /api/comments [get]
-func GetCommentList(c *gin.Context) {
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-
-	if pageSize > 100 {
-		pageSize = 100
-	}
-
-	comments, code := repository.GetCommentList(pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
-
-	utils.ResponseSuccess(c, comments)
+// @Router /api/v1/comments [get]
+func (a *App) GetCommentList(c *gin.Context) {
+	a.listComments(c)
 }
 
 // GetCommentListByArticle - Gets a list of comments for a specific article with pagination
 // @Summary List comments by article
+// @Description Same as /api/v1/comments with filter[article_id]={id}, which newer clients use.
+// @Description Deprecated, see the Deprecation and Sunset headers.
+// @Deprecated
 // @Tags comment
 // @Accept json
 // @Produce json
 // @Param id path int true "Article ID"
 // @Param page_size query int false "Page Size"
 // @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Param fields query string false "Fields to return, separated by commas"
+// @Param expand query string false "Relations to expand, separated by commas"
 // @Success 200 {object} utils.Response
-// @Router /api/comments/article/{id} [get]
-func GetCommentListByArticle(c *gin.Context) {
+// @Router /api/v1/comments/article/{id} [get]
+func (a *App) GetCommentListByArticle(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	a.listComments(c, repository.Filter{Field: "article_id", Op: repository.OpEq, Value: int64(id)})
+}
+
+// listComments renders a page of the comments that match the query of the request and the filters, in the view of
+// the request.
+func (a *App) listComments(c *gin.Context, filters ...repository.Filter) {
+	page, err := bindPage(c)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
 		return
 	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	query, err := bindQuery(c, repository.CommentSchema)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
 		return
 	}
-
-	if pageSize > 100 {
-		pageSize = 100
+	if query.View, err = bindView(c, repository.CommentSchema, true); err != nil {
+		utils.ResponseError(c, err)
+		return
 	}
 
-	comments, code := repository.GetCommentListByArticle(id, pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	query.Filters = append(query.Filters, filters...)
+	comments, err := a.with(c).Comments.GetCommentList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, comments)
+	utils.ResponseSuccess(c, newListResponse(comments, func(comments []*model.Comment) []interface{} {
+		return viewList(newCommentList(comments), query.View, repository.CommentSchema)
+	}))
 }
 
 // UpdateComment - Updates a comment by ID
@@ -139,19 +210,19 @@ func GetCommentListByArticle(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Comment ID"
-// @Param comment body model.Comment true "Comment"
+// @Param comment body commentUpdateRequest true "Comment"
 // @Success 200 {object} utils.Response
 // @Failure 403 "Permission Denied"
-// @Router /api/comment/{id} [put]
-func UpdateComment(c *gin.Context) {
+// @Router /api/v1/comment/{id} [put]
+func (a *App) UpdateComment(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 	userID, ok := userID.(uint)
 	if !ok {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 
@@ -161,26 +232,30 @@ func UpdateComment(c *gin.Context) {
 		return
 	}
 
-	var data model.Comment
+	var data commentUpdateRequest
 	err = c.ShouldBindJSON(&data)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
 		return
 	}
 
-	uid, code := repository.GetCommentUserID(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	uid, err := a.with(c).Comments.GetCommentUserID(id)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 	if uid != userID {
-		utils.ResponseError(c, utils.ErrorPermissionDenied)
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
 		return
 	}
 
-	code = repository.UpdateComment(id, &data)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditUpdate, model.AuditComment, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, commentSnapshot, func() error {
+			return repos.Comments.UpdateComment(id, &model.Comment{Content: data.Content})
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
@@ -195,16 +270,16 @@ func UpdateComment(c *gin.Context) {
 // @Param id path int true "Comment ID"
 // @Success 200 {object} utils.Response
 // @Failure 403 "Permission Denied"
-// @Router /api/comment/{id} [delete]
-func DeleteComment(c *gin.Context) {
+// @Router /api/v1/comment/{id} [delete]
+func (a *App) DeleteComment(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 	userID, ok := userID.(uint)
 	if !ok {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 
@@ -214,21 +289,51 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	uid, code := repository.GetCommentUserID(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	uid, err := a.with(c).Comments.GetCommentUserID(id)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 	if uid != userID {
-		utils.ResponseError(c, utils.ErrorPermissionDenied)
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
 		return
 	}
 
-	code = repository.DeleteComment(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditDelete, model.AuditComment, func(repos repository.Repositories) (auditChange, error) {
+		return deleteWith(repos, id, commentSnapshot, func() error {
+			return repos.Comments.DeleteComment(id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
 	utils.ResponseSuccess(c, nil)
 }
+
+func newCommentResponse(comment *model.Comment) commentResponse {
+	response := commentResponse{
+		ID:        comment.ID,
+		Content:   comment.Content,
+		ArticleID: comment.ArticleID,
+		UserID:    comment.UserID,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+	}
+	if comment.Article != nil {
+		response.Article = &commentArticle{ID: comment.Article.ID, Title: comment.Article.Title}
+	}
+	if comment.User != nil {
+		response.User = &commentUser{ID: comment.User.ID, Username: comment.User.Username}
+	}
+	return response
+}
+
+func newCommentList(comments []*model.Comment) []commentResponse {
+	list := make([]commentResponse, 0, len(comments))
+	for _, comment := range comments {
+		list = append(list, newCommentResponse(comment))
+	}
+	return list
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAccessToken(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+	token := loginAuthor()
+
+	tokenBytes, _ := json.Marshal(map[string]interface{}{
+		"name":            "deploy",
+		"scopes":          []string{model.ScopeArticlesWrite},
+		"expires_in_days": 30,
+	})
+	resp, err := postWithToken(baseURL+"/api/user/tokens", token, bytes.NewReader(tokenBytes))
+	if err != nil {
+		t.Fatalf("CreateAccessToken Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateAccessToken Error: %v", resp.Status)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	tokenData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("CreateAccessToken Error: %v", "Data format error")
+	}
+	accessToken, _ := tokenData["token"].(string)
+
+	// The token can write articles
+	articleBytes, _ := json.Marshal(model.Article{Title: "test", Content: "test"})
+	resp, _ = postWithToken(baseURL+"/api/article", accessToken, bytes.NewReader(articleBytes))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateArticle Error: %v", resp.Status)
+	}
+
+	// But not categories, and not the account
+	categoryBytes, _ := json.Marshal(model.Category{Name: "test"})
+	resp, _ = postWithToken(baseURL+"/api/category", accessToken, bytes.NewReader(categoryBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorTokenScope {
+		t.Fatalf("CreateCategory Error: %v", respData.Message)
+	}
+
+	resp, _ = postWithToken(baseURL+"/api/user/tokens", accessToken, bytes.NewReader(tokenBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorTokenScope {
+		t.Fatalf("CreateAccessToken Error: %v", respData.Message)
+	}
+
+	// A revoked token is rejected
+	req, _ := http.NewRequest(http.MethodDelete, baseURL+"/api/user/tokens/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DeleteAccessToken Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DeleteAccessToken Error: %v", resp.Status)
+	}
+
+	resp, _ = postWithToken(baseURL+"/api/article", accessToken, bytes.NewReader(articleBytes))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("CreateArticle Error: %v", resp.Status)
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAdminUserManagement(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+
+	// The first user is the admin
+	admin := userBody{
+		Username: "TestAdmin",
+		Password: "TestPassword",
+		Email:    "Admin@email.com",
+	}
+	adminBytes, _ := json.Marshal(admin)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(adminBytes))
+	adminToken := login(adminBytes)
+
+	user := userBody{
+		Username: "TestUsername",
+		Password: "TestPassword",
+		Email:    "Test@email.com",
+	}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	userToken := login(userBytes)
+
+	// List with a filter
+	var respData utils.Response
+	resp, err := requestWithToken(http.MethodGet, baseURL+"/api/admin/users?role=user", adminToken, nil)
+	if err != nil {
+		t.Fatalf("GetAdminUserList Error: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	users, ok := listItems(respData.Data)
+	if !ok || len(users) != 1 || users[0].(map[string]interface{})["username"] != user.Username {
+		t.Fatalf("GetAdminUserList Error: %v", "Data error")
+	}
+
+	// Users cannot use the admin endpoints, and admins cannot change themselves
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/admin/users", userToken, nil)
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("GetAdminUserList Error: %v", resp.Status)
+	}
+	roleBytes, _ := json.Marshal(map[string]string{"role": model.RoleUser})
+	resp, _ = requestWithToken(http.MethodPut, baseURL+"/api/admin/user/1/role", adminToken, bytes.NewReader(roleBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorModifySelf {
+		t.Fatalf("UpdateUserRole Error: %v", respData.Message)
+	}
+
+	// A disabled user cannot login, and existing tokens stop working
+	resp, _ = requestWithToken(http.MethodPost, baseURL+"/api/admin/user/2/disable", adminToken, bytes.NewReader([]byte(`{"reason":"spam"}`)))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DisableUser Error: %v", resp.Status)
+	}
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorUserDisabled {
+		t.Fatalf("Login Error: %v", respData.Message)
+	}
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/user/tokens", userToken, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("DisableUser Error: %v", resp.Status)
+	}
+
+	resp, _ = requestWithToken(http.MethodPost, baseURL+"/api/admin/user/2/enable", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("EnableUser Error: %v", resp.Status)
+	}
+
+	// A forced reset returns a reset token at login, which needs a new password
+	staleToken := userToken
+	resp, _ = requestWithToken(http.MethodPost, baseURL+"/api/admin/user/2/password-reset", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("RequirePasswordReset Error: %v", resp.Status)
+	}
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	loginData, ok := respData.Data.(map[string]interface{})
+	if !ok || loginData["password_reset_required"] != true {
+		t.Fatalf("Login Error: %v", "Data format error")
+	}
+	resetToken, _ := loginData["token"].(string)
+
+	resetBytes, _ := json.Marshal(map[string]string{"token": resetToken, "password": user.Password})
+	resp, _ = http.Post(baseURL+"/api/login/password-reset", "application/json", bytes.NewReader(resetBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorPasswordUnchanged {
+		t.Fatalf("LoginPasswordReset Error: %v", respData.Message)
+	}
+	resetBytes, _ = json.Marshal(map[string]string{"token": resetToken, "password": "NewPassword"})
+	resp, _ = http.Post(baseURL+"/api/login/password-reset", "application/json", bytes.NewReader(resetBytes))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LoginPasswordReset Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	userToken, _ = respData.Data.(string)
+
+	// The tokens from before the reset stay revoked
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/user/tokens", staleToken, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("LoginPasswordReset Error: %v", resp.Status)
+	}
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/user/tokens", userToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LoginPasswordReset Error: %v", resp.Status)
+	}
+
+	// The articles of a hard deleted user are given to the admin
+	articleBytes, _ := json.Marshal(model.Article{Title: "test", Content: "test"})
+	_, _ = postWithToken(baseURL+"/api/article", userToken, bytes.NewReader(articleBytes))
+
+	resp, _ = requestWithToken(http.MethodDelete, baseURL+"/api/admin/user/2?hard=true&reassign_to=1", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("AdminDeleteUser Error: %v", resp.Status)
+	}
+
+	resp, _ = http.Get(baseURL + "/api/article/1")
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	articleData, ok := respData.Data.(map[string]interface{})
+	if !ok || articleData["user_id"] != float64(1) {
+		t.Fatalf("AdminDeleteUser Error: %v", "Data error")
+	}
+
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/user/tokens", userToken, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("AdminDeleteUser Error: %v", resp.Status)
+	}
+}
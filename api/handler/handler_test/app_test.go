@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"blog-go/api/handler"
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/logging"
+	"blog-go/internal/metrics"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/routes"
+	"blog-go/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestAppWithMemoryRepositories(t *testing.T) {
+	config.InitTestConfig()
+
+	server := httptest.NewServer(routes.NewRouter(handler.NewApp(repository.NewMemoryRepositories())))
+	defer server.Close()
+
+	user := userBody{
+		Username: "TestUsername",
+		Password: "TestPassword",
+		Email:    "Test@email.com",
+	}
+	userBytes, _ := json.Marshal(user)
+	resp, err := http.Post(server.URL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateUser Error: %v", err)
+	}
+
+	resp, _ = http.Post(server.URL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	token, _ := respData.Data.(string)
+	if token == "" {
+		t.Fatalf("Login Error: %v", respData.Message)
+	}
+
+	articleBytes, _ := json.Marshal(model.Article{Title: "TestTitle", Content: "TestContent"})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/article", bytes.NewReader(articleBytes))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+
+	resp, _ = http.Get(server.URL + "/api/article/1")
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	article, ok := respData.Data.(map[string]interface{})
+	if !ok || article["title"] != "TestTitle" || article["user_id"] != float64(1) {
+		t.Fatalf("GetArticle Error: %v", respData.Message)
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	config.InitTestConfig()
+
+	server := httptest.NewServer(routes.NewRouter(handler.NewApp(repository.NewMemoryRepositories())))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/articles")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetArticleList Error: %v", err)
+	}
+	if resp.Header.Get("Deprecation") != "" || resp.Header.Get("Sunset") != "" {
+		t.Fatalf("GetArticleList Error: %v", resp.Header)
+	}
+
+	// The unversioned routes are an alias of v1 that is going away.
+	resp, err = http.Get(server.URL + "/api/articles")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetArticleList Error: %v", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Deprecation"), "@") || resp.Header.Get("Sunset") == "" ||
+		resp.Header.Get("Link") != `</api/v1>; rel="successor-version"` {
+		t.Fatalf("GetArticleList Error: %v", resp.Header)
+	}
+
+	// The list routes by path parameter are deprecated in v1 too.
+	resp, err = http.Get(server.URL + "/api/v1/articles/category/1")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetArticleListByCategory Error: %v", err)
+	}
+	if _, err := http.ParseTime(resp.Header.Get("Sunset")); err != nil {
+		t.Fatalf("GetArticleListByCategory Error: %v", err)
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	config.InitTestConfig()
+
+	server := routes.NewServer(routes.NewRouter(handler.NewApp(repository.NewMemoryRepositories())))
+	if server.ReadHeaderTimeout == 0 || server.WriteTimeout == 0 || server.IdleTimeout == 0 {
+		t.Fatalf("NewServer Error: %v", server)
+	}
+	server.Addr = "127.0.0.1:0"
+
+	// The shutdown functions run in order after the server stopped, and the first error is returned.
+	var order []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- routes.Serve(ctx, server,
+			func(context.Context) error { order = append(order, "workers"); return errors.New("flush") },
+			func(context.Context) error { order = append(order, "db"); return nil },
+		)
+	}()
+	cancel()
+	if err := <-done; err == nil || err.Error() != "flush" {
+		t.Fatalf("Serve Error: %v", err)
+	}
+	if len(order) != 2 || order[0] != "workers" || order[1] != "db" {
+		t.Fatalf("Serve Error: %v", order)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	app := handler.NewApp(repository.NewGormRepositories(db.DB))
+	app.HealthChecks = []handler.HealthCheck{
+		{Name: "database", Check: db.Ping},
+		{Name: "migrations", Check: db.CheckMigrations},
+		{Name: "storage", Check: utils.CheckStorage},
+	}
+	server := httptest.NewServer(routes.NewRouter(app))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Healthz Error: %v", err)
+	}
+
+	var ready struct {
+		Status string                            `json:"status"`
+		Checks map[string]map[string]interface{} `json:"checks"`
+	}
+	resp, err = http.Get(server.URL + "/readyz")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Readyz Error: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&ready)
+	if ready.Status != "ok" || len(ready.Checks) != 3 || ready.Checks["migrations"]["status"] != "ok" {
+		t.Fatalf("Readyz Error: %+v", ready)
+	}
+
+	// A failing check makes the app unavailable, without telling the reason.
+	app.HealthChecks = append(app.HealthChecks, handler.HealthCheck{Name: "broken", Check: func(context.Context) (string, error) {
+		return "", errors.New("unreachable")
+	}})
+	resp, err = http.Get(server.URL + "/readyz")
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Readyz Error: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&ready)
+	if ready.Status != "unavailable" || ready.Checks["database"]["status"] != "ok" ||
+		len(ready.Checks["broken"]) != 1 || ready.Checks["broken"]["status"] != "failed" {
+		t.Fatalf("Readyz Error: %+v", ready)
+	}
+
+	resp, err = http.Get(server.URL + "/version")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetVersion Error: %v", err)
+	}
+	var build map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&build)
+	if build["version"] != "dev" || build["commit"] == nil || build["start_time"] == nil {
+		t.Fatalf("GetVersion Error: %v", build)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	config.InitTestConfig()
+
+	app := handler.NewApp(repository.NewMemoryRepositories())
+	if err := metrics.RegisterGauges(time.Hour, app.Gauges()...); err != nil {
+		t.Fatalf("RegisterGauges Error: %v", err)
+	}
+	server := httptest.NewServer(routes.NewRouter(app))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/article/1")
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+
+	// Only the scrapers with the token get the metrics.
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Metrics Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Metrics Error: %v", resp.Status)
+	}
+	resp, err = requestWithToken(http.MethodGet, server.URL+"/metrics", "wrong-token", nil)
+	if err != nil {
+		t.Fatalf("Metrics Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Metrics Error: %v", resp.Status)
+	}
+
+	resp, err = requestWithToken(http.MethodGet, server.URL+"/metrics", config.GetMetricsConfig().Token, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Metrics Error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	// Requests are labeled by the route template, not the path.
+	for _, want := range []string{
+		`blog_http_requests_total{method="GET",route="/api/v1/article/:id",status="404"} 1`,
+		`blog_http_request_duration_seconds_count{method="GET",route="/api/v1/article/:id",status="404"} 1`,
+		"blog_articles 0",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("Metrics Error: %s is missing", want)
+		}
+	}
+
+	// The gauges are kept for the interval instead of being counted on every scrape.
+	if err := app.Articles.CreateArticle(&model.Article{Title: "test", Content: "test"}); err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	resp, err = requestWithToken(http.MethodGet, server.URL+"/metrics", config.GetMetricsConfig().Token, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Metrics Error: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "blog_articles 0") {
+		t.Fatalf("Metrics Error: %s", body)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	// The request continues the trace of the client.
+	req, _ := http.NewRequest(http.MethodGet, serverURL+"/api/v1/article/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+
+	var server, query sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "GET /api/v1/article/:id":
+			server = span
+		case "gorm.query":
+			query = span
+		}
+	}
+	if server == nil || server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("Tracing Error: %v", recorder.Ended())
+	}
+	if query == nil || query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatalf("Tracing Error: %v", recorder.Ended())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	hook := logtest.NewLocal(logging.Logger)
+	defer logging.Logger.ReplaceHooks(make(logrus.LevelHooks))
+	level := logging.Logger.GetLevel()
+	logging.Logger.SetLevel(logrus.DebugLevel)
+	defer logging.Logger.SetLevel(level)
+
+	// The ID of the client is echoed, and the request and its queries are logged with it.
+	req, _ := http.NewRequest(http.MethodGet, serverURL+"/api/v1/article/1", nil)
+	req.Header.Set("X-Request-ID", "client-id-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	if id := resp.Header.Get("X-Request-ID"); id != "client-id-1" {
+		t.Fatalf("RequestID Error: %q", id)
+	}
+	var request, query bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["request_id"] != "client-id-1" {
+			continue
+		}
+		if entry.Data["req_uri"] == "/api/v1/article/1" {
+			request = true
+		}
+		if entry.Message == "Query" {
+			query = true
+		}
+	}
+	if !request || !query {
+		t.Fatalf("RequestID Error: %v", hook.AllEntries())
+	}
+
+	// Invalid IDs are replaced.
+	req, _ = http.NewRequest(http.MethodGet, serverURL+"/healthz", nil)
+	req.Header.Set("X-Request-ID", "bad id")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Healthz Error: %v", err)
+	}
+	if id := resp.Header.Get("X-Request-ID"); len(id) != 32 {
+		t.Fatalf("RequestID Error: %q", id)
+	}
+}
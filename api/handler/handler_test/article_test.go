@@ -1,22 +1,23 @@
-package handler_test
+package handler
 
 import (
 	"blog-go/config"
 	"blog-go/internal/db"
 	"blog-go/internal/model"
-	"blog-go/routes"
 	"blog-go/utils"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"testing"
 )
 
 func TestCreateArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	article := model.Article{
 		Title:   "test",
@@ -28,7 +29,7 @@ func TestCreateArticle(t *testing.T) {
 		t.Fatalf("CreateArticle Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	resp, err := postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	if err != nil {
 		t.Fatalf("CreateArticle Error: %v", err)
 	}
@@ -44,12 +45,69 @@ func TestCreateArticle(t *testing.T) {
 	if respData.Status != utils.Success {
 		t.Fatalf("CreateArticle Error: %v", respData.Message)
 	}
+
+	// Fields that the server sets are ignored.
+	resp, err = postWithToken(serverURL+"/api/article", token, bytes.NewReader([]byte(`{"id":100,"title":"test","content":"test","read_count":100,"user_id":100}`)))
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	respData = utils.Response{}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	articleData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("CreateArticle Error: %v", respData.Message)
+	}
+	if articleData["id"] != float64(2) || articleData["read_count"] != float64(0) || articleData["user_id"] != float64(1) {
+		t.Fatalf("CreateArticle Error: %v", articleData)
+	}
+
+	// The categories must exist.
+	resp, err = postWithToken(serverURL+"/api/article", token, bytes.NewReader([]byte(`{"title":"test","content":"test","category_ids":[1]}`)))
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("CreateArticle Error: %v", resp.Status)
+	}
+
+	// An article without a title is rejected with the failed rule.
+	resp, err = postWithToken(serverURL+"/api/article", token, bytes.NewReader([]byte(`{"content":"test"}`)))
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("CreateArticle Error: %v", resp.Status)
+	}
+	respData = utils.Response{}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	if respData.Status != utils.ErrorValidation || len(respData.Errors) != 1 {
+		t.Fatalf("CreateArticle Error: %v", respData)
+	}
+	if respData.Errors[0].Field != "title" || respData.Errors[0].Rule != "required" || respData.Errors[0].Message != "title is required" {
+		t.Fatalf("CreateArticle Error: %v", respData.Errors[0])
+	}
+
+	// A body that is not JSON is a bad request.
+	resp, err = postWithToken(serverURL+"/api/article", token, bytes.NewReader([]byte(`{`)))
+	if err != nil {
+		t.Fatalf("CreateArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("CreateArticle Error: %v", resp.Status)
+	}
 }
 
 func TestGetArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	article := model.Article{
 		Title:   "test",
@@ -61,9 +119,9 @@ func TestGetArticle(t *testing.T) {
 		t.Fatalf("CreateArticle Error: %v", err)
 	}
 
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/article/1")
+	resp, err := http.Get(serverURL + "/api/article/1")
 	if err != nil {
 		t.Fatalf("GetArticle Error: %v", err)
 	}
@@ -90,12 +148,61 @@ func TestGetArticle(t *testing.T) {
 	if articleData["content"] != article.Content {
 		t.Fatalf("GetArticle Error: %v", "content not equal")
 	}
+
+	resp, err = http.Get(serverURL + "/api/article/2")
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GetArticle Error: %v", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	if respData.Status != utils.ErrorArticleNotExist {
+		t.Fatalf("GetArticle Error: %v", respData.Message)
+	}
+	if respData.Message != "Article does not exist" {
+		t.Fatalf("GetArticle Error: %v", respData.Message)
+	}
+
+	// The message is in the language of the client.
+	req, err := http.NewRequest(http.MethodGet, serverURL+"/api/article/2", nil)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	if respData.Message != "文章不存在" {
+		t.Fatalf("GetArticle Error: %v", respData.Message)
+	}
+
+	resp, err = http.Get(serverURL + "/api/article/2?lang=zh-CN")
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	if respData.Message != "文章不存在" {
+		t.Fatalf("GetArticle Error: %v", respData.Message)
+	}
 }
 
 func TestGetArticleList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	for i := 0; i < 10; i++ {
 		article := model.Article{
@@ -103,10 +210,10 @@ func TestGetArticleList(t *testing.T) {
 			Content: "test" + strconv.Itoa(i),
 		}
 		articleBytes, _ := json.Marshal(article)
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+		_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/articles?page_num=4&page_size=3")
+	resp, err := http.Get(serverURL + "/api/articles?page_num=4&page_size=3")
 	if err != nil {
 		t.Fatalf("GetArticleList Error: %v", err)
 	}
@@ -123,7 +230,7 @@ func TestGetArticleList(t *testing.T) {
 		t.Fatalf("GetArticleList Error: %v", respData.Message)
 	}
 
-	articleData, ok := respData.Data.([]interface{})
+	articleData, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetArticleList Error: %v", respData.Message)
 	}
@@ -132,29 +239,81 @@ func TestGetArticleList(t *testing.T) {
 	}
 }
 
+func TestGetArticleListCursor(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	token := loginAuthor()
+	baseURL := serverURL
+
+	for i := 0; i < 5; i++ {
+		articleBytes, _ := json.Marshal(articleBody{Title: "test" + strconv.Itoa(i), Content: "test"})
+		_, _ = postWithToken(baseURL+"/api/article", token, bytes.NewReader(articleBytes))
+	}
+
+	var titles []interface{}
+	url := baseURL + "/api/articles?page_size=2&with_total=true"
+	for {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GetArticleList Error: %v", err)
+		}
+		var respData utils.Response
+		_ = json.NewDecoder(resp.Body).Decode(&respData)
+		list, ok := respData.Data.(map[string]interface{})
+		if !ok || list["total"] != float64(5) {
+			t.Fatalf("GetArticleList Error: %v", "Data error")
+		}
+		items, _ := listItems(respData.Data)
+		for _, item := range items {
+			titles = append(titles, item.(map[string]interface{})["title"])
+		}
+		if list["has_more"] != true {
+			if _, ok := list["next_cursor"]; ok {
+				t.Fatalf("GetArticleList Error: %v", "next_cursor without more items")
+			}
+			break
+		}
+		url = baseURL + "/api/articles?page_size=2&with_total=true&cursor=" + list["next_cursor"].(string)
+	}
+	if len(titles) != 5 || titles[0] != "test4" || titles[4] != "test0" {
+		t.Fatalf("GetArticleList Error: %v", titles)
+	}
+
+	for _, query := range []string{"cursor=!!", "page_size=0", "page_num=0", "with_total=maybe"} {
+		resp, err := http.Get(baseURL + "/api/articles?" + query)
+		if err != nil {
+			t.Fatalf("GetArticleList Error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("GetArticleList Error: %v with %s", resp.Status, query)
+		}
+	}
+}
+
 func TestGetArticleListByCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
 	}
 	categoryBytes, _ := json.Marshal(category)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
-	category.ID = 1
+	_, _ = postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 
 	for i := 0; i < 10; i++ {
-		article := model.Article{
-			Title:      "test" + strconv.Itoa(i),
-			Content:    "test" + strconv.Itoa(i),
-			Categories: []*model.Category{&category},
+		article := articleBody{
+			Title:       "test" + strconv.Itoa(i),
+			Content:     "test" + strconv.Itoa(i),
+			CategoryIDs: []uint{1},
 		}
 		articleBytes, _ := json.Marshal(article)
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+		_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/articles/category/1")
+	resp, err := http.Get(serverURL + "/api/articles/category/1")
 	if err != nil {
 		t.Fatalf("GetArticleListByCategory Error: %v", err)
 	}
@@ -171,7 +330,7 @@ func TestGetArticleListByCategory(t *testing.T) {
 		t.Fatalf("GetArticleListByCategory Error: %v", respData.Message)
 	}
 
-	articleData, ok := respData.Data.([]interface{})
+	articleData, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetArticleListByCategory Error: %v", respData.Message)
 	}
@@ -180,39 +339,176 @@ func TestGetArticleListByCategory(t *testing.T) {
 	}
 }
 
+func TestGetArticleListQuery(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	token := loginAuthor()
+	baseURL := serverURL
+
+	categoryBytes, _ := json.Marshal(model.Category{Name: "test"})
+	_, _ = postWithToken(baseURL+"/api/category", token, bytes.NewReader(categoryBytes))
+	for i := 0; i < 4; i++ {
+		article := articleBody{Title: "test" + strconv.Itoa(i%2), Content: "test"}
+		if i < 3 {
+			article.CategoryIDs = []uint{1}
+		}
+		articleBytes, _ := json.Marshal(article)
+		_, _ = postWithToken(baseURL+"/api/article", token, bytes.NewReader(articleBytes))
+	}
+	commentBytes, _ := json.Marshal(commentBody{ArticleID: 1, Content: "test"})
+	_, _ = postWithToken(baseURL+"/api/comment", token, bytes.NewReader(commentBytes))
+
+	resp, err := http.Get(baseURL + "/api/articles?filter[category]=1&filter[created_at][gte]=2000-01-01&sort=-comment_count,title")
+	if err != nil {
+		t.Fatalf("GetArticleList Error: %v", err)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	items, ok := listItems(respData.Data)
+	if !ok || len(items) != 3 {
+		t.Fatalf("GetArticleList Error: %v", respData.Message)
+	}
+	// Article 1 has a comment, then the titles order articles 3 and 2
+	for i, id := range []float64{1, 3, 2} {
+		if items[i].(map[string]interface{})["id"] != id {
+			t.Fatalf("GetArticleList Error: %v", items)
+		}
+	}
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"filter[content]=test", "filter[content]"},
+		{"filter[category][gt]=1", "filter[category][gt]"},
+		{"filter[read_count][gte]=many", "filter[read_count][gte]"},
+		{"filter[created_at]", "filter[created_at]"},
+		{"sort=content", "sort"},
+		{"sort=title,-title", "sort"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/api/articles?"+test.query, nil)
+		req.Header.Set("Accept-Language", "zh-CN")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GetArticleList Error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("GetArticleList Error: %v with %s", resp.Status, test.query)
+		}
+		var respData utils.Response
+		_ = json.NewDecoder(resp.Body).Decode(&respData)
+		if len(respData.Errors) != 1 || respData.Errors[0].Field != test.field || respData.Errors[0].Message == "" {
+			t.Fatalf("GetArticleList Error: %v with %s", respData.Errors, test.query)
+		}
+	}
+}
+
+func TestGetArticleView(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	token := loginAuthor()
+	baseURL := serverURL
+
+	categoryBytes, _ := json.Marshal(model.Category{Name: "test"})
+	_, _ = postWithToken(baseURL+"/api/category", token, bytes.NewReader(categoryBytes))
+	articleBytes, _ := json.Marshal(articleBody{Title: "test", Content: "test", CategoryIDs: []uint{1}})
+	_, _ = postWithToken(baseURL+"/api/article", token, bytes.NewReader(articleBytes))
+	commentBytes, _ := json.Marshal(commentBody{ArticleID: 1, Content: "test"})
+	_, _ = postWithToken(baseURL+"/api/comment", token, bytes.NewReader(commentBytes))
+
+	resp, err := http.Get(baseURL + "/api/article/1?fields=title,read_count&expand=author,comments")
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	article, ok := respData.Data.(map[string]interface{})
+	if !ok || len(article) != 5 || article["title"] != "test" || article["read_count"] == nil {
+		t.Fatalf("GetArticle Error: %v", respData.Data)
+	}
+	if author, ok := article["author"].(map[string]interface{}); !ok || author["username"] == nil {
+		t.Fatalf("GetArticle Error: %v", article)
+	}
+	if comments, ok := article["comments"].([]interface{}); !ok || len(comments) != 1 {
+		t.Fatalf("GetArticle Error: %v", article)
+	}
+
+	// Lists select the content on request.
+	resp, err = http.Get(baseURL + "/api/articles?fields=content&expand=")
+	if err != nil {
+		t.Fatalf("GetArticleList Error: %v", err)
+	}
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	items, ok := listItems(respData.Data)
+	if !ok || len(items) != 1 {
+		t.Fatalf("GetArticleList Error: %v", respData.Message)
+	}
+	if item := items[0].(map[string]interface{}); len(item) != 2 || item["content"] != "test" {
+		t.Fatalf("GetArticleList Error: %v", item)
+	}
+
+	tests := []struct {
+		url   string
+		field string
+	}{
+		{"/api/article/1?fields=title,slug", "fields"},
+		{"/api/article/1?expand=user", "expand"},
+		{"/api/articles?expand=comments", "expand"},
+		{"/api/comment/1?expand=categories", "expand"},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(baseURL + test.url)
+		if err != nil {
+			t.Fatalf("GetArticle Error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("GetArticle Error: %v with %s", resp.Status, test.url)
+		}
+		var respData utils.Response
+		_ = json.NewDecoder(resp.Body).Decode(&respData)
+		if len(respData.Errors) != 1 || respData.Errors[0].Field != test.field || respData.Errors[0].Message == "" {
+			t.Fatalf("GetArticle Error: %v with %s", respData.Errors, test.url)
+		}
+	}
+}
+
 func TestGetArticleListByTitle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
 	}
 	categoryBytes, _ := json.Marshal(category)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
-	category.ID = 1
+	_, _ = postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 
 	for i := 0; i < 10; i++ {
-		article := model.Article{
-			Title:      "test" + strconv.Itoa(i),
-			Content:    "test" + strconv.Itoa(i),
-			Categories: []*model.Category{&category},
+		article := articleBody{
+			Title:       "test" + strconv.Itoa(i),
+			Content:     "test" + strconv.Itoa(i),
+			CategoryIDs: []uint{1},
 		}
 		articleBytes, _ := json.Marshal(article)
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+		_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	}
 
 	for i := 0; i < 10; i++ {
-		article := model.Article{
-			Title:      "title" + strconv.Itoa(i),
-			Content:    "test" + strconv.Itoa(i),
-			Categories: []*model.Category{&category},
+		article := articleBody{
+			Title:       "title" + strconv.Itoa(i),
+			Content:     "test" + strconv.Itoa(i),
+			CategoryIDs: []uint{1},
 		}
 		articleBytes, _ := json.Marshal(article)
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+		_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/articles/test?page_num=2&page_size=3")
+	resp, err := http.Get(serverURL + "/api/articles/test?page_num=2&page_size=3")
 	if err != nil {
 		t.Fatalf("GetArticleListByCategory Error: %v", err)
 	}
@@ -229,7 +525,7 @@ func TestGetArticleListByTitle(t *testing.T) {
 		t.Fatalf("GetArticleListByCategory Error: %v", respData.Message)
 	}
 
-	articleData, ok := respData.Data.([]interface{})
+	articleData, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetArticleListByCategory Error: %v", respData.Message)
 	}
@@ -239,9 +535,10 @@ func TestGetArticleListByTitle(t *testing.T) {
 }
 
 func TestUpdateArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	article := model.Article{
 		Title:   "test",
@@ -249,12 +546,23 @@ func TestUpdateArticle(t *testing.T) {
 	}
 
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 
 	article.Title = "test1"
 	articleBytes, _ = json.Marshal(article)
-	req, _ := http.NewRequest("PUT", "http://localhost"+config.GetServerConfig().Port+"/api/article/1", bytes.NewReader(articleBytes))
-	resp, err := http.DefaultClient.Do(req)
+
+	// Only the author or an admin can update the article.
+	resp, err := requestWithToken(http.MethodPut, serverURL+"/api/article/1", loginReader(), bytes.NewReader(articleBytes))
+	if err != nil {
+		t.Fatalf("UpdateArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("UpdateArticle Error: %v", resp.Status)
+	}
+
+	req, _ := http.NewRequest("PUT", serverURL+"/api/article/1", bytes.NewReader(articleBytes))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("UpdateArticle Error: %v", err)
 	}
@@ -262,7 +570,7 @@ func TestUpdateArticle(t *testing.T) {
 		t.Fatalf("UpdateArticle Error: %v", resp.Status)
 	}
 
-	resp, _ = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/article/1")
+	resp, _ = http.Get(serverURL + "/api/article/1")
 
 	var respData utils.Response
 	err = json.NewDecoder(resp.Body).Decode(&respData)
@@ -282,10 +590,86 @@ func TestUpdateArticle(t *testing.T) {
 	}
 }
 
+func TestPatchArticle(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	token := loginAuthor()
+
+	categoryBytes, _ := json.Marshal(model.Category{Name: "test"})
+	_, _ = postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
+	articleBytes, _ := json.Marshal(articleBody{Title: "test", Content: "test", CategoryIDs: []uint{1}})
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
+
+	resp, err := http.Get(serverURL + "/api/article/1")
+	if err != nil {
+		t.Fatalf("GetArticle Error: %v", err)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("GetArticle Error: %v", etag)
+	}
+
+	// The title is replaced, the categories are cleared and the content is kept.
+	resp, err = patchWithToken(serverURL+"/api/article/1", token, etag, strings.NewReader(`{"title":"patched","category_ids":null}`))
+	if err != nil {
+		t.Fatalf("PatchArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PatchArticle Error: %v", resp.Status)
+	}
+	if resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("PatchArticle Error: %v", resp.Header.Get("ETag"))
+	}
+	var respData utils.Response
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("PatchArticle Error: %v", err)
+	}
+	articleData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("PatchArticle Error: %v", respData.Message)
+	}
+	categories, _ := articleData["categories"].([]interface{})
+	if articleData["title"] != "patched" || articleData["content"] != "test" || len(categories) != 0 {
+		t.Fatalf("PatchArticle Error: %v", articleData)
+	}
+
+	// The article has changed since the ETag was read.
+	resp, err = patchWithToken(serverURL+"/api/article/1", token, etag, strings.NewReader(`{"title":"stale"}`))
+	if err != nil {
+		t.Fatalf("PatchArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PatchArticle Error: %v", resp.Status)
+	}
+
+	// The patched article is validated like a new one.
+	resp, err = patchWithToken(serverURL+"/api/article/1", token, "", strings.NewReader(`{"title":null}`))
+	if err != nil {
+		t.Fatalf("PatchArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("PatchArticle Error: %v", resp.Status)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, serverURL+"/api/article/1", strings.NewReader(`title=test`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PatchArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("PatchArticle Error: %v", resp.Status)
+	}
+}
+
 func TestDeleteArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	article := model.Article{
 		Title:   "test",
@@ -293,10 +677,29 @@ func TestDeleteArticle(t *testing.T) {
 	}
 
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
+
+	// A user that is not an admin can delete their own article, but not the articles of others.
+	readerToken := loginReader()
+	_, _ = postWithToken(serverURL+"/api/article", readerToken, bytes.NewReader(articleBytes))
+	resp, err := requestWithToken(http.MethodDelete, serverURL+"/api/article/1", readerToken, nil)
+	if err != nil {
+		t.Fatalf("DeleteArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("DeleteArticle Error: %v", resp.Status)
+	}
+	resp, err = requestWithToken(http.MethodDelete, serverURL+"/api/article/2", readerToken, nil)
+	if err != nil {
+		t.Fatalf("DeleteArticle Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DeleteArticle Error: %v", resp.Status)
+	}
 
-	req, _ := http.NewRequest(http.MethodDelete, "http://localhost"+config.GetServerConfig().Port+"/api/article/1", nil)
-	resp, err := http.DefaultClient.Do(req)
+	req, _ := http.NewRequest(http.MethodDelete, serverURL+"/api/article/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("DeleteArticle Error: %v", err)
 	}
@@ -304,7 +707,7 @@ func TestDeleteArticle(t *testing.T) {
 		t.Fatalf("DeleteArticle Error: %v", resp.Status)
 	}
 
-	resp, _ = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/article/1")
+	resp, _ = http.Get(serverURL + "/api/article/1")
 
 	var respData utils.Response
 	err = json.NewDecoder(resp.Body).Decode(&respData)
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"blog-go/api/handler"
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/routes"
+	"blog-go/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditEvents(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	// The first user is the admin
+	token := loginAuthor()
+
+	// Create, rename and delete a category
+	req, _ := http.NewRequest(http.MethodPost, serverURL+"/api/v1/category", strings.NewReader(`{"name":"go"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	// A request ID that a spreadsheet would take for a formula
+	req.Header.Set("X-Request-ID", "-audit-test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateCategory Error: %v", err)
+	}
+	resp, err = requestWithToken(http.MethodPut, serverURL+"/api/v1/category/1", token, strings.NewReader(`{"name":"golang"}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("UpdateCategory Error: %v", err)
+	}
+	resp, err = requestWithToken(http.MethodDelete, serverURL+"/api/v1/category/1", token, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("DeleteCategory Error: %v", err)
+	}
+	// Failed changes are not recorded
+	resp, err = requestWithToken(http.MethodDelete, serverURL+"/api/v1/category/1", token, nil)
+	if err != nil || resp.StatusCode == http.StatusOK {
+		t.Fatalf("DeleteCategory Error: %v", err)
+	}
+
+	// The events of the category, newest first
+	resp, err = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events?filter[resource_type]=category&filter[resource_id]=1", token, nil)
+	if err != nil {
+		t.Fatalf("GetAuditEventList Error: %v", err)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	events, ok := listItems(respData.Data)
+	if !ok || len(events) != 3 {
+		t.Fatalf("GetAuditEventList Error: %v", respData.Data)
+	}
+	for i, action := range []string{"delete", "update", "create"} {
+		event := events[i].(map[string]interface{})
+		if event["action"] != action || event["actor_id"] != float64(1) || event["actor_name"] != "TestAuthor" {
+			t.Fatalf("GetAuditEventList Error: %v", event)
+		}
+	}
+	created := events[2].(map[string]interface{})
+	if created["request_id"] != "-audit-test" || created["ip"] == "" {
+		t.Fatalf("GetAuditEventList Error: %v", created)
+	}
+	name := events[1].(map[string]interface{})["changes"].(map[string]interface{})["name"].(map[string]interface{})
+	if name["before"] != "go" || name["after"] != "golang" {
+		t.Fatalf("GetAuditEventList Error: %v", name)
+	}
+	if _, ok := events[0].(map[string]interface{})["changes"].(map[string]interface{})["name"].(map[string]interface{})["after"]; ok {
+		t.Fatalf("GetAuditEventList Error: %v", events[0])
+	}
+
+	// Filters on the actor and the time range
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events?filter[actor_id]=2", token, nil)
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if events, ok := listItems(respData.Data); !ok || len(events) != 0 {
+		t.Fatalf("GetAuditEventList Error: %v", respData.Data)
+	}
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events?filter[created_at][lt]=2000-01-01", token, nil)
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if events, ok := listItems(respData.Data); !ok || len(events) != 0 {
+		t.Fatalf("GetAuditEventList Error: %v", respData.Data)
+	}
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events?filter[ip]=1", token, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GetAuditEventList Error: %v", resp.Status)
+	}
+
+	// Export as CSV and as JSON Lines. The sign up of the admin is an event without an actor.
+	resp, err = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events/export", token, nil)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("ExportAuditEvents Error: %v", err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil || len(records) != 5 || records[0][0] != "id" || records[4][4] != "create" || records[4][5] != "user" || records[4][2] != "" {
+		t.Fatalf("ExportAuditEvents Error: %v", records)
+	}
+	if records[3][9] != "'-audit-test" || !strings.HasPrefix(records[3][7], "{") {
+		t.Fatalf("ExportAuditEvents Error: %v", records[3])
+	}
+	resp, err = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events/export?format=json&filter[action]=update", token, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("ExportAuditEvents Error: %v", err)
+	}
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("ExportAuditEvents Error: %v", err)
+		}
+		lines = append(lines, event)
+	}
+	if len(lines) != 1 || lines[0]["resource_type"] != "category" {
+		t.Fatalf("ExportAuditEvents Error: %v", lines)
+	}
+
+	// Only admins see the audit trail
+	user := userBody{Username: "TestUsername", Password: "TestPassword", Email: "test@email.com"}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(serverURL+"/api/v1/user", "application/json", bytes.NewReader(userBytes))
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events", login(userBytes), nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("GetAuditEventList Error: %v", resp.Status)
+	}
+}
+
+func TestAuditAccountChanges(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	token := loginAuthor()
+
+	// Unlock a login
+	resp, err := postWithToken(serverURL+"/api/v1/admin/login/unlock", token, strings.NewReader(`{"username":"TestUsername"}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("UnlockLogin Error: %v", err)
+	}
+	events := auditEvents(t, token, "filter[action]=unlock")
+	if len(events) != 1 || events[0]["resource_type"] != "lockout" || events[0]["actor_name"] != "TestAuthor" {
+		t.Fatalf("UnlockLogin Error: %v", events)
+	}
+
+	// Create and revoke a personal access token, whose events never hold the token
+	resp, _ = postWithToken(serverURL+"/api/v1/user/tokens", token, strings.NewReader(`{"name":"ci","scopes":["articles:write"]}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CreateAccessToken Error: %v", resp.Status)
+	}
+	resp, _ = requestWithToken(http.MethodDelete, serverURL+"/api/v1/user/tokens/1", token, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DeleteAccessToken Error: %v", resp.Status)
+	}
+	events = auditEvents(t, token, "filter[resource_type]=access_token")
+	if len(events) != 2 || events[0]["action"] != "delete" || events[1]["action"] != "create" {
+		t.Fatalf("AccessToken Error: %v", events)
+	}
+	if _, ok := events[1]["changes"].(map[string]interface{})["token"]; ok {
+		t.Fatalf("AccessToken Error: %v", events[1])
+	}
+
+	// Enable two-factor authentication, replace the recovery codes and disable it
+	resp, _ = postWithToken(serverURL+"/api/v1/user/1/totp", token, nil)
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	secret, _ := respData.Data.(map[string]interface{})["secret"].(string)
+	code, _ := utils.GenerateTOTPCode(secret, time.Now())
+	resp, _ = postWithToken(serverURL+"/api/v1/user/1/totp/confirm", token, strings.NewReader(`{"code":"`+code+`"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ConfirmTOTP Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	recoveryCodes, _ := respData.Data.([]interface{})
+	if len(recoveryCodes) == 0 {
+		t.Fatalf("ConfirmTOTP Error: %v", respData.Data)
+	}
+	resp, _ = postWithToken(serverURL+"/api/v1/user/1/totp/recovery-codes", token, strings.NewReader(`{"code":"`+recoveryCodes[0].(string)+`"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("RegenerateRecoveryCodes Error: %v", resp.Status)
+	}
+	code, _ = utils.GenerateTOTPCode(secret, time.Now().Add(30*time.Second))
+	resp, _ = requestWithToken(http.MethodDelete, serverURL+"/api/v1/user/1/totp", token, strings.NewReader(`{"code":"`+code+`"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DisableTOTP Error: %v", resp.Status)
+	}
+	for _, action := range []string{"totp_enable", "totp_recovery_codes", "totp_disable"} {
+		events = auditEvents(t, token, "filter[action]="+action)
+		if len(events) != 1 || events[0]["resource_id"] != float64(1) {
+			t.Fatalf("TOTP Error: %v", events)
+		}
+	}
+}
+
+// slowAuditRepositories read every page of the audit trail after the first one slowly, like a large export does.
+type slowAuditRepositories struct {
+	repository.Repositories
+}
+
+func (r slowAuditRepositories) WithContext(ctx context.Context) repository.Repositories {
+	repos := r.Repositories.WithContext(ctx)
+	repos.AuditEvents = slowAuditRepository{repos.AuditEvents}
+	repos.Contexter = r
+	return repos
+}
+
+type slowAuditRepository struct {
+	repository.AuditRepository
+}
+
+func (r slowAuditRepository) GetAuditEventList(query repository.Query, page repository.Page) (*repository.List[model.AuditEvent], error) {
+	if page.After != nil {
+		time.Sleep(200 * time.Millisecond)
+	}
+	return r.AuditRepository.GetAuditEventList(query, page)
+}
+
+func TestExportAuditEventsWriteTimeout(t *testing.T) {
+	config.InitTestConfig()
+
+	repos := repository.NewMemoryRepositories()
+	repos.Contexter = slowAuditRepositories{repos}
+	server := httptest.NewUnstartedServer(routes.NewRouter(handler.NewApp(repos)))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	user := userBody{Username: "TestAuthor", Password: "TestPassword", Email: "author@email.com"}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(server.URL+"/api/v1/user", "application/json", bytes.NewReader(userBytes))
+	resp, _ := http.Post(server.URL+"/api/v1/login", "application/json", bytes.NewReader(userBytes))
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	token, _ := respData.Data.(string)
+
+	// Two pages of events, the sign up is the first one
+	for i := 0; i < 500; i++ {
+		if err := repos.AuditEvents.CreateAuditEvent(&model.AuditEvent{Action: "update", ResourceType: "article", ResourceID: 1}); err != nil {
+			t.Fatalf("CreateAuditEvent Error: %v", err)
+		}
+	}
+
+	// The export takes longer than the write timeout, and is still complete
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/admin/audit-events/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("ExportAuditEvents Error: %v", err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil || len(records) != 502 {
+		t.Fatalf("ExportAuditEvents Error: %v, %d records", err, len(records))
+	}
+}
+
+// auditEvents returns the audit events that match the query.
+func auditEvents(t *testing.T, token, query string) []map[string]interface{} {
+	resp, err := requestWithToken(http.MethodGet, serverURL+"/api/v1/admin/audit-events?"+query, token, nil)
+	if err != nil {
+		t.Fatalf("GetAuditEventList Error: %v", err)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	items, ok := listItems(respData.Data)
+	if !ok {
+		t.Fatalf("GetAuditEventList Error: %v", respData.Message)
+	}
+	events := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		events = append(events, item.(map[string]interface{}))
+	}
+	return events
+}
@@ -4,7 +4,6 @@ import (
 	"blog-go/config"
 	"blog-go/internal/db"
 	"blog-go/internal/model"
-	"blog-go/routes"
 	"blog-go/utils"
 	"bytes"
 	"encoding/json"
@@ -14,9 +13,10 @@ import (
 )
 
 func TestCreateCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
@@ -27,7 +27,7 @@ func TestCreateCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+	resp, err := postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
@@ -44,19 +44,20 @@ func TestCreateCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", respData.Message)
 	}
 
-	resp, err = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+	resp, err = postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
-	if resp.StatusCode == http.StatusOK {
+	if resp.StatusCode != http.StatusConflict {
 		t.Fatalf("CreateCategory Error: %v", resp.Status)
 	}
 }
 
 func TestGetCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
@@ -67,7 +68,7 @@ func TestGetCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+	resp, err := postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
@@ -75,7 +76,7 @@ func TestGetCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/category/1")
+	resp, err = http.Get(serverURL + "/api/category/1")
 	if err != nil {
 		t.Fatalf("GetCategory Error: %v", err)
 	}
@@ -102,9 +103,10 @@ func TestGetCategory(t *testing.T) {
 }
 
 func TestGetCategoryList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	for i := 0; i < 10; i++ {
 		category := model.Category{
@@ -116,7 +118,7 @@ func TestGetCategoryList(t *testing.T) {
 			t.Fatalf("CreateCategory Error: %v", err)
 		}
 
-		resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+		resp, err := postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 		if err != nil {
 			t.Fatalf("CreateCategory Error: %v", err)
 		}
@@ -125,7 +127,7 @@ func TestGetCategoryList(t *testing.T) {
 		}
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/categories")
+	resp, err := http.Get(serverURL + "/api/categories")
 	if err != nil {
 		t.Fatalf("GetCategoryList Error: %v", err)
 	}
@@ -142,19 +144,32 @@ func TestGetCategoryList(t *testing.T) {
 		t.Fatalf("GetCategoryList Error: %v", respData.Message)
 	}
 
-	categoryList, ok := respData.Data.([]interface{})
+	categoryList, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetCategoryList Error: %v", "Data format error")
 	}
 	if len(categoryList) != 10 {
 		t.Fatalf("GetCategoryList Error: %v", "Data error")
 	}
+
+	// Pages are capped like the other lists
+	resp, _ = http.Get(serverURL + "/api/v1/categories?page_size=3&sort=name&filter[name][contains]=test")
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	categoryList, ok = listItems(respData.Data)
+	if !ok || len(categoryList) != 3 || categoryList[0].(map[string]interface{})["name"] != "test0" {
+		t.Fatalf("GetCategoryList Error: %v", "Data error")
+	}
+	if data, _ := respData.Data.(map[string]interface{}); data["has_more"] != true || data["next_cursor"] == "" {
+		t.Fatalf("GetCategoryList Error: %v", "Data error")
+	}
 }
 
 func TestUpdateCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
@@ -165,7 +180,7 @@ func TestUpdateCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+	resp, err := postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
@@ -176,10 +191,11 @@ func TestUpdateCategory(t *testing.T) {
 	category.Name = "test1"
 	categoryBytes, _ = json.Marshal(category)
 
-	req, err := http.NewRequest(http.MethodPut, "http://localhost"+config.GetServerConfig().Port+"/api/category/1", bytes.NewReader(categoryBytes))
+	req, err := http.NewRequest(http.MethodPut, serverURL+"/api/category/1", bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("UpdateCategory Error: %v", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
@@ -189,7 +205,7 @@ func TestUpdateCategory(t *testing.T) {
 		t.Fatalf("UpdateCategory Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/category/1")
+	resp, err = http.Get(serverURL + "/api/category/1")
 	if err != nil {
 		t.Fatalf("GetCategory Error: %v", err)
 	}
@@ -213,12 +229,28 @@ func TestUpdateCategory(t *testing.T) {
 	if categoryData["name"] != category.Name {
 		t.Fatalf("UpdateCategory Error: %v", "Data error")
 	}
+	if resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("UpdateCategory Error: %v", resp.Header.Get("ETag"))
+	}
+
+	// The category has changed since version 1.
+	req, _ = http.NewRequest(http.MethodPut, serverURL+"/api/category/1", bytes.NewReader(categoryBytes))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("UpdateCategory Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("UpdateCategory Error: %v", resp.Status)
+	}
 }
 
 func TestDeleteCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
+
+	token := loginAuthor()
 
 	category := model.Category{
 		Name: "test",
@@ -229,7 +261,7 @@ func TestDeleteCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/category", "application/json", bytes.NewReader(categoryBytes))
+	resp, err := postWithToken(serverURL+"/api/category", token, bytes.NewReader(categoryBytes))
 	if err != nil {
 		t.Fatalf("CreateCategory Error: %v", err)
 	}
@@ -237,10 +269,20 @@ func TestDeleteCategory(t *testing.T) {
 		t.Fatalf("CreateCategory Error: %v", resp.Status)
 	}
 
-	req, err := http.NewRequest(http.MethodDelete, "http://localhost"+config.GetServerConfig().Port+"/api/category/1", nil)
+	// Only admins can delete categories.
+	resp, err = requestWithToken(http.MethodDelete, serverURL+"/api/category/1", loginReader(), nil)
+	if err != nil {
+		t.Fatalf("DeleteCategory Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("DeleteCategory Error: %v", resp.Status)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, serverURL+"/api/category/1", nil)
 	if err != nil {
 		t.Fatalf("DeleteCategory Error: %v", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
@@ -259,7 +301,7 @@ func TestDeleteCategory(t *testing.T) {
 		t.Fatalf("DeleteCategory Error: %v", respData.Message)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/category/1")
+	resp, err = http.Get(serverURL + "/api/category/1")
 	if err != nil {
 		t.Fatalf("GetCategory Error: %v", err)
 	}
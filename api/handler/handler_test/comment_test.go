@@ -4,48 +4,55 @@ import (
 	"blog-go/config"
 	"blog-go/internal/db"
 	"blog-go/internal/model"
-	"blog-go/routes"
 	"blog-go/utils"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"testing"
 )
 
 func TestCreateComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
-	comment := model.Comment{
-		Content: "testComment",
-		Article: &article,
-		User:    &user,
+	comment := commentBody{
+		ArticleID: 1,
+		Content:   "testComment",
 	}
 	commentBytes, err := json.Marshal(comment)
 	if err != nil {
 		t.Fatalf("CreateComment Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+	// Comments are written by logged in users.
+	resp, err := http.Post(serverURL+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+	if err != nil {
+		t.Fatalf("CreateComment Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("CreateComment Error: %v", resp.Status)
+	}
+
+	resp, err = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 	if err != nil {
 		t.Fatalf("CreateComment Error: %v", err)
 	}
@@ -61,40 +68,56 @@ func TestCreateComment(t *testing.T) {
 	if respData.Status != utils.Success {
 		t.Fatalf("CreateComment Error: %v", respData.Message)
 	}
+
+	comment.Content = strings.Repeat("a", 501)
+	commentBytes, _ = json.Marshal(comment)
+	resp, err = postWithToken(serverURL+"/api/comment?lang=zh-CN", token, bytes.NewReader(commentBytes))
+	if err != nil {
+		t.Fatalf("CreateComment Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("CreateComment Error: %v", resp.Status)
+	}
+	respData = utils.Response{}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("CreateComment Error: %v", err)
+	}
+	if len(respData.Errors) != 1 || respData.Errors[0].Rule != "max" || respData.Errors[0].Message != "content 的长度不能超过 500 个字符" {
+		t.Fatalf("CreateComment Error: %v", respData.Errors)
+	}
 }
 
 func TestGetComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
-	comment := model.Comment{
-		Content: "testComment",
-		Article: &article,
-		User:    &user,
+	comment := commentBody{
+		ArticleID: 1,
+		Content:   "testComment",
 	}
 	commentBytes, _ := json.Marshal(comment)
 
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+	_, _ = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/comment/1")
+	resp, err := http.Get(serverURL + "/api/comment/1")
 	if err != nil {
 		t.Fatalf("GetComment Error: %v", err)
 	}
@@ -118,42 +141,55 @@ func TestGetComment(t *testing.T) {
 	if commentData["content"] != comment.Content {
 		t.Fatalf("GetComment Error: %v", respData.Message)
 	}
+	commentUser, ok := commentData["user"].(map[string]interface{})
+	if !ok || commentUser["username"] != user.Username {
+		t.Fatalf("GetComment Error: %v", commentData)
+	}
+	if _, ok := commentUser["email"]; ok {
+		t.Fatalf("GetComment Error: %v", "email is returned")
+	}
+
+	resp, err = http.Get(serverURL + "/api/comment/2")
+	if err != nil {
+		t.Fatalf("GetComment Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GetComment Error: %v", resp.Status)
+	}
 }
 
 func TestGetCommentList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
 	for i := 0; i < 10; i++ {
-		comment := model.Comment{
-			Content: "testComment" + strconv.Itoa(i),
-			Article: &article,
-			User:    &user,
+		comment := commentBody{
+			ArticleID: 1,
+			Content:   "testComment" + strconv.Itoa(i),
 		}
 		commentBytes, _ := json.Marshal(comment)
 
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+		_, _ = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/comments?page_num=4&page_size=3")
+	resp, err := http.Get(serverURL + "/api/comments?page_num=4&page_size=3")
 	if err != nil {
 		t.Fatalf("GetComment Error: %v", err)
 	}
@@ -170,7 +206,7 @@ func TestGetCommentList(t *testing.T) {
 		t.Fatalf("GetComment Error: %v", respData.Message)
 	}
 
-	commentData, ok := respData.Data.([]interface{})
+	commentData, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetComment Error: %v", respData.Message)
 	}
@@ -180,39 +216,37 @@ func TestGetCommentList(t *testing.T) {
 }
 
 func TestGetCommentListByArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
 	for i := 0; i < 10; i++ {
-		comment := model.Comment{
-			Content: "testComment" + strconv.Itoa(i),
-			Article: &article,
-			User:    &user,
+		comment := commentBody{
+			ArticleID: 1,
+			Content:   "testComment" + strconv.Itoa(i),
 		}
 		commentBytes, _ := json.Marshal(comment)
 
-		_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+		_, _ = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/comments/article/1?page_num=4&page_size=3")
+	resp, err := http.Get(serverURL + "/api/comments/article/1?page_num=4&page_size=3")
 	if err != nil {
 		t.Fatalf("GetComment Error: %v", err)
 	}
@@ -229,7 +263,7 @@ func TestGetCommentListByArticle(t *testing.T) {
 		t.Fatalf("GetComment Error: %v", respData.Message)
 	}
 
-	commentData, ok := respData.Data.([]interface{})
+	commentData, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetComment Error: %v", respData.Message)
 	}
@@ -239,49 +273,44 @@ func TestGetCommentListByArticle(t *testing.T) {
 }
 
 func TestUpdateComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
-	comment := model.Comment{
-		Content: "testComment",
-		Article: &article,
-		User:    &user,
+	comment := commentBody{
+		ArticleID: 1,
+		Content:   "testComment",
 	}
 	commentBytes, _ := json.Marshal(comment)
 
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
+	_, _ = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 
-	resp, _ := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
 	var respData utils.Response
-	_ = json.NewDecoder(resp.Body).Decode(&respData)
-	token, _ := respData.Data.(string)
 
 	comment.Content = "testCommentUpdate"
 	commentBytes, _ = json.Marshal(comment)
-	req, err := http.NewRequest(http.MethodPut, "http://localhost"+config.GetServerConfig().Port+"/api/comment/1", bytes.NewReader(commentBytes))
+	req, err := http.NewRequest(http.MethodPut, serverURL+"/api/comment/1", bytes.NewReader(commentBytes))
 	if err != nil {
 		t.Fatalf("UpdateComment Error: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("UpdateComment Error: %v", err)
 	}
@@ -289,7 +318,7 @@ func TestUpdateComment(t *testing.T) {
 		t.Fatalf("UpdateComment Error: %v", resp.Status)
 	}
 
-	resp, _ = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/comment/1")
+	resp, _ = http.Get(serverURL + "/api/comment/1")
 	_ = json.NewDecoder(resp.Body).Decode(&respData)
 
 	commentData, _ := respData.Data.(map[string]interface{})
@@ -299,47 +328,40 @@ func TestUpdateComment(t *testing.T) {
 }
 
 func TestDeleteComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
-	user.ID = 1
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
 
 	article := model.Article{
 		Title:   "test",
 		Content: "test",
 	}
 	articleBytes, _ := json.Marshal(article)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/article", "application/json", bytes.NewReader(articleBytes))
+	_, _ = postWithToken(serverURL+"/api/article", token, bytes.NewReader(articleBytes))
 	article.ID = 1
 
-	comment := model.Comment{
-		Content: "testComment",
-		Article: &article,
-		User:    &user,
+	comment := commentBody{
+		ArticleID: 1,
+		Content:   "testComment",
 	}
 	commentBytes, _ := json.Marshal(comment)
 
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/comment", "application/json", bytes.NewReader(commentBytes))
-
-	resp, _ := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
-	var respData utils.Response
-	_ = json.NewDecoder(resp.Body).Decode(&respData)
-	token, _ := respData.Data.(string)
+	_, _ = postWithToken(serverURL+"/api/comment", token, bytes.NewReader(commentBytes))
 
-	req, err := http.NewRequest(http.MethodDelete, "http://localhost"+config.GetServerConfig().Port+"/api/comment/1", nil)
+	req, err := http.NewRequest(http.MethodDelete, serverURL+"/api/comment/1", nil)
 	if err != nil {
 		t.Fatalf("DeleteComment Error: %v", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("DeleteComment Error: %v", err)
 	}
@@ -347,7 +369,7 @@ func TestDeleteComment(t *testing.T) {
 		t.Fatalf("DeleteComment Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/comment/1")
+	resp, err = http.Get(serverURL + "/api/comment/1")
 	if err != nil {
 		t.Fatalf("GetComment Error: %v", err)
 	}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"blog-go/api/handler"
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/repository"
+	"blog-go/routes"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// serverURL is the URL of the server that all tests share.
+var serverURL string
+
+// TestMain starts the server once for all tests, every test then resets the database.
+func TestMain(m *testing.M) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	server := httptest.NewServer(routes.NewRouter(handler.NewApp(repository.NewGormRepositories(db.DB))))
+	serverURL = server.URL
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// userBody is the body of the sign up and login endpoints.
+type userBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// articleBody is the body of the article endpoints.
+type articleBody struct {
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	CategoryIDs []uint `json:"category_ids"`
+}
+
+// commentBody is the body of the comment endpoints.
+type commentBody struct {
+	ArticleID uint   `json:"article_id"`
+	Content   string `json:"content"`
+}
+
+// login logs in with the user and returns the token.
+func login(userBytes []byte) string {
+	resp, err := http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	if err != nil {
+		return ""
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	token, _ := respData.Data.(string)
+	return token
+}
+
+// loginAuthor creates an author and returns its token.
+func loginAuthor() string {
+	author := userBody{
+		Username: "TestAuthor",
+		Password: "TestPassword",
+		Email:    "author@email.com",
+	}
+	authorBytes, _ := json.Marshal(author)
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(authorBytes))
+	return login(authorBytes)
+}
+
+// loginReader creates a user that is not an admin and returns its token. It must be called after loginAuthor.
+func loginReader() string {
+	reader := userBody{
+		Username: "TestReader",
+		Password: "TestPassword",
+		Email:    "reader@email.com",
+	}
+	readerBytes, _ := json.Marshal(reader)
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(readerBytes))
+	return login(readerBytes)
+}
+
+// postWithToken posts the JSON body with the token.
+func postWithToken(url, token string, body io.Reader) (*http.Response, error) {
+	return requestWithToken(http.MethodPost, url, token, body)
+}
+
+// patchWithToken sends the JSON Merge Patch with the token, and with the If-Match header unless it is empty.
+func patchWithToken(url, token, ifMatch string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPatch, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", utils.MergePatchContentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// requestWithToken sends the JSON body with the token.
+func requestWithToken(method, url, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
+
+// listItems returns the items of a list response.
+func listItems(data interface{}) ([]interface{}, bool) {
+	list, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	items, ok := list["items"].([]interface{})
+	return items, ok
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/internal/oauth"
+	"blog-go/internal/oauth/oauthtest"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+)
+
+// registerMockProvider starts a mock provider with the claims and registers it as "mock".
+func registerMockProvider(claims map[string]interface{}) *oauthtest.Provider {
+	mock := oauthtest.NewProvider(claims)
+	oauth.Register("mock", config.OAuthProviderConfig{
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  serverURL + "/api/oauth/mock/callback",
+		Issuer:       mock.URL,
+	})
+	return mock
+}
+
+// browser returns a client that keeps cookies like a browser, which the state cookie needs.
+func browser() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+func TestOAuthLogin(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+
+	mock := registerMockProvider(map[string]interface{}{
+		"sub":                "subject-1",
+		"email":              "test@email.com",
+		"preferred_username": "tester",
+	})
+	defer mock.Close()
+
+	// The client follows the redirects to the mock provider and back to the callback
+	for i := 0; i < 2; i++ {
+		resp, err := browser().Get(baseURL + "/api/oauth/mock/login")
+		if err != nil {
+			t.Fatalf("OAuthLogin Error: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("OAuthLogin Error: %v", resp.Status)
+		}
+
+		var respData utils.Response
+		_ = json.NewDecoder(resp.Body).Decode(&respData)
+		if token, ok := respData.Data.(string); !ok || token == "" {
+			t.Fatalf("OAuthLogin Error: %v", respData.Message)
+		}
+	}
+
+	// Both logins use the same user
+	resp, _ := http.Get(baseURL + "/api/users")
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	users, ok := listItems(respData.Data)
+	if !ok || len(users) != 1 {
+		t.Fatalf("OAuthLogin Error: %v", "Data error")
+	}
+	if users[0].(map[string]interface{})["username"] != "tester" {
+		t.Fatalf("OAuthLogin Error: %v", "Data error")
+	}
+
+	// The first user with an external account is not the admin, the first password sign up is
+	adminToken := loginAuthor()
+	resp, _ = requestWithToken(http.MethodGet, baseURL+"/api/admin/users?sort=created_at", adminToken, nil)
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	users, ok = listItems(respData.Data)
+	if !ok || len(users) != 2 || users[0].(map[string]interface{})["role"] != model.RoleUser ||
+		users[1].(map[string]interface{})["role"] != model.RoleAdmin {
+		t.Fatalf("OAuthLogin Error: %v", respData.Data)
+	}
+
+	// A callback in another browser than the one that started the login is rejected
+	resp, _ = http.Get(baseURL + "/api/oauth/mock/login")
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorOAuthStateWrong {
+		t.Fatalf("OAuthLogin Error: %v", respData.Message)
+	}
+
+	resp, _ = http.Get(baseURL + "/api/oauth/unknown/login")
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("OAuthLogin Error: %v", resp.Status)
+	}
+}
+
+func TestLinkUserIdentity(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+
+	mock := registerMockProvider(map[string]interface{}{
+		"sub":                "subject-1",
+		"email":              "other@email.com",
+		"preferred_username": "tester",
+	})
+	defer mock.Close()
+
+	user := userBody{
+		Username: "TestUsername",
+		Password: "TestPassword",
+		Email:    "Test@email.com",
+	}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+	token := login(userBytes)
+
+	// Linking needs a login
+	linkBytes, _ := json.Marshal(map[string]string{"provider": "mock"})
+	resp, _ := http.Post(baseURL+"/api/user/1/identities", "application/json", bytes.NewReader(linkBytes))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("LinkUserIdentity Error: %v", resp.Status)
+	}
+
+	client := browser()
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/user/1/identities", bytes.NewReader(linkBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("LinkUserIdentity Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LinkUserIdentity Error: %v", resp.Status)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	linkData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("LinkUserIdentity Error: %v", "Data format error")
+	}
+
+	authURL, _ := linkData["auth_url"].(string)
+	resp, err = client.Get(authURL)
+	if err != nil {
+		t.Fatalf("LinkUserIdentity Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LinkUserIdentity Error: %v", resp.Status)
+	}
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	identity, ok := respData.Data.(map[string]interface{})
+	if !ok || identity["provider"] != "mock" || identity["subject"] != "subject-1" {
+		t.Fatalf("LinkUserIdentity Error: %v", respData.Message)
+	}
+
+	// The provider login now logs in as the user, instead of creating another one
+	resp, _ = browser().Get(baseURL + "/api/oauth/mock/login")
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if token, ok := respData.Data.(string); !ok || token == "" {
+		t.Fatalf("OAuthLogin Error: %v", respData.Message)
+	}
+	resp, _ = http.Get(baseURL + "/api/users")
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if users, ok := listItems(respData.Data); !ok || len(users) != 1 {
+		t.Fatalf("OAuthLogin Error: %v", "Data error")
+	}
+
+	// The account cannot be linked to another user
+	other := userBody{
+		Username: "OtherUser",
+		Password: "TestPassword",
+		Email:    "another@email.com",
+	}
+	otherBytes, _ := json.Marshal(other)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(otherBytes))
+	otherToken := login(otherBytes)
+
+	client = browser()
+	req, _ = http.NewRequest(http.MethodPost, baseURL+"/api/user/2/identities", bytes.NewReader(linkBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	resp, _ = client.Do(req)
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	linkData, _ = respData.Data.(map[string]interface{})
+	authURL, _ = linkData["auth_url"].(string)
+	resp, _ = client.Get(authURL)
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if resp.StatusCode != http.StatusConflict || respData.Status != utils.ErrorIdentityLinked {
+		t.Fatalf("LinkUserIdentity Error: %v", resp.Status)
+	}
+
+	// Nor for another user than the logged in one
+	resp, _ = postWithToken(baseURL+"/api/user/1/identities", otherToken, bytes.NewReader(linkBytes))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("LinkUserIdentity Error: %v", resp.Status)
+	}
+	// Linking and unlinking are audited
+	resp, _ = requestWithToken(http.MethodDelete, baseURL+"/api/user/1/identities/1", token, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DeleteUserIdentity Error: %v", resp.Status)
+	}
+	events := auditEvents(t, token, "filter[resource_type]=identity")
+	if len(events) != 2 || events[0]["action"] != "delete" || events[1]["action"] != "create" || events[1]["actor_id"] != float64(1) {
+		t.Fatalf("DeleteUserIdentity Error: %v", events)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestUserProfile(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+	token := loginAuthor()
+
+	profileBytes, _ := json.Marshal(map[string]interface{}{
+		"display_name": "Test Author",
+		"bio":          "Writes tests",
+		"website":      "https://example.com",
+		"social_links": []map[string]string{{"platform": "github", "url": "https://github.com/example"}},
+	})
+	resp, err := requestWithToken(http.MethodPut, baseURL+"/api/user/1/profile", token, bytes.NewReader(profileBytes))
+	if err != nil {
+		t.Fatalf("UpdateUserProfile Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("UpdateUserProfile Error: %v", resp.Status)
+	}
+
+	// Only http(s) links are accepted
+	badBytes, _ := json.Marshal(map[string]string{"website": "javascript:alert(1)"})
+	resp, _ = requestWithToken(http.MethodPut, baseURL+"/api/user/1/profile", token, bytes.NewReader(badBytes))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("UpdateUserProfile Error: %v", resp.Status)
+	}
+
+	// The public profile does not contain the email
+	resp, err = http.Get(baseURL + "/api/user/1/profile")
+	if err != nil {
+		t.Fatalf("GetUserProfile Error: %v", err)
+	}
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	profileData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("GetUserProfile Error: %v", "Data format error")
+	}
+	if profileData["display_name"] != "Test Author" {
+		t.Fatalf("GetUserProfile Error: %v", "Data error")
+	}
+	if _, ok := profileData["email"]; ok {
+		t.Fatalf("GetUserProfile Error: %v", "email is public")
+	}
+	if links, ok := profileData["social_links"].([]interface{}); !ok || len(links) != 1 {
+		t.Fatalf("GetUserProfile Error: %v", "Data error")
+	}
+
+	// The author page bundles the articles
+	articleBytes, _ := json.Marshal(model.Article{Title: "test", Content: "test"})
+	_, _ = postWithToken(baseURL+"/api/article", token, bytes.NewReader(articleBytes))
+
+	resp, err = http.Get(baseURL + "/api/author/1")
+	if err != nil {
+		t.Fatalf("GetAuthorPage Error: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	pageData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("GetAuthorPage Error: %v", "Data format error")
+	}
+	if pageData["article_count"] != float64(1) || pageData["comment_count"] != float64(0) {
+		t.Fatalf("GetAuthorPage Error: %v", "Data error")
+	}
+	if articles, ok := listItems(pageData["articles"]); !ok || len(articles) != 1 {
+		t.Fatalf("GetAuthorPage Error: %v", "Data error")
+	}
+}
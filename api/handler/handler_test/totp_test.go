@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+
+	user := userBody{
+		Username: "TestUsername",
+		Password: "TestPassword",
+		Email:    "Test@email.com",
+	}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+
+	resp, _ := http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	token, _ := respData.Data.(string)
+
+	// Enroll
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/user/1/totp", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("EnrollTOTP Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("EnrollTOTP Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	enrollData, ok := respData.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("EnrollTOTP Error: %v", "Data format error")
+	}
+	secret, _ := enrollData["secret"].(string)
+
+	// Confirm with a wrong code, then with the current code
+	codeBytes, _ := json.Marshal(map[string]string{"code": "000000"})
+	req, _ = http.NewRequest(http.MethodPost, baseURL+"/api/user/1/totp/confirm", bytes.NewReader(codeBytes))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ = http.DefaultClient.Do(req)
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorTOTPCodeWrong {
+		t.Fatalf("ConfirmTOTP Error: %v", respData.Message)
+	}
+
+	totpCode, _ := utils.GenerateTOTPCode(secret, time.Now())
+	codeBytes, _ = json.Marshal(map[string]string{"code": totpCode})
+	req, _ = http.NewRequest(http.MethodPost, baseURL+"/api/user/1/totp/confirm", bytes.NewReader(codeBytes))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ConfirmTOTP Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	recoveryCodes, ok := respData.Data.([]interface{})
+	if !ok || len(recoveryCodes) == 0 {
+		t.Fatalf("ConfirmTOTP Error: %v", "Data format error")
+	}
+
+	// Password login now returns a pending token that is not accepted as an access token
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	loginData, ok := respData.Data.(map[string]interface{})
+	if !ok || loginData["two_factor_required"] != true {
+		t.Fatalf("Login Error: %v", "Data format error")
+	}
+	pendingToken, _ := loginData["token"].(string)
+
+	req, _ = http.NewRequest(http.MethodGet, baseURL+"/api/user/1/totp", nil)
+	req.Header.Set("Authorization", "Bearer "+pendingToken)
+	resp, _ = http.DefaultClient.Do(req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Login Error: %v", resp.Status)
+	}
+
+	// A recovery code can only be used once
+	loginBytes, _ := json.Marshal(map[string]string{"token": pendingToken, "code": recoveryCodes[0].(string)})
+	resp, err = http.Post(baseURL+"/api/login/2fa", "application/json", bytes.NewReader(loginBytes))
+	if err != nil {
+		t.Fatalf("LoginTwoFactor Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LoginTwoFactor Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if token, ok := respData.Data.(string); !ok || token == "" {
+		t.Fatalf("LoginTwoFactor Error: %v", "Data format error")
+	}
+
+	resp, _ = http.Post(baseURL+"/api/login/2fa", "application/json", bytes.NewReader(loginBytes))
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("LoginTwoFactor Error: %v", resp.Status)
+	}
+
+	// A TOTP code can only be used once as well, also the one that confirmed the enrollment
+	loginBytes, _ = json.Marshal(map[string]string{"token": pendingToken, "code": totpCode})
+	resp, _ = http.Post(baseURL+"/api/login/2fa", "application/json", bytes.NewReader(loginBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorTOTPCodeWrong {
+		t.Fatalf("LoginTwoFactor Error: %v", respData.Message)
+	}
+
+	// The code of the next period is accepted within the clock skew
+	totpCode, _ = utils.GenerateTOTPCode(secret, time.Now().Add(30*time.Second))
+	loginBytes, _ = json.Marshal(map[string]string{"token": pendingToken, "code": totpCode})
+	resp, _ = http.Post(baseURL+"/api/login/2fa", "application/json", bytes.NewReader(loginBytes))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("LoginTwoFactor Error: %v", resp.Status)
+	}
+
+	resp, _ = http.Post(baseURL+"/api/login/2fa", "application/json", bytes.NewReader(loginBytes))
+	respData = utils.Response{}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorTOTPCodeWrong {
+		t.Fatalf("LoginTwoFactor Error: %v", respData.Message)
+	}
+}
@@ -3,8 +3,6 @@ package handler
 import (
 	"blog-go/config"
 	"blog-go/internal/db"
-	"blog-go/internal/model"
-	"blog-go/routes"
 	"blog-go/utils"
 	"bytes"
 	"encoding/json"
@@ -16,19 +14,21 @@ import (
 )
 
 func TestUploadFile(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
+	if config.GetAliyunOSSConfig().AccessKey == "" {
+		t.Skip("Aliyun OSS is not configured")
+	}
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "TestUsername",
 		Password: "TestPassword",
 		Email:    "Test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 
-	resp, _ := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
+	resp, _ := http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
 	var respData utils.Response
 	_ = json.NewDecoder(resp.Body).Decode(&respData)
 	token := respData.Data.(string)
@@ -40,7 +40,7 @@ func TestUploadFile(t *testing.T) {
 	_, _ = io.Copy(part, file)
 	_ = writer.Close()
 
-	req, err := http.NewRequest("POST", "http://localhost"+config.GetServerConfig().Port+"/api/upload", body)
+	req, err := http.NewRequest("POST", serverURL+"/api/upload", body)
 	if err != nil {
 		t.Fatal(err)
 	}
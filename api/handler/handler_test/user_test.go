@@ -3,22 +3,21 @@ package handler
 import (
 	"blog-go/config"
 	"blog-go/internal/db"
-	"blog-go/internal/model"
-	"blog-go/routes"
+	"blog-go/internal/lockout"
 	"blog-go/utils"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"testing"
 )
 
 func TestCreateUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
@@ -29,7 +28,7 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
@@ -48,11 +47,10 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestGetUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
@@ -63,7 +61,7 @@ func TestGetUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
@@ -71,7 +69,7 @@ func TestGetUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/user/1")
+	resp, err = http.Get(serverURL + "/api/user/1")
 	if err != nil {
 		t.Fatalf("GetUser Error: %v", err)
 	}
@@ -95,18 +93,23 @@ func TestGetUser(t *testing.T) {
 	if userData["username"] != user.Username {
 		t.Fatalf("GetUser Error: %v", "Data error")
 	}
-	if userData["email"] != user.Email {
-		t.Fatalf("GetUser Error: %v", "Data error")
+	if _, ok := userData["password"]; ok {
+		t.Fatalf("GetUser Error: %v", "password is returned")
+	}
+	if _, ok := userData["email"]; ok {
+		t.Fatalf("GetUser Error: %v", "email is returned")
+	}
+	if _, ok := userData["role"]; ok {
+		t.Fatalf("GetUser Error: %v", "role is returned")
 	}
 }
 
 func TestGetUserList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
 	for i := 0; i < 10; i++ {
-		user := model.User{
+		user := userBody{
 			Username: "test" + strconv.Itoa(i),
 			Password: "test",
 			Email:    "test" + strconv.Itoa(i) + "@email.com",
@@ -117,7 +120,7 @@ func TestGetUserList(t *testing.T) {
 			t.Fatalf("CreateUser Error: %v", err)
 		}
 
-		resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+		resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 		if err != nil {
 			t.Fatalf("CreateUser Error: %v", err)
 		}
@@ -126,7 +129,7 @@ func TestGetUserList(t *testing.T) {
 		}
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/users?page_size=3&page_num=4")
+	resp, err := http.Get(serverURL + "/api/users?page_size=3&page_num=4")
 	if err != nil {
 		t.Fatalf("GetUserList Error: %v", err)
 	}
@@ -143,22 +146,28 @@ func TestGetUserList(t *testing.T) {
 		t.Fatalf("GetUserList Error: %v", respData.Message)
 	}
 
-	userList, ok := respData.Data.([]interface{})
+	userList, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetUserList Error: %v", "Data format error")
 	}
 	if len(userList) != 1 {
 		t.Fatalf("GetUserList Error: %v", "Data error")
 	}
+	userData, ok := userList[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("GetUserList Error: %v", "Data format error")
+	}
+	if _, ok := userData["email"]; ok {
+		t.Fatalf("GetUserList Error: %v", "email is returned")
+	}
 }
 
 func TestGetUserListByUsername(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
 	for i := 0; i < 10; i++ {
-		user := model.User{
+		user := userBody{
 			Username: "test" + strconv.Itoa(i),
 			Password: "test",
 			Email:    "test" + strconv.Itoa(i) + "@email.com",
@@ -169,7 +178,7 @@ func TestGetUserListByUsername(t *testing.T) {
 			t.Fatalf("CreateUser Error: %v", err)
 		}
 
-		resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+		resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 		if err != nil {
 			t.Fatalf("CreateUser Error: %v", err)
 		}
@@ -178,7 +187,7 @@ func TestGetUserListByUsername(t *testing.T) {
 		}
 	}
 
-	resp, err := http.Get("http://localhost" + config.GetServerConfig().Port + "/api/users/test")
+	resp, err := http.Get(serverURL + "/api/users/test")
 	if err != nil {
 		t.Fatalf("GetUserList Error: %v", err)
 	}
@@ -195,7 +204,7 @@ func TestGetUserListByUsername(t *testing.T) {
 		t.Fatalf("GetUserList Error: %v", respData.Message)
 	}
 
-	userList, ok := respData.Data.([]interface{})
+	userList, ok := listItems(respData.Data)
 	if !ok {
 		t.Fatalf("GetUserList Error: %v", "Data format error")
 	}
@@ -205,11 +214,10 @@ func TestGetUserListByUsername(t *testing.T) {
 }
 
 func TestUpdateUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
@@ -220,7 +228,7 @@ func TestUpdateUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
@@ -228,7 +236,7 @@ func TestUpdateUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", resp.Status)
 	}
 
-	resp, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
+	resp, _ = http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
 	var respData utils.Response
 	_ = json.NewDecoder(resp.Body).Decode(&respData)
 	token, _ := respData.Data.(string)
@@ -236,7 +244,7 @@ func TestUpdateUser(t *testing.T) {
 	user.Email = "test2@email.com"
 	userBytes, _ = json.Marshal(user)
 
-	req, err := http.NewRequest(http.MethodPut, "http://localhost"+config.GetServerConfig().Port+"/api/user/1", bytes.NewReader(userBytes))
+	req, err := http.NewRequest(http.MethodPut, serverURL+"/api/user/1", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("UpdateUser Error: %v", err)
 	}
@@ -249,37 +257,47 @@ func TestUpdateUser(t *testing.T) {
 		t.Fatalf("UpdateUser Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/user/1")
-	if err != nil {
-		t.Fatalf("GetUserList Error: %v", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("GetUserList Error: %v", resp.Status)
-	}
-
+	// The public user has no email, the updated account comes back from the update.
 	err = json.NewDecoder(resp.Body).Decode(&respData)
 	if err != nil {
-		t.Fatalf("GetUserList Error: %v", err)
+		t.Fatalf("UpdateUser Error: %v", err)
 	}
 	if respData.Status != utils.Success {
-		t.Fatalf("GetUserList Error: %v", respData.Message)
+		t.Fatalf("UpdateUser Error: %v", respData.Message)
 	}
 
 	userData, ok := respData.Data.(map[string]interface{})
 	if !ok {
-		t.Fatalf("GetUserList Error: %v", "Data format error")
+		t.Fatalf("UpdateUser Error: %v", "Data format error")
 	}
 	if userData["email"] != user.Email {
-		t.Fatalf("GetUserList Error: %v", "Data error")
+		t.Fatalf("UpdateUser Error: %v", "Data error")
+	}
+
+	// A patch changes only the given fields.
+	resp, err = patchWithToken(serverURL+"/api/user/1", token, `"2"`, strings.NewReader(`{"email":"test3@email.com"}`))
+	if err != nil {
+		t.Fatalf("PatchUser Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PatchUser Error: %v", resp.Status)
+	}
+	respData = utils.Response{}
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		t.Fatalf("PatchUser Error: %v", err)
+	}
+	userData, _ = respData.Data.(map[string]interface{})
+	if userData["email"] != "test3@email.com" || userData["username"] != user.Username {
+		t.Fatalf("PatchUser Error: %v", userData)
 	}
 }
 
 func TestUpdateUserPassword(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
@@ -290,7 +308,7 @@ func TestUpdateUserPassword(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	resp, err := http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
@@ -298,17 +316,17 @@ func TestUpdateUserPassword(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", resp.Status)
 	}
 
-	resp, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
+	resp, _ = http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
 	var respData utils.Response
 	_ = json.NewDecoder(resp.Body).Decode(&respData)
 	token, _ := respData.Data.(string)
 
-	user = model.User{
+	user = userBody{
 		Password: "test2",
 	}
 	userBytes, _ = json.Marshal(user)
 
-	res, err := http.NewRequest(http.MethodPut, "http://localhost"+config.GetServerConfig().Port+"/api/user/1/password", bytes.NewReader(userBytes))
+	res, err := http.NewRequest(http.MethodPut, serverURL+"/api/user/1/password", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("UpdateUser Error: %v", err)
 	}
@@ -320,8 +338,20 @@ func TestUpdateUserPassword(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("UpdateUser Error: %v", resp.Status)
 	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	newToken, _ := respData.Data.(string)
+
+	// The earlier tokens are revoked, the returned one works
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/user/tokens", token, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("UpdateUserPassword Error: %v", resp.Status)
+	}
+	resp, _ = requestWithToken(http.MethodGet, serverURL+"/api/user/tokens", newToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("UpdateUserPassword Error: %v", resp.Status)
+	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/user/1")
+	resp, err = http.Get(serverURL + "/api/user/1")
 	if err != nil {
 		t.Fatalf("GetUserList Error: %v", err)
 	}
@@ -331,11 +361,19 @@ func TestUpdateUserPassword(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	// The first user is the admin, who cannot delete the only admin account
+	adminToken := loginAuthor()
+	resp, _ := requestWithToken(http.MethodDelete, serverURL+"/api/user/1", adminToken, nil)
+	var respData utils.Response
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	if respData.Status != utils.ErrorLastAdmin {
+		t.Fatalf("DeleteUser Error: %v", respData.Message)
+	}
+
+	user := userBody{
 		Username: "test",
 		Password: "test",
 		Email:    "test@email.com",
@@ -346,14 +384,13 @@ func TestDeleteUser(t *testing.T) {
 		t.Fatalf("CreateUser Error: %v", err)
 	}
 
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 
-	resp, _ := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
-	var respData utils.Response
+	resp, _ = http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
 	_ = json.NewDecoder(resp.Body).Decode(&respData)
 	token, _ := respData.Data.(string)
 
-	req, err := http.NewRequest(http.MethodDelete, "http://localhost"+config.GetServerConfig().Port+"/api/user/1", nil)
+	req, err := http.NewRequest(http.MethodDelete, serverURL+"/api/user/2", nil)
 	if err != nil {
 		t.Fatalf("DeleteUser Error: %v", err)
 	}
@@ -366,7 +403,7 @@ func TestDeleteUser(t *testing.T) {
 		t.Fatalf("DeleteUser Error: %v", resp.Status)
 	}
 
-	resp, err = http.Get("http://localhost" + config.GetServerConfig().Port + "/api/user/1")
+	resp, err = http.Get(serverURL + "/api/user/2")
 	if err != nil {
 		t.Fatalf("GetUser Error: %v", err)
 	}
@@ -376,19 +413,18 @@ func TestDeleteUser(t *testing.T) {
 }
 
 func TestLogin(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
-	go routes.InitRouter()
 
-	user := model.User{
+	user := userBody{
 		Username: "TestUsername",
 		Password: "TestPassword",
 		Email:    "Test@email.com",
 	}
 	userBytes, _ := json.Marshal(user)
-	_, _ = http.Post("http://localhost"+config.GetServerConfig().Port+"/api/user", "application/json", bytes.NewReader(userBytes))
+	_, _ = http.Post(serverURL+"/api/user", "application/json", bytes.NewReader(userBytes))
 
-	resp, err := http.Post("http://localhost"+config.GetServerConfig().Port+"/api/login", "application/json", bytes.NewReader(userBytes))
+	resp, err := http.Post(serverURL+"/api/login", "application/json", bytes.NewReader(userBytes))
 	if err != nil {
 		t.Fatalf("Login Error: %v", err)
 	}
@@ -413,3 +449,126 @@ func TestLogin(t *testing.T) {
 		t.Fatalf("Login Error: %v", "Data error")
 	}
 }
+
+func TestLoginLockout(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	baseURL := serverURL
+
+	// The first user is the admin
+	admin := userBody{
+		Username: "TestAdmin",
+		Password: "TestPassword",
+		Email:    "Admin@email.com",
+	}
+	adminBytes, _ := json.Marshal(admin)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(adminBytes))
+
+	user := userBody{
+		Username: "TestUsername",
+		Password: "TestPassword",
+		Email:    "Test@email.com",
+	}
+	userBytes, _ := json.Marshal(user)
+	_, _ = http.Post(baseURL+"/api/user", "application/json", bytes.NewReader(userBytes))
+
+	// Unknown usernames and wrong passwords get the same response
+	var respData utils.Response
+	for _, login := range []loginRequestBody{
+		{Username: "NoSuchUser", Password: "TestPassword"},
+		{Username: "TestUsername", Password: "WrongPassword"},
+	} {
+		loginBytes, _ := json.Marshal(login)
+		resp, _ := http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(loginBytes))
+		_ = json.NewDecoder(resp.Body).Decode(&respData)
+		if respData.Status != utils.ErrorLoginFailed {
+			t.Fatalf("Login Error: %v", respData.Message)
+		}
+	}
+
+	// Usernames longer than the column are rejected before they are counted
+	longBytes, _ := json.Marshal(loginRequestBody{Username: strings.Repeat("x", 200), Password: "WrongPassword"})
+	resp, _ := http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(longBytes))
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Login Error: %v", resp.Status)
+	}
+
+	// Two more failures use up the free attempts, the next one starts the backoff,
+	// then even the right password is rejected
+	wrongBytes, _ := json.Marshal(loginRequestBody{Username: "TestUsername", Password: "WrongPassword"})
+	for i := 0; i < 3; i++ {
+		_, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(wrongBytes))
+	}
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Login Error: %v", resp.Status)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("Login Error: %v", "Retry-After missing")
+	}
+
+	// The admin unlocks the username
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(adminBytes))
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	adminToken, _ := respData.Data.(string)
+
+	unlockBytes, _ := json.Marshal(map[string]string{"username": "TestUsername"})
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/admin/login/unlock", bytes.NewReader(unlockBytes))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("UnlockLogin Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("UnlockLogin Error: %v", resp.Status)
+	}
+
+	resp, _ = http.Post(baseURL+"/api/login", "application/json", bytes.NewReader(userBytes))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Login Error: %v", resp.Status)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&respData)
+	userToken, _ := respData.Data.(string)
+
+	// Only admins can unlock
+	req, _ = http.NewRequest(http.MethodPost, baseURL+"/api/admin/login/unlock", bytes.NewReader(unlockBytes))
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	resp, _ = http.DefaultClient.Do(req)
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("UnlockLogin Error: %v", resp.Status)
+	}
+}
+
+func TestLoginLockoutSpoofedIP(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	// Other tests have failed logins from the same client IP as well.
+	_ = lockout.Unlock("", "127.0.0.1")
+	defer func() { _ = lockout.Unlock("", "127.0.0.1") }()
+
+	// Every attempt guesses another username from another forwarded IP, which is not trusted from the client,
+	// so all of them count against the IP of the connection.
+	ipFreeAttempts := config.GetLoginConfig().IPFreeAttempts
+	for i := 0; i <= ipFreeAttempts+1; i++ {
+		loginBytes, _ := json.Marshal(loginRequestBody{Username: "NoSuchUser" + strconv.Itoa(i), Password: "WrongPassword"})
+		req, _ := http.NewRequest(http.MethodPost, serverURL+"/api/login", bytes.NewReader(loginBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "10.0.0."+strconv.Itoa(i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Login Error: %v", err)
+		}
+		if i <= ipFreeAttempts && resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("Login Error: blocked after %d attempts", i)
+		}
+		if i > ipFreeAttempts && resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("Login Error: %v", resp.Status)
+		}
+	}
+}
+
+type loginRequestBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"blog-go/internal/logging"
+	"blog-go/internal/version"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// checkTimeout limits every readiness check, so that a hanging dependency fails the probe instead of blocking it.
+const checkTimeout = 2 * time.Second
+
+// HealthCheck is a dependency that the readiness probe checks.
+type HealthCheck struct {
+	Name string
+	// Check returns a detail of the dependency, and an error if the app cannot use it.
+	Check func(ctx context.Context) (string, error)
+}
+
+// checkResult is the result of a readiness check. The probe is public, so details and errors are only logged.
+type checkResult struct {
+	Status string `json:"status"`
+}
+
+// readinessResponse is the body of /readyz. Status is "ok" if all checks pass, and "unavailable" otherwise.
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// versionResponse is the build of the running binary.
+type versionResponse struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	BuildTime string    `json:"build_time,omitempty"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// Healthz - Liveness probe
+// @Summary Check that the process is alive
+// @Description Does not check the dependencies, see /readyz.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (a *App) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz - Readiness probe
+// @Summary Check that the dependencies are usable
+// @Description Runs the health checks of the app, such as the database, its migrations and the upload storage. Only the status of every check is returned, the reasons of failures are logged.
+// @Tags health
+// @Produce json
+// @Success 200 {object} readinessResponse
+// @Failure 503 {object} readinessResponse
+// @Router /readyz [get]
+func (a *App) Readyz(c *gin.Context) {
+	resp := readinessResponse{Status: "ok", Checks: make(map[string]checkResult, len(a.HealthChecks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range a.HealthChecks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := runCheck(c.Request.Context(), check)
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[check.Name] = result
+			if result.Status != "ok" {
+				resp.Status = "unavailable"
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+// GetVersion - Build information
+// @Summary Get the version of the server
+// @Tags health
+// @Produce json
+// @Success 200 {object} versionResponse
+// @Router /version [get]
+func (a *App) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, versionResponse{
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildTime: version.BuildTime,
+		StartTime: version.StartTime,
+	})
+}
+
+// runCheck runs a readiness check with checkTimeout, and logs why it failed.
+func runCheck(ctx context.Context, check HealthCheck) checkResult {
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check.Check(checkCtx)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{
+			"check":       check.Name,
+			"detail":      detail,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).WithError(err).Warn("Readiness check failed")
+		return checkResult{Status: "failed"}
+	}
+	return checkResult{Status: "ok"}
+}
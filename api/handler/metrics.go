@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"blog-go/internal/metrics"
+	"blog-go/internal/repository"
+)
+
+// Gauges returns the business gauges of the app, which count the content when they are read. Articles are published
+// when they are created, and comments need no approval, so all of them are counted.
+func (a *App) Gauges() []metrics.Gauge {
+	// An empty page with the total counts all items without loading them.
+	count := repository.Page{Size: 0, Num: 1, Total: true}
+	return []metrics.Gauge{
+		{Name: "articles", Help: "Published articles.", Value: func() (float64, error) {
+			list, err := a.Articles.GetArticleList(repository.Query{}, count)
+			if err != nil {
+				return 0, err
+			}
+			return float64(*list.Total), nil
+		}},
+		{Name: "comments", Help: "Comments on the articles.", Value: func() (float64, error) {
+			list, err := a.Comments.GetCommentList(repository.Query{}, count)
+			if err != nil {
+				return 0, err
+			}
+			return float64(*list.Total), nil
+		}},
+	}
+}
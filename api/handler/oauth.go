@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"blog-go/internal/model"
+	"blog-go/internal/oauth"
+	"blog-go/internal/repository"
+	"blog-go/middleware"
+	"blog-go/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// identityResponse is a provider account linked to a user.
+type identityResponse struct {
+	ID        uint      `json:"id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// identityLinkRequest is the body of the link endpoint.
+type identityLinkRequest struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+// identityLinkResponse is where the user agent continues a link, at the provider.
+type identityLinkResponse struct {
+	AuthURL string `json:"auth_url"`
+}
+
+// OAuthLogin - Redirects to an OAuth2 / OpenID Connect provider
+// @Summary Login with a provider
+// @Tags auth
+// @Param provider path string true "Provider Name"
+// @Success 302
+// @Router /api/v1/oauth/{provider}/login [get]
+func (a *App) OAuthLogin(c *gin.Context) {
+	provider, err := oauth.GetProvider(c.Param("provider"))
+	if err != nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthProviderNotExist))
+		return
+	}
+
+	authURL, cookie, err := provider.AuthCodeURL(0)
+	if err != nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthExchange))
+		return
+	}
+
+	setStateCookie(c, provider, cookie, oauth.CookieMaxAge())
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OAuthCallback - Finishes a provider login and returns a token
+// @Summary Provider login callback
+// @Description Creates a user on the first login. Redirects to the configured success URL with the token in the fragment, or returns it as JSON.
+// @Description Logins started by /api/v1/user/{id}/identities link the account instead, and redirect with linked={provider} in the fragment or return the linked account.
+// @Description The state has to match the state cookie set by the start of the login.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider Name"
+// @Param code query string true "Authorization Code"
+// @Param state query string true "State"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/oauth/{provider}/callback [get]
+func (a *App) OAuthCallback(c *gin.Context) {
+	provider, err := oauth.GetProvider(c.Param("provider"))
+	if err != nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthProviderNotExist))
+		return
+	}
+
+	if c.Query("error") != "" {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthExchange))
+		return
+	}
+
+	// The cookie is only good for one callback.
+	cookie, _ := c.Cookie(oauth.StateCookie)
+	setStateCookie(c, provider, "", -1)
+
+	login, err := provider.Exchange(c.Query("code"), c.Query("state"), cookie)
+	if err != nil {
+		if errors.Is(err, oauth.ErrStateWrong) {
+			utils.ResponseError(c, utils.NewError(utils.ErrorOAuthStateWrong))
+			return
+		}
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthExchange))
+		return
+	}
+	if login.LinkUserID != 0 {
+		a.linkIdentity(c, provider, login)
+		return
+	}
+
+	var userID int
+	linked, err := a.with(c).Identities.GetUserIdentity(login.Provider, login.Subject)
+	switch {
+	case err == nil:
+		userID = int(linked.UserID)
+	case utils.IsCode(err, utils.ErrorIdentityNotExist):
+		userID, err = a.createOAuthUser(c, &login.Identity)
+		if err != nil {
+			utils.ResponseError(c, err)
+			return
+		}
+	default:
+		utils.ResponseError(c, err)
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserStatus(userID)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if user.Disabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorUserDisabled))
+		return
+	}
+
+	successURL := provider.Config.SuccessRedirectURL
+	if user.TOTPEnabled {
+		token, err := middleware.GenerateTwoFactorToken(user.ID, user.Username, user.TokenVersion)
+		if err != nil {
+			utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+			return
+		}
+		if successURL != "" {
+			c.Redirect(http.StatusFound, successURL+"#two_factor_token="+url.QueryEscape(token))
+			return
+		}
+		utils.ResponseSuccess(c, twoFactorLoginResponse{TwoFactorRequired: true, Token: token})
+		return
+	}
+
+	result, err := completeLogin(user)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if successURL != "" {
+		switch result := result.(type) {
+		case passwordResetLoginResponse:
+			c.Redirect(http.StatusFound, successURL+"#password_reset_token="+url.QueryEscape(result.Token))
+		case string:
+			c.Redirect(http.StatusFound, successURL+"#token="+url.QueryEscape(result))
+		}
+		return
+	}
+	utils.ResponseSuccess(c, result)
+}
+
+// GetUserIdentityList - Gets the provider accounts linked to a user
+// @Summary List linked accounts
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response{data=[]identityResponse}
+// @Router /api/v1/user/{id}/identities [get]
+func (a *App) GetUserIdentityList(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	identities, err := a.with(c).Identities.GetUserIdentityList(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	list := make([]identityResponse, 0, len(identities))
+	for i := range identities {
+		list = append(list, newIdentityResponse(&identities[i]))
+	}
+	utils.ResponseSuccess(c, list)
+}
+
+// LinkUserIdentity - Starts linking a provider account to the logged in user
+// @Summary Link an account
+// @Description Returns the URL of the provider, which the user agent opens to log in there. The provider redirects back to the callback, which links the account.
+// @Description The response sets the state cookie, which the user agent has to bring to the callback.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param identity body identityLinkRequest true "Provider"
+// @Success 200 {object} utils.Response{data=identityLinkResponse}
+// @Router /api/v1/user/{id}/identities [post]
+func (a *App) LinkUserIdentity(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	var data identityLinkRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	provider, err := oauth.GetProvider(data.Provider)
+	if err != nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthProviderNotExist))
+		return
+	}
+
+	authURL, cookie, err := provider.AuthCodeURL(uint(id))
+	if err != nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorOAuthExchange))
+		return
+	}
+
+	setStateCookie(c, provider, cookie, oauth.CookieMaxAge())
+	utils.ResponseSuccess(c, identityLinkResponse{AuthURL: authURL})
+}
+
+// DeleteUserIdentity - Unlinks a provider account from a user
+// @Summary Unlink an account
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param identity_id path int true "Identity ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/identities/{identity_id} [delete]
+func (a *App) DeleteUserIdentity(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	identityID, err := strconv.Atoi(c.Param("identity_id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	err = a.audited(c, model.AuditDelete, model.AuditIdentity, func(repos repository.Repositories) (auditChange, error) {
+		snapshot := func(repos repository.Repositories, identityID int) (interface{}, error) {
+			return identitySnapshot(repos, id, identityID)
+		}
+		return deleteWith(repos, identityID, snapshot, func() error {
+			return repos.Identities.DeleteUserIdentity(id, identityID)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// linkIdentity finishes a link started by LinkUserIdentity: it links the account to the user who started it, unless
+// another user has it already.
+func (a *App) linkIdentity(c *gin.Context, provider *oauth.Provider, login *oauth.Login) {
+	user, err := a.with(c).Users.GetUserStatus(int(login.LinkUserID))
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if user.Disabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorUserDisabled))
+		return
+	}
+
+	identity, err := a.with(c).Identities.GetUserIdentity(login.Provider, login.Subject)
+	switch {
+	case err == nil:
+		if identity.UserID != user.ID {
+			utils.ResponseError(c, utils.NewError(utils.ErrorIdentityLinked))
+			return
+		}
+	case utils.IsCode(err, utils.ErrorIdentityNotExist):
+		identity = &model.UserIdentity{
+			Provider: login.Provider,
+			Subject:  login.Subject,
+			Email:    login.Email,
+			UserID:   user.ID,
+		}
+		// The signed cookie identifies the user, who is the actor of the event although the callback has no token.
+		c.Set("userID", user.ID)
+		c.Set("username", user.Username)
+		err = a.audited(c, model.AuditCreate, model.AuditIdentity, func(repos repository.Repositories) (auditChange, error) {
+			if err := repos.Identities.CreateUserIdentity(identity); err != nil {
+				return auditChange{}, err
+			}
+			return auditChange{ID: identity.ID, After: newIdentityResponse(identity)}, nil
+		})
+		if err != nil {
+			utils.ResponseError(c, err)
+			return
+		}
+	default:
+		utils.ResponseError(c, err)
+		return
+	}
+
+	if successURL := provider.Config.SuccessRedirectURL; successURL != "" {
+		c.Redirect(http.StatusFound, successURL+"#linked="+url.QueryEscape(provider.Name))
+		return
+	}
+	utils.ResponseSuccess(c, newIdentityResponse(identity))
+}
+
+// setStateCookie sets the state cookie of a login at a provider, or removes it with a negative max age.
+func setStateCookie(c *gin.Context, provider *oauth.Provider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauth.StateCookie, value, maxAge, provider.CookiePath(), "", provider.CookieSecure(), true)
+}
+
+func newIdentityResponse(identity *model.UserIdentity) identityResponse {
+	return identityResponse{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+}
+
+// createOAuthUser creates a user for an external account seen for the first time, and links the account to it.
+// Accounts are never linked by email, since not every provider verifies the email addresses it returns.
+func (a *App) createOAuthUser(c *gin.Context, identity *oauth.Identity) (int, error) {
+	username, err := a.uniqueUsername(c, identity.Username, identity.Provider)
+	if err != nil {
+		return 0, err
+	}
+
+	email := identity.Email
+	if email == "" || a.with(c).Users.CheckEmail(-1, email) != nil {
+		// Email is required and unique, so fall back to an address under the reserved .invalid domain.
+		sum := sha256.Sum256([]byte(identity.Subject))
+		email = identity.Provider + "-" + hex.EncodeToString(sum[:8]) + "@oauth.invalid"
+	}
+
+	// The user can only login through the provider until a password is set.
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return 0, utils.WrapError(utils.UnknownErr, err)
+	}
+	password, err := encryptUserPassword(hex.EncodeToString(random))
+	if err != nil {
+		return 0, utils.WrapError(utils.UnknownErr, err)
+	}
+
+	// Only a sign up with a password makes the first admin, so that the first visitor with an external account
+	// does not take over the blog.
+	user := model.User{
+		Username: username,
+		Email:    email,
+		Password: password,
+		Role:     model.RoleUser,
+	}
+	err = a.audited(c, model.AuditCreate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Users.CreateUser(&user); err != nil {
+			return auditChange{}, err
+		}
+		err := repos.Identities.CreateUserIdentity(&model.UserIdentity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			UserID:   user.ID,
+		})
+		if err != nil {
+			return auditChange{}, err
+		}
+		after, err := userSnapshot(repos, int(user.ID))
+		return auditChange{ID: user.ID, After: after}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(user.ID), nil
+}
+
+// uniqueUsername derives an unused username from the provider username.
+func (a *App) uniqueUsername(c *gin.Context, preferred, provider string) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(preferred, "")
+	if len(base) < 4 {
+		base = usernameInvalidChars.ReplaceAllString(provider, "") + "_user"
+	}
+	if len(base) > 12 {
+		base = base[:12]
+	}
+
+	candidate := base
+	for i := 1; i <= 100; i++ {
+		err := a.with(c).Users.CheckUsername(-1, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !utils.IsCode(err, utils.ErrorUsernameUsed) {
+			return "", err
+		}
+
+		suffix := fmt.Sprint(i)
+		if len(base)+len(suffix) > 12 {
+			candidate = base[:12-len(suffix)] + suffix
+		} else {
+			candidate = base + suffix
+		}
+	}
+	return "", utils.NewError(utils.ErrorUsernameUsed)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 10
+	// maxPageSize caps the page_size of all lists.
+	maxPageSize = 100
+)
+
+// listResponse is a page of a list. Clients get the next page by passing next_cursor as the cursor parameter,
+// which is set if has_more is true.
+type listResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// bindPage reads the page of a list request from the query: page_size, which is capped at maxPageSize, and either
+// cursor for keyset pagination or page_num for offset pagination, which older clients use. With with_total=true
+// the list also counts all items. It returns the page and an error.
+func bindPage(c *gin.Context) (repository.Page, error) {
+	page := repository.Page{Size: defaultPageSize, Num: 1}
+	var err error
+	if size := c.Query("page_size"); size != "" {
+		if page.Size, err = strconv.Atoi(size); err != nil || page.Size < 1 {
+			return page, utils.NewError(utils.ErrorInvalidParam)
+		}
+	}
+	if page.Size > maxPageSize {
+		page.Size = maxPageSize
+	}
+	if num := c.Query("page_num"); num != "" {
+		if page.Num, err = strconv.Atoi(num); err != nil || page.Num < 1 {
+			return page, utils.NewError(utils.ErrorInvalidParam)
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if page.After, err = repository.ParseCursor(cursor); err != nil {
+			return page, err
+		}
+	}
+	if total := c.Query("with_total"); total != "" {
+		if page.Total, err = strconv.ParseBool(total); err != nil {
+			return page, utils.NewError(utils.ErrorInvalidParam)
+		}
+	}
+	return page, nil
+}
+
+// newListResponse maps a page of a list with the mapping function of its items.
+func newListResponse[M, T any](list *repository.List[M], items func([]M) []T) listResponse[T] {
+	resp := listResponse[T]{Items: items(list.Items), Total: list.Total}
+	if list.Next != nil {
+		resp.NextCursor = list.Next.String()
+		resp.HasMore = true
+	}
+	return resp
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"blog-go/utils"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// etag returns the entity tag of a resource version.
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// setETag sets the ETag header of a response to the version of the resource.
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", etag(version))
+}
+
+// checkIfMatch returns ErrorVersionConflict if the If-Match header of a request matches neither * nor the version
+// of the resource. Requests without the header are not checked.
+func checkIfMatch(c *gin.Context, version uint) error {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return nil
+		}
+	}
+	return utils.NewError(utils.ErrorVersionConflict)
+}
+
+// bindMergePatch applies the JSON Merge Patch in the request body to the current state of a resource, given as
+// its request type, and binds the result to obj, which is validated like a request body.
+func bindMergePatch(c *gin.Context, current, obj interface{}) error {
+	if contentType := c.ContentType(); contentType != utils.MergePatchContentType && contentType != binding.MIMEJSON {
+		return utils.NewError(utils.ErrorUnsupportedMedia)
+	}
+	patch, err := c.GetRawData()
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	patched, err := utils.MergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patched, obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
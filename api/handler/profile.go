@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type socialLink struct {
+	Platform string `json:"platform" validate:"required,max=30"`
+	URL      string `json:"url" validate:"required,max=255"`
+}
+
+type profileRequest struct {
+	DisplayName string       `json:"display_name" validate:"max=50"`
+	Bio         string       `json:"bio" validate:"max=500"`
+	AvatarURL   string       `json:"avatar_url" validate:"max=255"`
+	Website     string       `json:"website" validate:"max=255"`
+	SocialLinks []socialLink `json:"social_links" validate:"max=10,dive"`
+}
+
+// userProfile is the public part of a user. It never contains the email or account settings.
+type userProfile struct {
+	ID          uint         `json:"id"`
+	Username    string       `json:"username"`
+	DisplayName string       `json:"display_name"`
+	Bio         string       `json:"bio"`
+	AvatarURL   string       `json:"avatar_url"`
+	Website     string       `json:"website"`
+	SocialLinks []socialLink `json:"social_links"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type authorPage struct {
+	Profile      userProfile                   `json:"profile"`
+	Articles     listResponse[articleResponse] `json:"articles"`
+	ArticleCount int64                         `json:"article_count"`
+	CommentCount int64                         `json:"comment_count"`
+}
+
+// GetUserProfile - Gets the public profile of a user
+// @Summary Get a user's profile
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/profile [get]
+func (a *App) GetUserProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserProfile(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, newUserProfile(user))
+}
+
+// UpdateUserProfile - Updates the profile of the logged in user
+// @Summary Update a user's profile
+// @Description Replaces the whole profile, including the social links. The avatar is a URL, for example from /api/v1/upload.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param profile body profileRequest true "Profile"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/profile [put]
+func (a *App) UpdateUserProfile(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	var data profileRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+	if !isProfileURL(data.AvatarURL) || !isProfileURL(data.Website) {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+
+	profile := model.User{
+		DisplayName: data.DisplayName,
+		Bio:         data.Bio,
+		AvatarURL:   data.AvatarURL,
+		Website:     data.Website,
+	}
+	for _, link := range data.SocialLinks {
+		if !isProfileURL(link.URL) {
+			utils.ResponseInvalidParam(c)
+			return
+		}
+		profile.SocialLinks = append(profile.SocialLinks, &model.SocialLink{Platform: link.Platform, URL: link.URL})
+	}
+
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, profileSnapshot, func() error {
+			return repos.Users.UpdateUserProfile(id, &profile)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// GetAuthorPage - Gets the public profile of an author with their articles
+// @Summary Get an author page
+// @Description The comment count is the number of comments the author has written.
+// @Description The articles take the filters and sorts of the article list.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page_size query int false "Page Size"
+// @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/author/{id} [get]
+func (a *App) GetAuthorPage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return
+	}
+	page, err := bindPage(c)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	query, err := bindQuery(c, repository.ArticleSchema)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	query.Filters = append(query.Filters, repository.Filter{Field: "user_id", Op: repository.OpEq, Value: int64(id)})
+
+	user, err := a.with(c).Users.GetUserProfile(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	articles, err := a.with(c).Articles.GetArticleList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	author := authorPage{Profile: newUserProfile(user), Articles: newListResponse(articles, newArticleList)}
+	author.ArticleCount, err = a.with(c).Articles.CountArticlesByUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	author.CommentCount, err = a.with(c).Comments.CountCommentsByUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, author)
+}
+
+func newUserProfile(user *model.User) userProfile {
+	profile := userProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		Website:     user.Website,
+		SocialLinks: make([]socialLink, 0, len(user.SocialLinks)),
+		CreatedAt:   user.CreatedAt,
+	}
+	for _, link := range user.SocialLinks {
+		profile.SocialLinks = append(profile.SocialLinks, socialLink{Platform: link.Platform, URL: link.URL})
+	}
+	return profile
+}
+
+// isProfileURL accepts an empty value or an absolute http(s) URL, so that profiles cannot link to scripts.
+func isProfileURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	if len(value) > 255 {
+		return false
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
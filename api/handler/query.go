@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindQuery reads the filters and the order of a list request on a schema from the query string. Filters are
+// filter[field]=value for equality and filter[field][op]=value for the other operators, and sort lists fields
+// separated by commas, descending with a leading "-". Fields and operators the schema does not allow fail the
+// request with ErrorInvalidParam and the reasons per parameter. It returns the query and an error.
+func bindQuery[T any](c *gin.Context, schema *repository.Schema[T]) (repository.Query, error) {
+	var query repository.Query
+	var fields []utils.FieldError
+	locale := utils.Locale(c)
+
+	params := c.Request.URL.Query()
+	names := make([]string, 0, len(params))
+	for param := range params {
+		if strings.HasPrefix(param, "filter[") {
+			names = append(names, param)
+		}
+	}
+	sort.Strings(names)
+	for _, param := range names {
+		name, op, ok := parseFilterParam(param)
+		field, known := schema.Fields[name]
+		switch {
+		case !ok || !known:
+			fields = append(fields, paramError(locale, param, name, "filter", ""))
+			continue
+		case !field.Allows(op):
+			fields = append(fields, paramError(locale, param, name, "filter_op", string(op)))
+			continue
+		}
+		for _, raw := range params[param] {
+			value, err := repository.ParseValue(field.Kind, raw)
+			if err != nil {
+				fields = append(fields, paramError(locale, param, name, "value", ""))
+				continue
+			}
+			query.Filters = append(query.Filters, repository.Filter{Field: name, Op: op, Value: value})
+		}
+	}
+
+	if order := c.Query("sort"); order != "" {
+		seen := map[string]bool{}
+		for _, name := range strings.Split(order, ",") {
+			s := repository.Sort{Field: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+			if !schema.Fields[s.Field].Sortable || seen[s.Field] {
+				fields = append(fields, paramError(locale, "sort", s.Field, "sort", ""))
+				continue
+			}
+			seen[s.Field] = true
+			query.Sort = append(query.Sort, s)
+		}
+	}
+
+	if len(fields) > 0 {
+		err := utils.NewError(utils.ErrorInvalidParam)
+		err.Fields = fields
+		return query, err
+	}
+	return query, nil
+}
+
+// parseFilterParam splits a filter parameter into the field and the operator, which is eq if it is left out.
+func parseFilterParam(param string) (string, repository.Op, bool) {
+	rest := strings.TrimPrefix(param, "filter[")
+	name, rest, ok := strings.Cut(rest, "]")
+	if !ok || name == "" {
+		return name, "", false
+	}
+	if rest == "" {
+		return name, repository.OpEq, true
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+		return name, "", false
+	}
+	return name, repository.Op(rest[1 : len(rest)-1]), true
+}
+
+// paramError creates the reason that a query parameter on a field is invalid.
+func paramError(locale, param, field, rule, value string) utils.FieldError {
+	fieldErr := utils.NewFieldError(locale, field, rule, value)
+	fieldErr.Field = param
+	return fieldErr
+}
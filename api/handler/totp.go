@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"blog-go/internal/lockout"
+	"blog-go/internal/metrics"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
+	"blog-go/middleware"
+	"blog-go/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const totpIssuer = "blog-go"
+
+type totpCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type totpLoginRequest struct {
+	Token string `json:"token" validate:"required"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type totpEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type totpStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type twoFactorLoginResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Token             string `json:"token"`
+}
+
+// GetTOTPStatus - Gets the two-factor status of a user
+// @Summary Get two-factor status
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/totp [get]
+func (a *App) GetTOTPStatus(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserTOTP(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	status := totpStatusResponse{Enabled: user.TOTPEnabled}
+	if user.TOTPEnabled {
+		status.RecoveryCodesLeft, err = a.with(c).Users.CountRecoveryCodes(id)
+		if err != nil {
+			utils.ResponseError(c, err)
+			return
+		}
+	}
+
+	utils.ResponseSuccess(c, status)
+}
+
+// EnrollTOTP - Starts two-factor enrollment by generating a new secret
+// @Summary Start two-factor enrollment
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/totp [post]
+func (a *App) EnrollTOTP(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserTOTP(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorTOTPEnabled))
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	err = a.with(c).Users.SetUserTOTPSecret(id, secret)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, totpEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP - Finishes two-factor enrollment with a code from the authenticator
+// @Summary Confirm two-factor enrollment
+// @Description Returns the recovery codes, which are only shown once.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param code body totpCodeRequest true "TOTP Code"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/totp/confirm [post]
+func (a *App) ConfirmTOTP(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	var data totpCodeRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserTOTP(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorTOTPEnabled))
+		return
+	}
+	if user.TOTPSecret == "" {
+		utils.ResponseError(c, utils.NewError(utils.ErrorTOTPNotEnrolled))
+		return
+	}
+	step, ok := utils.MatchTOTPCode(user.TOTPSecret, data.Code, time.Now())
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.ErrorTOTPCodeWrong))
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	err = a.audited(c, model.AuditTOTPEnable, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Users.UseTOTPStep(id, step); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: uint(id)}, repos.Users.EnableUserTOTP(id, hashes)
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, codes)
+}
+
+// DisableTOTP - Turns off two-factor authentication
+// @Summary Disable two-factor authentication
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param code body totpCodeRequest true "TOTP or Recovery Code"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/totp [delete]
+func (a *App) DisableTOTP(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	var data totpCodeRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	err := a.audited(c, model.AuditTOTPDisable, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		if err := verifySecondFactor(repos, id, data.Code); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: uint(id)}, repos.Users.DisableUserTOTP(id)
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, nil)
+}
+
+// RegenerateRecoveryCodes - Replaces all recovery codes of a user
+// @Summary Regenerate recovery codes
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param code body totpCodeRequest true "TOTP or Recovery Code"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/user/{id}/totp/recovery-codes [post]
+func (a *App) RegenerateRecoveryCodes(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	var data totpCodeRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	err = a.audited(c, model.AuditTOTPRecoveryCodes, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		if err := verifySecondFactor(repos, id, data.Code); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{ID: uint(id)}, repos.Users.ReplaceRecoveryCodes(id, hashes)
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, codes)
+}
+
+// LoginTwoFactor - Exchanges a pending two-factor token and a code for an access token
+// @Summary Finish a two-factor login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param login body totpLoginRequest true "Two-factor Token and Code"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/login/2fa [post]
+func (a *App) LoginTwoFactor(c *gin.Context) {
+	var data totpLoginRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	claims, err := middleware.ParseTwoFactorToken(data.Token)
+	if err != nil {
+		utils.ResponseAuthWrong(c)
+		return
+	}
+
+	// Codes are short, so guessing them is limited like guessing passwords.
+	wait, err := lockout.Reserve(claims.Username, c.ClientIP())
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+	if wait > 0 {
+		metrics.Logins.WithLabelValues("totp", "locked").Inc()
+		utils.ResponseLoginLocked(c, wait)
+		return
+	}
+
+	// The code is only used up if the token is issued.
+	var result interface{}
+	err = a.with(c).Transaction(func(repos repository.Repositories) error {
+		if err := verifySecondFactor(repos, int(claims.UserID), data.Code); err != nil {
+			return err
+		}
+		user, err := repos.Users.GetUserStatus(int(claims.UserID))
+		if err != nil {
+			return err
+		}
+		if user.Disabled {
+			return utils.NewError(utils.ErrorUserDisabled)
+		}
+		if user.TokenVersion != claims.TokenVersion {
+			// The password was changed after the first factor.
+			return utils.NewError(utils.ErrorTokenWrong)
+		}
+		result, err = completeLogin(user)
+		return err
+	})
+	// Only a wrong code keeps the reserved attempt as a failure.
+	if utils.IsCode(err, utils.ErrorTOTPCodeWrong) {
+		metrics.Logins.WithLabelValues("totp", "failure").Inc()
+	} else if err := lockout.Release(claims.Username, c.ClientIP()); err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	metrics.Logins.WithLabelValues("totp", "success").Inc()
+	if err := lockout.Succeed(claims.Username); err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	utils.ResponseSuccess(c, result)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code. Both are used up, so callers
+// run it in the transaction of what the code allows.
+func verifySecondFactor(repos repository.Repositories, userID int, input string) error {
+	user, err := repos.Users.GetUserTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return utils.NewError(utils.ErrorTOTPNotEnabled)
+	}
+	if step, ok := utils.MatchTOTPCode(user.TOTPSecret, input, time.Now()); ok {
+		return repos.Users.UseTOTPStep(userID, step)
+	}
+	return repos.Users.UseRecoveryCode(userID, utils.HashRecoveryCode(input))
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// selfUserID returns the user ID in the path if it belongs to the authenticated user,
+// otherwise it writes the error response.
+func selfUserID(c *gin.Context) (int, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return 0, false
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ResponseInvalidParam(c)
+		return 0, false
+	}
+
+	if uid != uint(id) {
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
+		return 0, false
+	}
+	return id, true
+}
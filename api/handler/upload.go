@@ -1,22 +1,24 @@
 package handler
 
 import (
+	"blog-go/internal/metrics"
 	"blog-go/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UploadFile(c *gin.Context) {
+func (a *App) UploadFile(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		utils.ResponseError(c, utils.ErrorUploadSaveFile)
+		utils.ResponseError(c, utils.WrapError(utils.ErrorUploadSaveFile, err))
 		return
 	}
 
-	url, code := utils.UploadFile(file)
-	if code != utils.Success {
-		utils.ResponseError(c, utils.ErrorUploadSaveFile)
+	url, err := utils.UploadFile(c.Request.Context(), file)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
+	metrics.UploadSize.Observe(float64(file.Size))
 	utils.ResponseSuccess(c, url)
 }
@@ -1,46 +1,89 @@
 package handler
 
 import (
+	"blog-go/internal/lockout"
+	"blog-go/internal/metrics"
 	"blog-go/internal/model"
 	"blog-go/internal/repository"
+	"blog-go/internal/tracing"
 	"blog-go/middleware"
 	"blog-go/utils"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// userRequest is the body of the sign up endpoint.
+type userRequest struct {
+	Username string `json:"username" validate:"required,min=4,max=12"`
+	Password string `json:"password" validate:"required,min=4,max=32"`
+	Email    string `json:"email" validate:"required,email"`
+}
+
+// userUpdateRequest is the body of the user update endpoint. The password has its own endpoint.
+type userUpdateRequest struct {
+	Username string `json:"username" validate:"required,min=4,max=12"`
+	Email    string `json:"email" validate:"required,email"`
+}
+
+// userResponse is the account of a user as the API returns it. It never contains the password.
+type userResponse struct {
+	ID          uint      `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// publicUserResponse is a user as the public routes return it. It never contains the email or the role, which only
+// the user and the admins see.
+type publicUserResponse struct {
+	ID          uint      `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // CreateUser - Creates a user
 // @Summary Create a user
 // @Tags user
 // @Accept json
 // @Produce json
-// @Param user body model.User true "User"
+// @Param user body userRequest true "User"
 // @Success 200 {object} utils.Response
-// @Router /api/user [post]
-func CreateUser(c *gin.Context) {
-	var data model.User
+// @Router /api/v1/user [post]
+func (a *App) CreateUser(c *gin.Context) {
+	var data userRequest
 	err := c.ShouldBindJSON(&data)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
 		return
 	}
 
-	_, err = utils.Validate(&data)
+	password, err := encryptUserPassword(data.Password)
 	if err != nil {
-		utils.ResponseError(c, utils.UnknownErr)
-	}
-
-	data.Password, err = encryptUserPassword(data.Password)
-	if err != nil {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
 		return
 	}
 
-	code := repository.CreateUser(&data)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	user := model.User{
+		Username: data.Username,
+		Password: password,
+		Email:    data.Email,
+	}
+	err = a.audited(c, model.AuditCreate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		if err := repos.Users.CreateUser(&user); err != nil {
+			return auditChange{}, err
+		}
+		after, err := userSnapshot(repos, int(user.ID))
+		return auditChange{ID: user.ID, After: after}, err
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 	utils.ResponseSuccess(c, nil)
@@ -52,112 +95,110 @@ func CreateUser(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} utils.Response
-// @Router /api/user/{id} [get]
-func GetUser(c *gin.Context) {
+// @Success 200 {object} utils.Response{data=publicUserResponse}
+// @Header 200 {string} ETag "User version"
+// @Router /api/v1/user/{id} [get]
+func (a *App) GetUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		utils.ResponseInvalidParam(c)
 		return
 	}
 
-	user, code := repository.GetUser(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	user, err := a.with(c).Users.GetUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, user)
+	setETag(c, user.Version)
+	utils.ResponseSuccess(c, newPublicUserResponse(user))
 }
 
 // GetUserList - Gets a list of users with pagination
 // @Summary List users
+// @Description Filters: username (eq, ne, contains), created_at (gt, gte, lt, lte). Sorts: username, created_at.
+// @Description The users are public, without their email and role.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param page_size query int false "Page Size"
 // @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
 // @Success 200 {object} utils.Response
-// @Router /api/users [get]
-func GetUserList(c *gin.Context) {
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-	if err != nil {
-		utils.ResponseInvalidParam(c)
-		return
-	}
-
-	if pageSize > 100 {
-		pageSize = 100
-	}
-
-	users, code := repository.GetUserList(pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
-		return
-	}
-
-	utils.ResponseSuccess(c, users)
+// @Router /api/v1/users [get]
+func (a *App) GetUserList(c *gin.Context) {
+	a.listUsers(c)
 }
 
 // GetUserListByUsername - Gets a list of users filtered by username with pagination
 // @Summary List users by username
+// @Description Same as /api/v1/users with filter[username][contains]={username}, which newer clients use.
+// @Description Deprecated, see the Deprecation and Sunset headers.
+// @Deprecated
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param username path string true "Username"
 // @Param page_size query int false "Page Size"
 // @Param page_num query int false "Page Number"
+// @Param cursor query string false "Cursor of the next page"
+// @Param with_total query bool false "Count all items"
+// @Param filter query string false "Filters as filter[field]=value or filter[field][op]=value"
+// @Param sort query string false "Fields to sort by, separated by commas, descending with a leading -"
 // @Success 200 {object} utils.Response
-// @Router /api/users/{username} [get]
-func GetUserListByUsername(c *gin.Context) {
-	username := c.Param("username")
-	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+// @Router /api/v1/users/{username} [get]
+func (a *App) GetUserListByUsername(c *gin.Context) {
+	a.listUsers(c, repository.Filter{Field: "username", Op: repository.OpContains, Value: c.Param("username")})
+}
+
+// listUsers renders a page of the users that match the query of the request and the filters.
+func (a *App) listUsers(c *gin.Context, filters ...repository.Filter) {
+	page, err := bindPage(c)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
 		return
 	}
-	pageNum, err := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	query, err := bindQuery(c, repository.UserSchema)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseError(c, err)
 		return
 	}
 
-	if pageSize > 100 {
-		pageSize = 100
-	}
-
-	users, code := repository.GetUserListByUsername(username, pageSize, pageNum)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	query.Filters = append(query.Filters, filters...)
+	users, err := a.with(c).Users.GetUserList(query, page)
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, users)
+	utils.ResponseSuccess(c, newListResponse(users, newPublicUserList))
 }
 
 // UpdateUser - Updates a user by ID
 // @Summary Update a user
+// @Description With If-Match the user is only updated if its ETag matches.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param user body model.User true "User"
-// @Success 200 {object} utils.Response
-// @Router /api/user/{id} [put]
-func UpdateUser(c *gin.Context) {
+// @Param If-Match header string false "ETag of the user"
+// @Param user body userUpdateRequest true "User"
+// @Success 200 {object} utils.Response{data=userResponse}
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/user/{id} [put]
+func (a *App) UpdateUser(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 	userID, ok := userID.(uint)
 	if !ok {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 
@@ -168,44 +209,118 @@ func UpdateUser(c *gin.Context) {
 	}
 
 	if userID != uint(id) {
-		utils.ResponseError(c, utils.ErrorPermissionDenied)
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
 		return
 	}
 
-	var data model.User
+	var data userUpdateRequest
 	err = c.ShouldBindJSON(&data)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
 		return
 	}
 
-	code := repository.UpdateUser(id, &data)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	current, err := a.with(c).Users.GetUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, nil)
+	a.updateUser(c, id, current.Version, &data)
+}
+
+// PatchUser - Partially updates the logged in user
+// @Summary Patch a user
+// @Description The body is a JSON Merge Patch (RFC 7396) of the user. With If-Match the user is only updated if its ETag matches.
+// @Tags user
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag of the user"
+// @Param user body userUpdateRequest true "User Patch"
+// @Success 200 {object} utils.Response{data=userResponse}
+// @Failure 412 {object} utils.Response
+// @Router /api/v1/user/{id} [patch]
+func (a *App) PatchUser(c *gin.Context) {
+	id, ok := selfUserID(c)
+	if !ok {
+		return
+	}
+
+	current, err := a.with(c).Users.GetUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, current.Version); err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	var data userUpdateRequest
+	if err := bindMergePatch(c, userUpdateRequest{Username: current.Username, Email: current.Email}, &data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	a.updateUser(c, id, current.Version, &data)
+}
+
+// updateUser updates the version of a user that the request was checked against, and responds with the updated user.
+func (a *App) updateUser(c *gin.Context, id int, version uint, data *userUpdateRequest) {
+	user := model.User{Username: data.Username, Email: data.Email, Version: version}
+	err := a.audited(c, model.AuditUpdate, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.UpdateUser(id, &user)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	a.responseUser(c, id)
+}
+
+// responseUser responds with a user and its version as the ETag.
+func (a *App) responseUser(c *gin.Context, id int) {
+	user, err := a.with(c).Users.GetUser(id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	utils.ResponseSuccess(c, newUserResponse(user))
+}
+
+type passwordRequest struct {
+	Password string `json:"password" validate:"required,min=4,max=32"`
 }
 
 // UpdateUserPassword - Updates a user's password by ID
 // @Summary Update a user's password
+// @Description The earlier tokens of the user are revoked, the response has a new token.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param password body string true "New Password"
+// @Param password body passwordRequest true "New Password"
 // @Success 200 {object} utils.Response
-// @Router /api/user/{id}/password [put]
-func UpdateUserPassword(c *gin.Context) {
+// @Router /api/v1/user/{id}/password [put]
+func (a *App) UpdateUserPassword(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 	userID, ok := userID.(uint)
 	if !ok {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 
@@ -216,49 +331,60 @@ func UpdateUserPassword(c *gin.Context) {
 	}
 
 	if userID != uint(id) {
-		utils.ResponseError(c, utils.ErrorPermissionDenied)
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
 		return
 	}
 
-	var data model.User
+	var data passwordRequest
 	err = c.ShouldBindJSON(&data)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
 		return
 	}
 
-	data.Password, err = encryptUserPassword(data.Password)
+	password, err := encryptUserPassword(data.Password)
 	if err != nil {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
 		return
 	}
 
-	code := repository.UpdateUserPassword(id, &data)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditPasswordChange, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, id, userSnapshot, func() error {
+			return repos.Users.UpdateUserPassword(id, &model.User{Password: password})
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	utils.ResponseSuccess(c, nil)
+	token, err := newToken(a.with(c).Users, id)
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, token)
 }
 
 // DeleteUser - Deletes a user by ID
 // @Summary Delete a user
+// @Description The last admin cannot be deleted.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Success 200 {object} utils.Response
-// @Router /api/user/{id} [delete]
-func DeleteUser(c *gin.Context) {
+// @Router /api/v1/user/{id} [delete]
+func (a *App) DeleteUser(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 	userID, ok := userID.(uint)
 	if !ok {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseError(c, utils.NewError(utils.UnknownErr))
 		return
 	}
 
@@ -269,19 +395,52 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	if userID != uint(id) {
-		utils.ResponseError(c, utils.ErrorPermissionDenied)
+		utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
 		return
 	}
 
-	code := repository.DeleteUser(id)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	err = a.audited(c, model.AuditDelete, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return deleteWith(repos, id, userSnapshot, func() error {
+			return repos.Users.DeleteUser(id)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
 	utils.ResponseSuccess(c, nil)
 }
 
+func newUserResponse(user *model.User) userResponse {
+	return userResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        user.Role,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLoginAt,
+	}
+}
+
+func newPublicUserResponse(user *model.User) publicUserResponse {
+	return publicUserResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+func newPublicUserList(users []model.User) []publicUserResponse {
+	list := make([]publicUserResponse, 0, len(users))
+	for i := range users {
+		list = append(list, newPublicUserResponse(&users[i]))
+	}
+	return list
+}
+
 func encryptUserPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -290,44 +449,212 @@ func encryptUserPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
 type loginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	// Usernames are at most 20 characters long in the database, new ones at most 12.
+	Username string `json:"username" validate:"required,max=20"`
+	Password string `json:"password" validate:"required"`
 }
 
 // Login - Authenticates a user and returns a token
 // @Summary Login a user
+// @Description Users with two-factor authentication get a pending token instead, to be exchanged at /api/v1/login/2fa.
+// @Description Users who have to reset their password get a reset token, to be exchanged at /api/v1/login/password-reset.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body loginRequest true "Login Information"
 // @Success 200 {object} utils.Response
-// @Router /api/login [post]
-func Login(c *gin.Context) {
+// @Router /api/v1/login [post]
+func (a *App) Login(c *gin.Context) {
 	var loginInfo loginRequest
 	err := c.ShouldBindJSON(&loginInfo)
 	if err != nil {
-		utils.ResponseInvalidParam(c)
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	// The attempt counts as failed until the password is verified, so that parallel guesses are limited too.
+	wait, err := lockout.Reserve(loginInfo.Username, c.ClientIP())
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+	if wait > 0 {
+		metrics.Logins.WithLabelValues("password", "locked").Inc()
+		utils.ResponseLoginLocked(c, wait)
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserWithPasswordByUsername(loginInfo.Username)
+	if err != nil && !utils.IsCode(err, utils.ErrorUserNotExist) {
+		utils.ResponseError(c, err)
 		return
 	}
 
-	user, code := repository.GetUserWithPasswordByUsername(loginInfo.Username)
-	if code != utils.Success {
-		utils.ResponseError(c, code)
+	// Unknown usernames and wrong passwords get the same response after the same bcrypt work,
+	// so that the login cannot be used to find out which usernames exist.
+	hash := dummyPasswordHash
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	// bcrypt is slow on purpose, its span tells it apart from the queries.
+	_, span := tracing.Tracer().Start(c.Request.Context(), "bcrypt.CompareHashAndPassword")
+	err = bcrypt.CompareHashAndPassword(hash, []byte(loginInfo.Password))
+	span.End()
+	if err != nil || user == nil {
+		metrics.Logins.WithLabelValues("password", "failure").Inc()
+		utils.ResponseError(c, utils.NewError(utils.ErrorLoginFailed))
+		return
+	}
+	if err := lockout.Release(loginInfo.Username, c.ClientIP()); err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	if user.Disabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorUserDisabled))
 		return
 	}
+	// The password is right, users with two-factor authentication are counted again with their code.
+	metrics.Logins.WithLabelValues("password", "success").Inc()
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginInfo.Password))
+	if user.TOTPEnabled {
+		token, err := middleware.GenerateTwoFactorToken(user.ID, user.Username, user.TokenVersion)
+		if err != nil {
+			utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+			return
+		}
+		utils.ResponseSuccess(c, twoFactorLoginResponse{TwoFactorRequired: true, Token: token})
+		return
+	}
+
+	// With two-factor authentication the failures are only forgotten after the second factor.
+	if err := lockout.Succeed(user.Username); err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+
+	result, err := completeLogin(user)
 	if err != nil {
-		utils.ResponseError(c, utils.ErrorPasswordWrong)
+		utils.ResponseError(c, err)
 		return
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username)
+	utils.ResponseSuccess(c, result)
+}
+
+type passwordResetLoginRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=4,max=32"`
+}
+
+type passwordResetLoginResponse struct {
+	PasswordResetRequired bool   `json:"password_reset_required"`
+	Token                 string `json:"token"`
+}
+
+// LoginPasswordReset - Exchanges a password reset token and a new password for an access token
+// @Summary Finish a login with a forced password reset
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param login body passwordResetLoginRequest true "Password Reset Token and New Password"
+// @Success 200 {object} utils.Response
+// @Router /api/v1/login/password-reset [post]
+func (a *App) LoginPasswordReset(c *gin.Context) {
+	var data passwordResetLoginRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ResponseBindError(c, err)
+		return
+	}
+
+	claims, err := middleware.ParsePasswordResetToken(data.Token)
 	if err != nil {
-		utils.ResponseError(c, utils.UnknownErr)
+		utils.ResponseAuthWrong(c)
+		return
+	}
+
+	user, err := a.with(c).Users.GetUserWithPasswordByUsername(claims.Username)
+	if utils.IsCode(err, utils.ErrorUserNotExist) || (user != nil && (user.ID != claims.UserID || !user.PasswordResetRequired)) {
+		// The token was already used, or the user is gone.
+		utils.ResponseAuthWrong(c)
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+	if user.Disabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorUserDisabled))
+		return
+	}
+
+	if data.Password == "" {
+		utils.ResponseError(c, utils.NewError(utils.ErrorPasswordEmpty))
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)) == nil {
+		utils.ResponseError(c, utils.NewError(utils.ErrorPasswordUnchanged))
+		return
+	}
+
+	password, err := encryptUserPassword(data.Password)
+	if err != nil {
+		utils.ResponseError(c, utils.WrapError(utils.UnknownErr, err))
+		return
+	}
+	// The reset token identifies the user, who is the actor of the event although not logged in yet.
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	err = a.audited(c, model.AuditPasswordChange, model.AuditUser, func(repos repository.Repositories) (auditChange, error) {
+		return updateWith(repos, int(user.ID), userSnapshot, func() error {
+			return repos.Users.ResetUserPassword(int(user.ID), password)
+		})
+	})
+	if err != nil {
+		utils.ResponseError(c, err)
+		return
+	}
+
+	// The reset revoked the earlier tokens, the new one has the new token version.
+	token, err := newToken(a.with(c).Users, int(user.ID))
+	if err != nil {
+		utils.ResponseError(c, err)
 		return
 	}
 
 	utils.ResponseSuccess(c, token)
 }
+
+// newToken generates a token for a user with the user's current token version.
+func newToken(users repository.UserRepository, id int) (string, error) {
+	user, err := users.GetUserStatus(id)
+	if err != nil {
+		return "", err
+	}
+	token, err := middleware.GenerateToken(user.ID, user.Username, user.TokenVersion)
+	if err != nil {
+		return "", utils.WrapError(utils.UnknownErr, err)
+	}
+	return token, nil
+}
+
+// completeLogin returns the response for a user who passed every login check: an access token,
+// or a password reset token if an admin requires a new password.
+func completeLogin(user *model.User) (interface{}, error) {
+	if user.PasswordResetRequired {
+		token, err := middleware.GeneratePasswordResetToken(user.ID, user.Username)
+		if err != nil {
+			return nil, utils.WrapError(utils.UnknownErr, err)
+		}
+		return passwordResetLoginResponse{PasswordResetRequired: true, Token: token}, nil
+	}
+
+	token, err := middleware.GenerateToken(user.ID, user.Username, user.TokenVersion)
+	if err != nil {
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	return token, nil
+}
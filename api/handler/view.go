@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"blog-go/internal/repository"
+	"blog-go/utils"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindView reads the view of a request on a schema from the query: fields lists the fields of the items and expand
+// the relations to load, separated by commas. Without fields the items have their default fields, and without
+// expand their default relations, while an empty expand loads none. Lists cannot expand the relations that are
+// only for single items. Names the schema does not allow fail the request with ErrorInvalidParam and the reasons per
+// parameter. It returns the view and an error.
+func bindView[T any](c *gin.Context, schema *repository.Schema[T], list bool) (repository.View, error) {
+	var view repository.View
+	var fields []utils.FieldError
+	locale := utils.Locale(c)
+
+	for _, name := range splitParam(c.Query("fields")) {
+		// The ID is always part of the items.
+		if name == "id" {
+			continue
+		}
+		if _, ok := schema.Columns[name]; !ok {
+			fields = append(fields, paramError(locale, "fields", name, "fields", ""))
+			continue
+		}
+		view.Fields = append(view.Fields, name)
+	}
+	if expand, ok := c.GetQuery("expand"); ok {
+		view.Expand = []string{}
+		for _, name := range splitParam(expand) {
+			relation, ok := schema.Relations[name]
+			if !ok || (list && relation.ItemOnly) {
+				fields = append(fields, paramError(locale, "expand", name, "expand", ""))
+				continue
+			}
+			view.Expand = append(view.Expand, name)
+		}
+	}
+
+	if len(fields) > 0 {
+		err := utils.NewError(utils.ErrorInvalidParam)
+		err.Fields = fields
+		return view, err
+	}
+	return view, nil
+}
+
+// splitParam splits a query parameter at the commas, without empty names.
+func splitParam(param string) []string {
+	var names []string
+	for _, name := range strings.Split(param, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// viewOf trims the JSON of a response to the fields and the relations of a view. The ID is always kept, and
+// expanded relations that the item does not have are null. Responses of the default view are returned as they are.
+func viewOf[T any](response interface{}, view repository.View, schema *repository.Schema[T]) interface{} {
+	if view.Fields == nil && view.Expand == nil {
+		return response
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return response
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return response
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, name := range schema.Expanded(view) {
+		keep[name] = true
+		if _, ok := object[name]; !ok {
+			object[name] = json.RawMessage("null")
+		}
+	}
+	for name := range schema.Columns {
+		keep[name] = len(view.Fields) == 0
+	}
+	for _, name := range view.Fields {
+		keep[name] = true
+	}
+	for name := range object {
+		if !keep[name] {
+			delete(object, name)
+		}
+	}
+	return object
+}
+
+// viewList trims the JSON of the responses of a list to the fields and the relations of a view.
+func viewList[R, T any](items []R, view repository.View, schema *repository.Schema[T]) []interface{} {
+	list := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		list = append(list, viewOf(item, view, schema))
+	}
+	return list
+}
@@ -1,6 +1,12 @@
 package config
 
-import "github.com/BurntSushi/toml"
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
 
 var cfg Config
 
@@ -8,20 +14,41 @@ type Config struct {
 	Server    ServerConfig    `toml:"server"`
 	Database  DatabaseConfig  `toml:"database"`
 	AliyunOSS AliyunOSSConfig `toml:"aliyun_oss"`
+	Login     LoginConfig     `toml:"login"`
+	Tracing   TracingConfig   `toml:"tracing"`
+	Log       LogConfig       `toml:"log"`
+	Metrics   MetricsConfig   `toml:"metrics"`
+
+	OAuth map[string]OAuthProviderConfig `toml:"oauth"`
 }
 
+// ServerConfig configures the HTTP server. The timeouts are those of http.Server, and ShutdownTimeout is how long
+// the requests in flight are waited for on shutdown. Unset timeouts have defaults.
+// TrustedProxies are the IPs or CIDRs of the reverse proxies whose X-Forwarded-For header gives the client IP. With
+// none the client IP is the peer address, so that clients cannot choose the IP that the login lockout counts.
 type ServerConfig struct {
-	Mode   string `toml:"mode"`
-	Port   string `toml:"port"`
-	JwtKey string `tom:"jwt_key"`
+	Mode           string   `toml:"mode"`
+	Port           string   `toml:"port"`
+	JwtKey         string   `toml:"jwt_key"`
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	ReadHeaderTimeout time.Duration `toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `toml:"read_timeout"`
+	WriteTimeout      time.Duration `toml:"write_timeout"`
+	IdleTimeout       time.Duration `toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `toml:"shutdown_timeout"`
 }
 
+// DatabaseConfig configures the database. Driver is "mysql" (the default), "postgres" or "sqlite".
+// For SQLite, Database is the file path, or ":memory:" for an in-memory database.
 type DatabaseConfig struct {
+	Driver   string `toml:"driver"`
 	Host     string `toml:"host"`
 	Port     string `toml:"port"`
 	Database string `toml:"database"`
 	Username string `toml:"username"`
 	Password string `toml:"password"`
+	SSLMode  string `toml:"ssl_mode"`
 }
 
 type AliyunOSSConfig struct {
@@ -31,13 +58,118 @@ type AliyunOSSConfig struct {
 	AliyunServer string `toml:"aliyun_server"`
 }
 
+// LoginConfig configures the brute-force protection of the login.
+// Failed attempts are counted per username and per client IP. After the free attempts every
+// failure blocks further attempts for an exponentially growing delay, and after max attempts
+// the username or IP is locked out.
+type LoginConfig struct {
+	// Store is "memory" for a single node, or "database" to share the state between nodes.
+	Store          string        `toml:"store"`
+	FreeAttempts   int           `toml:"free_attempts"`
+	MaxAttempts    int           `toml:"max_attempts"`
+	IPFreeAttempts int           `toml:"ip_free_attempts"`
+	IPMaxAttempts  int           `toml:"ip_max_attempts"`
+	Backoff        time.Duration `toml:"backoff"`
+	MaxBackoff     time.Duration `toml:"max_backoff"`
+	Lockout        time.Duration `toml:"lockout"`
+}
+
+// TracingConfig configures OpenTelemetry tracing. Exporter is "otlp" to send the spans to an OTLP/HTTP collector,
+// "stdout" to print them, or empty to only propagate the trace context of the requests. The OTLP exporter also
+// reads the OTEL_EXPORTER_OTLP_* environment variables, which Endpoint overrides. SampleRatio is the share of the
+// new traces that are recorded, all of them if it is 0. Requests that come with a sampled trace are always recorded.
+type TracingConfig struct {
+	Exporter    string  `toml:"exporter"`
+	Endpoint    string  `toml:"endpoint"`
+	Insecure    bool    `toml:"insecure"`
+	ServiceName string  `toml:"service_name"`
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// LogConfig configures the logs. Level is a logrus level such as "debug" or "info", and Format is "json" or
+// "text". The logs are written to standard output, or to the file at Path, which is rotated every RotationTime and
+// kept for MaxAge. Queries slower than SlowQuery are logged as warnings. Unset values have defaults.
+type LogConfig struct {
+	Level        string        `toml:"level"`
+	Format       string        `toml:"format"`
+	Path         string        `toml:"path"`
+	MaxAge       time.Duration `toml:"max_age"`
+	RotationTime time.Duration `toml:"rotation_time"`
+	SlowQuery    time.Duration `toml:"slow_query"`
+}
+
+// MetricsConfig configures /metrics. Scrapers send Token as a bearer token, and without a token /metrics is not
+// served. The business gauges count the content at most once every GaugeInterval, which has a default.
+type MetricsConfig struct {
+	Token         string        `toml:"token"`
+	GaugeInterval time.Duration `toml:"gauge_interval"`
+}
+
+// OAuthProviderConfig configures an OAuth2 or OpenID Connect login provider.
+// For OpenID Connect providers setting Issuer is enough, the endpoints are discovered.
+// Plain OAuth2 providers such as GitHub need the endpoints and claim names set explicitly.
+// The claims are read from the userinfo endpoint for both, the id_token of OpenID Connect providers is not used.
+type OAuthProviderConfig struct {
+	ClientID           string   `toml:"client_id"`
+	ClientSecret       string   `toml:"client_secret"`
+	RedirectURL        string   `toml:"redirect_url"`
+	Issuer             string   `toml:"issuer"`
+	AuthURL            string   `toml:"auth_url"`
+	TokenURL           string   `toml:"token_url"`
+	UserInfoURL        string   `toml:"userinfo_url"`
+	Scopes             []string `toml:"scopes"`
+	SubjectClaim       string   `toml:"subject_claim"`
+	EmailClaim         string   `toml:"email_claim"`
+	UsernameClaim      string   `toml:"username_claim"`
+	SuccessRedirectURL string   `toml:"success_redirect_url"`
+}
+
+// testConfigEnv names the environment variable that points the tests to another config file.
+const testConfigEnv = "BLOG_TEST_CONFIG"
+
 func InitConfig() {
-	_, err := toml.DecodeFile("config/config.toml", &cfg)
+	loadConfig("config/config.toml")
+}
+
+// InitTestConfig loads config/config.test.toml, which uses an in-memory SQLite database, from the
+// working directory or one of its parents, so that it is found from every package.
+// Set BLOG_TEST_CONFIG to the path of another file to run the tests against MySQL or PostgreSQL.
+func InitTestConfig() {
+	path := os.Getenv(testConfigEnv)
+	if path == "" {
+		path = findFile("config/config.test.toml")
+	}
+	loadConfig(path)
+}
+
+func loadConfig(path string) {
+	cfg = Config{}
+	_, err := toml.DecodeFile(path, &cfg)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// findFile returns the first existing path of name relative to the working directory or one of its parents.
+// If there is none, name is returned unchanged.
+func findFile(name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return name
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return name
+		}
+		dir = parent
+	}
+}
+
 func GetConfig() Config {
 	return cfg
 }
@@ -53,3 +185,23 @@ func GetDatabaseConfig() DatabaseConfig {
 func GetAliyunOSSConfig() AliyunOSSConfig {
 	return cfg.AliyunOSS
 }
+
+func GetTracingConfig() TracingConfig {
+	return cfg.Tracing
+}
+
+func GetLogConfig() LogConfig {
+	return cfg.Log
+}
+
+func GetLoginConfig() LoginConfig {
+	return cfg.Login
+}
+
+func GetMetricsConfig() MetricsConfig {
+	return cfg.Metrics
+}
+
+func GetOAuthConfig() map[string]OAuthProviderConfig {
+	return cfg.OAuth
+}
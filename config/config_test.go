@@ -6,7 +6,7 @@ import (
 )
 
 func TestGetConfig(t *testing.T) {
-	InitConfig()
+	InitTestConfig()
 	c := GetConfig()
 	fmt.Printf("%+v\n", c)
 }
@@ -2,71 +2,171 @@ package db
 
 import (
 	"blog-go/config"
-	"blog-go/internal/model"
+	"blog-go/internal/logging"
+	"blog-go/internal/migrate"
+	"blog-go/internal/tracing"
+	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+var testDB *gorm.DB
+
+// InitDB connects to the database, and refuses to start when migrations of this binary are not applied.
 func InitDB() {
+	Connect()
+
+	if err := migrate.Check(DB); err != nil {
+		panic(fmt.Errorf("%w, run \"blog-go migrate up\" first", err))
+	}
+}
+
+// Connect connects to the database without checking the schema, which the migrate command needs.
+func Connect() {
 	var err error
 
 	dbConfig := config.GetDatabaseConfig()
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dbConfig.Username,
-		dbConfig.Password,
-		dbConfig.Host,
-		dbConfig.Port,
-		dbConfig.Database,
-	)
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	DB, err = open(dbConfig)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	// Migrate the schema, this will create table if they don't exist
-	_ = DB.AutoMigrate(&model.Article{}, &model.Category{}, &model.Comment{}, &model.User{})
+// Close closes the connections of DB as the last shutdown function of routes.Serve, and returns an error.
+func Close(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
 
+// Ping checks that the database is reachable for the readiness probe, and returns the driver and an error.
+func Ping(ctx context.Context) (string, error) {
 	sqlDB, err := DB.DB()
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return "", err
 	}
+	return DB.Dialector.Name(), nil
+}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(10 * time.Second)
+// CheckMigrations checks that the migrations of this binary are applied for the readiness probe, and returns the
+// schema version and an error.
+func CheckMigrations(ctx context.Context) (string, error) {
+	list, err := migrate.GetStatus(DB.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	version := 0
+	for _, s := range list {
+		if !s.Applied {
+			return fmt.Sprintf("version %d", version), fmt.Errorf("%w: migration %d %s is pending", migrate.ErrSchemaBehind, s.Version, s.Name)
+		}
+		version = s.Version
+	}
+	return fmt.Sprintf("version %d", version), nil
 }
 
+// InitTestDB empties the test database and applies all migrations.
+// The connection is opened once and kept, so that repositories created on DB see the emptied database.
 func InitTestDB() {
-	var err error
+	if testDB == nil {
+		dbConfig := config.GetDatabaseConfig()
+		dbConfig.Database = testDatabase(dbConfig)
+		var err error
+		testDB, err = open(dbConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+	DB = testDB
 
-	dbConfig := config.GetDatabaseConfig()
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dbConfig.Username,
-		dbConfig.Password,
-		dbConfig.Host,
-		dbConfig.Port,
-		dbConfig.Database+"_test",
-	)
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
+	if _, err := migrate.Down(DB, len(migrate.Migrations())); err != nil {
+		panic(err)
+	}
+	if _, err := migrate.Up(DB); err != nil {
 		panic(err)
 	}
+}
 
-	_ = DB.Migrator().DropTable(&model.Article{}, &model.Category{}, &model.Comment{}, &model.User{})
-	// Migrate the schema, this will create table if they don't exist
-	_ = DB.AutoMigrate(&model.Article{}, &model.Category{}, &model.Comment{}, &model.User{})
+// open connects to the database of the configured driver and sets up the connection pool.
+func open(dbConfig config.DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch dbConfig.Driver {
+	case "", "mysql":
+		dialector = mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			dbConfig.Username,
+			dbConfig.Password,
+			dbConfig.Host,
+			dbConfig.Port,
+			dbConfig.Database,
+		))
+	case "postgres":
+		sslMode := dbConfig.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dialector = postgres.Open(fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			dbConfig.Host,
+			dbConfig.Port,
+			dbConfig.Username,
+			dbConfig.Password,
+			dbConfig.Database,
+			sslMode,
+		))
+	case "sqlite":
+		// Foreign keys are off by default in SQLite, and the cascades rely on them.
+		dialector = sqlite.Open(dbConfig.Database + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", dbConfig.Driver)
+	}
 
-	sqlDB, err := DB.DB()
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logging.NewGormLogger()})
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if dbConfig.Driver == "sqlite" {
+		// SQLite allows a single writer, and every connection to ":memory:" opens a new empty database.
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
 	}
 
 	sqlDB.SetMaxIdleConns(10)
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(10 * time.Second)
+	return db, nil
+}
+
+// testDatabase returns the name of the database used by the tests, which is the configured one with a _test suffix.
+// An in-memory SQLite database is used as it is, since it is new for every connection pool.
+func testDatabase(dbConfig config.DatabaseConfig) string {
+	if dbConfig.Driver != "sqlite" {
+		return dbConfig.Database + "_test"
+	}
+	if dbConfig.Database == ":memory:" {
+		return dbConfig.Database
+	}
+	ext := filepath.Ext(dbConfig.Database)
+	return strings.TrimSuffix(dbConfig.Database, ext) + "_test" + ext
 }
@@ -9,8 +9,8 @@ import (
 )
 
 func TestInitDB(t *testing.T) {
-	config.InitConfig()
-	InitDB()
+	config.InitTestConfig()
+	InitTestDB()
 
 	// Add two categories
 	category1 := model.Category{Name: "CategoryTest1"}
@@ -81,15 +81,15 @@ func TestInitDB(t *testing.T) {
 	comment1 := model.Comment{
 		Content:   "ContentTest1",
 		CreatedAt: time.Now(),
-		Article:   article1,
-		User:      user1,
+		Article:   &article1,
+		User:      &user1,
 	}
 	time.Sleep(1 * time.Second)
 	comment2 := model.Comment{
 		Content:   "ContentTest2",
 		CreatedAt: time.Now(),
-		Article:   article2,
-		User:      user1,
+		Article:   &article2,
+		User:      &user1,
 	}
 	DB.Create(&comment1)
 	DB.Create(&comment2)
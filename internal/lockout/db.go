@@ -0,0 +1,86 @@
+package lockout
+
+import (
+	"blog-go/internal/model"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps the attempts in the database, so that all nodes share them.
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a store on a database.
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Get(key string) (Attempt, error) {
+	var row model.LoginAttempt
+	err := s.db.Where("attempt_key = ?", key).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Attempt{}, nil
+		}
+		return Attempt{}, err
+	}
+	return fromRow(row), nil
+}
+
+func (s *DBStore) Update(key string, fn func(Attempt) Attempt) (Attempt, error) {
+	var a Attempt
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists, so that it can be locked while it is updated.
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginAttempt{Key: key}).Error
+		if err != nil {
+			return err
+		}
+
+		var row model.LoginAttempt
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("attempt_key = ?", key).First(&row).Error
+		if err != nil {
+			return err
+		}
+
+		a = fn(fromRow(row))
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"failures":        a.Failures,
+			"last_failure_at": timeOrNil(a.LastFailureAt),
+			"blocked_until":   timeOrNil(a.BlockedUntil),
+		}).Error
+	})
+	return a, err
+}
+
+func (s *DBStore) Delete(key string) error {
+	return s.db.Where("attempt_key = ?", key).Delete(&model.LoginAttempt{}).Error
+}
+
+func (s *DBStore) Prune(before time.Time) error {
+	return s.db.Where("(last_failure_at IS NULL OR last_failure_at < ?) AND (blocked_until IS NULL OR blocked_until < ?)", before, before).
+		Delete(&model.LoginAttempt{}).Error
+}
+
+func fromRow(row model.LoginAttempt) Attempt {
+	a := Attempt{Failures: row.Failures}
+	if row.LastFailureAt != nil {
+		a.LastFailureAt = *row.LastFailureAt
+	}
+	if row.BlockedUntil != nil {
+		a.BlockedUntil = *row.BlockedUntil
+	}
+	return a
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
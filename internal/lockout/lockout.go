@@ -0,0 +1,309 @@
+// Package lockout protects the login against brute-force attacks, by counting failed attempts
+// per username and per client IP and blocking further attempts with an exponential backoff.
+package lockout
+
+import (
+	"blog-go/config"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attempt is the failed login state of a username or client IP.
+type Attempt struct {
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
+
+// Store keeps the attempts. Update must apply fn atomically, also across nodes for shared stores.
+// Prune removes the attempts whose last failure and block ended before a time.
+type Store interface {
+	Get(key string) (Attempt, error)
+	Update(key string, fn func(Attempt) Attempt) (Attempt, error)
+	Delete(key string) error
+	Prune(before time.Time) error
+}
+
+// pruneInterval is how often a guard removes the attempts that are forgotten, so that random usernames cannot
+// grow the store forever.
+const pruneInterval = time.Minute
+
+// Policy decides how long a key is blocked after a failure.
+type Policy struct {
+	FreeAttempts int
+	MaxAttempts  int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	Lockout      time.Duration
+}
+
+// fail records one more failure. Failures are forgotten after a lockout period without any.
+func (p Policy) fail(a Attempt, now time.Time) Attempt {
+	if now.Sub(a.LastFailureAt) > p.Lockout && now.After(a.BlockedUntil) {
+		a = Attempt{}
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	a.BlockedUntil = p.blockedUntil(a)
+	return a
+}
+
+// release takes back one failure, the block is shortened to the one of the remaining failures.
+func (p Policy) release(a Attempt) Attempt {
+	if a.Failures <= 1 {
+		return Attempt{}
+	}
+	a.Failures--
+	a.BlockedUntil = p.blockedUntil(a)
+	return a
+}
+
+// blockedUntil returns the end of the block after the last failure, or the zero time without a block.
+func (p Policy) blockedUntil(a Attempt) time.Time {
+	switch {
+	case a.Failures >= p.MaxAttempts:
+		return a.LastFailureAt.Add(p.Lockout)
+	case a.Failures > p.FreeAttempts:
+		delay := p.MaxBackoff
+		if shift := a.Failures - p.FreeAttempts - 1; shift < 32 && p.Backoff<<shift < p.MaxBackoff {
+			delay = p.Backoff << shift
+		}
+		return a.LastFailureAt.Add(delay)
+	}
+	return time.Time{}
+}
+
+// Guard checks and records login attempts.
+type Guard struct {
+	store Store
+	user  Policy
+	ip    Policy
+	now   func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+// New creates a guard with a store and the policies for usernames and client IPs.
+func New(store Store, user, ip Policy) *Guard {
+	return &Guard{store: store, user: user, ip: ip, now: time.Now}
+}
+
+// Check returns how long the username or the client IP is still blocked, or zero if the attempt is allowed.
+func (g *Guard) Check(username, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+	for _, key := range []string{userKey(username), ipKey(ip)} {
+		a, err := g.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := a.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Reserve counts an attempt as failed before it is verified, so that parallel attempts cannot all pass the
+// check before any of them fails. It returns how long the username or the client IP is still blocked, and then
+// the attempt is not counted. The attempt is given back with Release once it is verified.
+func (g *Guard) Reserve(username, ip string) (time.Duration, error) {
+	now := g.now()
+	if err := g.prune(now); err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	reserve := func(p Policy, counted *bool) func(Attempt) Attempt {
+		return func(a Attempt) Attempt {
+			if d := a.BlockedUntil.Sub(now); d > 0 {
+				if d > wait {
+					wait = d
+				}
+				return a
+			}
+			*counted = true
+			return p.fail(a, now)
+		}
+	}
+
+	var userCounted, ipCounted bool
+	if _, err := g.store.Update(userKey(username), reserve(g.user, &userCounted)); err != nil {
+		return 0, err
+	}
+	if _, err := g.store.Update(ipKey(ip), reserve(g.ip, &ipCounted)); err != nil {
+		return 0, err
+	}
+	if wait == 0 {
+		return 0, nil
+	}
+
+	// A blocked attempt is not made, so the key that was not blocked gets its attempt back.
+	if userCounted {
+		if _, err := g.store.Update(userKey(username), g.user.release); err != nil {
+			return 0, err
+		}
+	}
+	if ipCounted {
+		if _, err := g.store.Update(ipKey(ip), g.ip.release); err != nil {
+			return 0, err
+		}
+	}
+	return wait, nil
+}
+
+// Release gives back an attempt of Reserve that turned out not to be a failure.
+func (g *Guard) Release(username, ip string) error {
+	if _, err := g.store.Update(userKey(username), g.user.release); err != nil {
+		return err
+	}
+	_, err := g.store.Update(ipKey(ip), g.ip.release)
+	return err
+}
+
+// Fail records a failed attempt for the username and the client IP.
+func (g *Guard) Fail(username, ip string) error {
+	now := g.now()
+	if err := g.prune(now); err != nil {
+		return err
+	}
+	if _, err := g.store.Update(userKey(username), func(a Attempt) Attempt {
+		return g.user.fail(a, now)
+	}); err != nil {
+		return err
+	}
+	_, err := g.store.Update(ipKey(ip), func(a Attempt) Attempt {
+		return g.ip.fail(a, now)
+	})
+	return err
+}
+
+// Succeed forgets the failures of a username. The client IP is not reset,
+// so one valid account cannot be used to keep guessing the passwords of others.
+func (g *Guard) Succeed(username string) error {
+	return g.store.Delete(userKey(username))
+}
+
+// Unlock removes the block of a username and/or a client IP.
+func (g *Guard) Unlock(username, ip string) error {
+	if username != "" {
+		if err := g.store.Delete(userKey(username)); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		if err := g.store.Delete(ipKey(ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes the attempts that fail would forget anyway, at most once per pruneInterval.
+func (g *Guard) prune(now time.Time) error {
+	g.mu.Lock()
+	if now.Sub(g.prunedAt) < pruneInterval {
+		g.mu.Unlock()
+		return nil
+	}
+	g.prunedAt = now
+	g.mu.Unlock()
+
+	window := g.user.Lockout
+	if g.ip.Lockout > window {
+		window = g.ip.Lockout
+	}
+	return g.store.Prune(now.Add(-window))
+}
+
+func userKey(username string) string {
+	// Usernames are compared case-insensitively by the database collation.
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+var guard = New(NewMemoryStore(), Policy{
+	FreeAttempts: 3,
+	MaxAttempts:  10,
+	Backoff:      time.Second,
+	MaxBackoff:   5 * time.Minute,
+	Lockout:      15 * time.Minute,
+}, Policy{
+	FreeAttempts: 20,
+	MaxAttempts:  100,
+	Backoff:      time.Second,
+	MaxBackoff:   5 * time.Minute,
+	Lockout:      15 * time.Minute,
+})
+
+// InitLockout replaces the default guard with one built from the config. The database store keeps the attempts
+// in db.
+func InitLockout(db *gorm.DB) {
+	loginConfig := config.GetLoginConfig()
+
+	var store Store = NewMemoryStore()
+	if loginConfig.Store == "database" {
+		store = NewDBStore(db)
+	}
+
+	user, ip := guard.user, guard.ip
+	if loginConfig.FreeAttempts > 0 {
+		user.FreeAttempts = loginConfig.FreeAttempts
+	}
+	if loginConfig.MaxAttempts > 0 {
+		user.MaxAttempts = loginConfig.MaxAttempts
+	}
+	if loginConfig.IPFreeAttempts > 0 {
+		ip.FreeAttempts = loginConfig.IPFreeAttempts
+	}
+	if loginConfig.IPMaxAttempts > 0 {
+		ip.MaxAttempts = loginConfig.IPMaxAttempts
+	}
+	if loginConfig.Backoff > 0 {
+		user.Backoff, ip.Backoff = loginConfig.Backoff, loginConfig.Backoff
+	}
+	if loginConfig.MaxBackoff > 0 {
+		user.MaxBackoff, ip.MaxBackoff = loginConfig.MaxBackoff, loginConfig.MaxBackoff
+	}
+	if loginConfig.Lockout > 0 {
+		user.Lockout, ip.Lockout = loginConfig.Lockout, loginConfig.Lockout
+	}
+
+	guard = New(store, user, ip)
+}
+
+// Check uses the default guard, see Guard.Check.
+func Check(username, ip string) (time.Duration, error) {
+	return guard.Check(username, ip)
+}
+
+// Reserve uses the default guard, see Guard.Reserve.
+func Reserve(username, ip string) (time.Duration, error) {
+	return guard.Reserve(username, ip)
+}
+
+// Release uses the default guard, see Guard.Release.
+func Release(username, ip string) error {
+	return guard.Release(username, ip)
+}
+
+// Fail uses the default guard, see Guard.Fail.
+func Fail(username, ip string) error {
+	return guard.Fail(username, ip)
+}
+
+// Succeed uses the default guard, see Guard.Succeed.
+func Succeed(username string) error {
+	return guard.Succeed(username)
+}
+
+// Unlock uses the default guard, see Guard.Unlock.
+func Unlock(username, ip string) error {
+	return guard.Unlock(username, ip)
+}
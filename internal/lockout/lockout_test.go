@@ -0,0 +1,178 @@
+package lockout
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 2,
+	MaxAttempts:  5,
+	Backoff:      time.Second,
+	MaxBackoff:   3 * time.Second,
+	Lockout:      time.Minute,
+}
+
+func newTestGuard(store Store) (*Guard, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard := New(store, testPolicy, Policy{
+		FreeAttempts: 100,
+		MaxAttempts:  100,
+		Backoff:      time.Second,
+		MaxBackoff:   time.Second,
+		Lockout:      time.Minute,
+	})
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func checkWait(t *testing.T, guard *Guard, username string, want time.Duration) {
+	t.Helper()
+	wait, err := guard.Check(username, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Check Error: %v", err)
+	}
+	if wait != want {
+		t.Fatalf("Check Error: wait %v, want %v", wait, want)
+	}
+}
+
+func testGuard(t *testing.T, store Store) {
+	guard, now := newTestGuard(store)
+
+	// Free attempts
+	for i := 0; i < 2; i++ {
+		if err := guard.Fail("Test", "127.0.0.1"); err != nil {
+			t.Fatalf("Fail Error: %v", err)
+		}
+		checkWait(t, guard, "test", 0)
+	}
+
+	// Exponential backoff up to the max backoff
+	for _, want := range []time.Duration{time.Second, 2 * time.Second} {
+		_ = guard.Fail("test", "127.0.0.1")
+		checkWait(t, guard, "test", want)
+		*now = now.Add(want)
+		checkWait(t, guard, "test", 0)
+	}
+
+	// Lockout
+	_ = guard.Fail("test", "127.0.0.1")
+	checkWait(t, guard, "test", time.Minute)
+	checkWait(t, guard, "other", 0)
+
+	if err := guard.Unlock("test", ""); err != nil {
+		t.Fatalf("Unlock Error: %v", err)
+	}
+	checkWait(t, guard, "test", 0)
+
+	// Success forgets the failures
+	for i := 0; i < 3; i++ {
+		_ = guard.Fail("test", "127.0.0.1")
+	}
+	*now = now.Add(time.Second)
+	if err := guard.Succeed("test"); err != nil {
+		t.Fatalf("Succeed Error: %v", err)
+	}
+	_ = guard.Fail("test", "127.0.0.1")
+	checkWait(t, guard, "test", 0)
+
+	// Failures are forgotten after a lockout period without any
+	_ = guard.Fail("test", "127.0.0.1")
+	*now = now.Add(2 * time.Minute)
+	_ = guard.Fail("test", "127.0.0.1")
+	checkWait(t, guard, "test", 0)
+}
+
+func testReserve(t *testing.T, store Store) {
+	guard, _ := newTestGuard(store)
+
+	// A released attempt is not counted
+	for i := 0; i < 5; i++ {
+		wait, err := guard.Reserve("reserve", "127.0.0.1")
+		if err != nil || wait != 0 {
+			t.Fatalf("Reserve Error: %v %v", wait, err)
+		}
+		if err := guard.Release("reserve", "127.0.0.1"); err != nil {
+			t.Fatalf("Release Error: %v", err)
+		}
+	}
+	checkWait(t, guard, "reserve", 0)
+
+	// Parallel attempts pass until the free attempts are used up
+	var wg sync.WaitGroup
+	var passed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, err := guard.Reserve("parallel", "127.0.0.1"); err == nil && wait == 0 {
+				atomic.AddInt32(&passed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if passed != int32(testPolicy.FreeAttempts+1) {
+		t.Fatalf("Reserve Error: %d attempts passed", passed)
+	}
+	checkWait(t, guard, "parallel", time.Second)
+
+	// A blocked attempt does not count for the client IP
+	a, _ := store.Get(ipKey("127.0.0.1"))
+	if a.Failures != testPolicy.FreeAttempts+1 {
+		t.Fatalf("Reserve Error: %d IP failures", a.Failures)
+	}
+}
+
+func testPrune(t *testing.T, store Store) {
+	guard, now := newTestGuard(store)
+
+	_ = guard.Fail("stale", "127.0.0.1")
+	*now = now.Add(testPolicy.Lockout + time.Second)
+	_ = guard.Fail("fresh", "127.0.0.2")
+
+	for key, want := range map[string]int{userKey("stale"): 0, ipKey("127.0.0.1"): 0, userKey("fresh"): 1} {
+		if a, err := store.Get(key); err != nil || a.Failures != want {
+			t.Fatalf("Prune Error: %s has %d failures", key, a.Failures)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testGuard(t, NewMemoryStore())
+	testReserve(t, NewMemoryStore())
+	testPrune(t, NewMemoryStore())
+}
+
+func TestIPLockout(t *testing.T) {
+	guard, _ := newTestGuard(NewMemoryStore())
+	guard.ip = testPolicy
+
+	// Different usernames from one IP
+	for _, username := range []string{"a", "b", "c"} {
+		_ = guard.Fail(username, "10.0.0.1")
+	}
+	wait, _ := guard.Check("d", "10.0.0.1")
+	if wait != time.Second {
+		t.Fatalf("Check Error: wait %v", wait)
+	}
+	wait, _ = guard.Check("d", "10.0.0.2")
+	if wait != 0 {
+		t.Fatalf("Check Error: wait %v", wait)
+	}
+}
+
+func TestDBStore(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	testGuard(t, NewDBStore(db.DB))
+	db.InitTestDB()
+	testReserve(t, NewDBStore(db.DB))
+	db.InitTestDB()
+	testPrune(t, NewDBStore(db.DB))
+}
@@ -0,0 +1,50 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the attempts in the process, for a single node.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+}
+
+// NewMemoryStore creates an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempt{}}
+}
+
+func (s *MemoryStore) Get(key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(Attempt) Attempt) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := fn(s.attempts[key])
+	s.attempts[key] = a
+	return a, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, a := range s.attempts {
+		if a.LastFailureAt.Before(before) && a.BlockedUntil.Before(before) {
+			delete(s.attempts, k)
+		}
+	}
+	return nil
+}
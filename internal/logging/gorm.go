@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"blog-go/config"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger logs the queries of a GORM database with the logger in the context of the query, which the
+// repositories take from the request. Failed queries are errors, slow queries warnings, and the others are only
+// logged at the debug level. Records that are not found are not failures. The statements are logged without
+// their parameters, which hold password hashes, two-factor secrets and token hashes.
+type GormLogger struct {
+	SlowThreshold time.Duration
+}
+
+// NewGormLogger creates the query logger with the configured slow query threshold.
+func NewGormLogger() GormLogger {
+	return GormLogger{SlowThreshold: orDefault(config.GetLogConfig().SlowQuery, defaultSlowQuery)}
+}
+
+// LogMode is a no-op, the level of Logger decides which queries are logged.
+func (l GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Infof(msg, args...)
+}
+
+func (l GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Warnf(msg, args...)
+}
+
+func (l GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	FromContext(ctx).Errorf(msg, args...)
+}
+
+// ParamsFilter drops the parameters of a statement before it is logged, so that the logged SQL keeps its
+// placeholders.
+func (l GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// Trace logs a query once it has run.
+func (l GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	entry := FromContext(ctx)
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.SlowThreshold > 0 && elapsed > l.SlowThreshold
+	if !failed && !slow && !entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+
+	sql, rows := fc()
+	entry = entry.WithFields(logrus.Fields{
+		"sql":          sql,
+		"rows":         rows,
+		"latency_time": fmt.Sprintf("%dms", elapsed.Milliseconds()),
+	})
+	switch {
+	case failed:
+		entry.WithError(err).Error("Query Error")
+	case slow:
+		entry.Warn("Slow Query")
+	default:
+		entry.Debug("Query")
+	}
+}
@@ -0,0 +1,96 @@
+// Package logging sets up the logger of the app, and carries the logger of a request in its context, so that the
+// handlers and the repositories log with the request ID and the trace of the request.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"blog-go/config"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/sirupsen/logrus"
+)
+
+// Default log settings, for the ones the config leaves unset.
+const (
+	defaultMaxAge       = 168 * time.Hour
+	defaultRotationTime = 24 * time.Hour
+	defaultSlowQuery    = 200 * time.Millisecond
+)
+
+// Logger is the logger of the app. Before Init it writes text to standard error at the info level.
+var Logger = logrus.New()
+
+type contextKey struct{}
+
+// Init sets up Logger from the config, and returns an error if the level, the format or the path is invalid.
+func Init() error {
+	logConfig := config.GetLogConfig()
+
+	level := logrus.InfoLevel
+	if logConfig.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(logConfig.Level); err != nil {
+			return err
+		}
+	}
+
+	var formatter logrus.Formatter
+	switch logConfig.Format {
+	case "", "json":
+		formatter = &logrus.JSONFormatter{}
+	case "text":
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("unknown log format %q", logConfig.Format)
+	}
+
+	Logger.SetLevel(level)
+	Logger.SetFormatter(formatter)
+	if logConfig.Path == "" {
+		Logger.SetOutput(os.Stdout)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logConfig.Path), 0755); err != nil {
+		return err
+	}
+	writer, err := rotatelogs.New(
+		logConfig.Path+".%Y%m%d",
+		rotatelogs.WithLinkName(logConfig.Path),
+		rotatelogs.WithMaxAge(orDefault(logConfig.MaxAge, defaultMaxAge)),
+		rotatelogs.WithRotationTime(orDefault(logConfig.RotationTime, defaultRotationTime)),
+	)
+	if err != nil {
+		return err
+	}
+	Logger.SetOutput(writer)
+	return nil
+}
+
+// NewContext returns a copy of ctx that carries the logger of a request.
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the logger of the request of ctx, with its request ID and trace, or Logger outside of
+// requests.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+			return entry.WithContext(ctx)
+		}
+	}
+	return logrus.NewEntry(Logger).WithContext(ctx)
+}
+
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,130 @@
+// Package metrics holds the Prometheus metrics of the app, which /metrics serves in the text format.
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "blog"
+
+// defaultGaugeInterval is how often the business gauges are read if no interval is given.
+const defaultGaugeInterval = time.Minute
+
+// Registry is the registry of the app's metrics, with the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests by method, route template and status.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	// HTTPDuration observes the latency of the requests by method, route template and status.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the HTTP requests by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	// UploadSize observes the size of the uploaded files.
+	UploadSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of the uploaded files.",
+		// 1 KiB to 64 MiB
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 9),
+	})
+	// Logins counts the login attempts by method (password or totp) and result (success, failure or locked).
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by method and result.",
+	}, []string{"method", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		UploadSize,
+		Logins,
+	)
+}
+
+// RegisterDB adds the connection pool stats of a database, and returns an error.
+func RegisterDB(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Gauge is a business gauge that is read on scrape, at most once every interval.
+type Gauge struct {
+	Name string
+	Help string
+	// Value reads the gauge. Gauges whose value cannot be read are left out of the scrape.
+	Value func() (float64, error)
+}
+
+// RegisterGauges adds business gauges that are read at most once every interval, or every minute if it is 0,
+// and returns an error.
+func RegisterGauges(interval time.Duration, gauges ...Gauge) error {
+	if interval <= 0 {
+		interval = defaultGaugeInterval
+	}
+	return Registry.Register(&gaugeCollector{gauges: gauges, interval: interval})
+}
+
+// gaugeCollector reads the business gauges on scrape and keeps them for the interval, so that frequent or parallel
+// scrapes do not count the content in the database every time.
+type gaugeCollector struct {
+	gauges   []Gauge
+	interval time.Duration
+
+	mu      sync.Mutex
+	readAt  time.Time
+	metrics []prometheus.Metric
+}
+
+func (g *gaugeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, gauge := range g.gauges {
+		ch <- g.desc(gauge)
+	}
+}
+
+func (g *gaugeCollector) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.metrics == nil || time.Since(g.readAt) >= g.interval {
+		g.metrics = g.read()
+		g.readAt = time.Now()
+	}
+	for _, metric := range g.metrics {
+		ch <- metric
+	}
+}
+
+// read reads all gauges. The errors are kept as invalid metrics until the next read.
+func (g *gaugeCollector) read() []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, len(g.gauges))
+	for _, gauge := range g.gauges {
+		value, err := gauge.Value()
+		if err != nil {
+			metrics = append(metrics, prometheus.NewInvalidMetric(g.desc(gauge), err))
+			continue
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(g.desc(gauge), prometheus.GaugeValue, value))
+	}
+	return metrics
+}
+
+func (g *gaugeCollector) desc(gauge Gauge) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", gauge.Name), gauge.Help, nil, nil)
+}
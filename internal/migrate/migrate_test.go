@@ -0,0 +1,291 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:?_pragma=foreign_keys(1)"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Open database failed")
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Check(db); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatal("Check empty database failed")
+	}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Fatal("Check changed the database")
+	}
+
+	done, err := Up(db)
+	if err != nil || len(done) != len(Migrations()) {
+		t.Fatal("Up failed")
+	}
+	if err := Check(db); err != nil {
+		t.Fatal("Check migrated database failed")
+	}
+	if !db.Migrator().HasTable("articles") || !db.Migrator().HasTable("article_categories") {
+		t.Fatal("Up failed")
+	}
+	for _, table := range versionedTables {
+		if !db.Migrator().HasColumn(table, "version") {
+			t.Fatal("Up failed")
+		}
+	}
+	for _, index := range listIndexes {
+		if !db.Migrator().HasIndex(index.Table, index.Name) {
+			t.Fatal("Up failed")
+		}
+	}
+	for _, index := range auditEventIndexes {
+		if !db.Migrator().HasIndex("audit_events", index.Name) {
+			t.Fatal("Up failed")
+		}
+	}
+	if !db.Migrator().HasColumn("users", "totp_last_step") || !db.Migrator().HasColumn("users", "token_version") {
+		t.Fatal("Up failed")
+	}
+
+	// Nothing is pending
+	done, err = Up(db)
+	if err != nil || len(done) != 0 {
+		t.Fatal("Up twice failed")
+	}
+
+	// Roll back the last three migrations, the data migration leaves the schema as it is
+	done, err = Down(db, 3)
+	if err != nil || len(done) != 3 || done[0].Version != Migrations()[len(Migrations())-1].Version {
+		t.Fatal("Down failed")
+	}
+	if err := Check(db); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatal("Check after down failed")
+	}
+	if db.Migrator().HasColumn("users", "totp_last_step") || db.Migrator().HasColumn("users", "token_version") ||
+		!db.Migrator().HasTable("audit_events") {
+		t.Fatal("Down failed")
+	}
+
+	// Roll back everything and apply again
+	if _, err := Down(db, len(Migrations())); err != nil {
+		t.Fatal("Down all failed")
+	}
+	if db.Migrator().HasTable("articles") {
+		t.Fatal("Down all failed")
+	}
+	status, err := GetStatus(db)
+	if err != nil || len(status) != len(Migrations()) || status[0].Applied {
+		t.Fatal("GetStatus failed")
+	}
+	if _, err := Up(db); err != nil {
+		t.Fatal("Up again failed")
+	}
+}
+
+// baselineSchema are the tables of the former automatic migration, before the accounts.
+var baselineSchema = []string{
+	"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME NOT NULL, updated_at DATETIME, " +
+		"deleted_at DATETIME, username VARCHAR(20) NOT NULL UNIQUE, password VARCHAR(64) NOT NULL, " +
+		"email VARCHAR(100) NOT NULL UNIQUE, last_login_at DATETIME)",
+	"CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME, updated_at DATETIME, " +
+		"deleted_at DATETIME, name VARCHAR(50) NOT NULL)",
+	"CREATE TABLE articles (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME NOT NULL, " +
+		"updated_at DATETIME NOT NULL, deleted_at DATETIME, title VARCHAR(100) NOT NULL, content LONGTEXT, " +
+		"comment_count INTEGER NOT NULL DEFAULT 0, read_count INTEGER NOT NULL DEFAULT 0)",
+	"CREATE TABLE article_categories (article_id INTEGER, category_id INTEGER, PRIMARY KEY (article_id, category_id), " +
+		"FOREIGN KEY (article_id) REFERENCES articles(id), FOREIGN KEY (category_id) REFERENCES categories(id))",
+	"CREATE TABLE comments (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME NOT NULL, " +
+		"updated_at DATETIME NOT NULL, deleted_at DATETIME, content VARCHAR(500) NOT NULL, " +
+		"article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE, " +
+		"user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE)",
+}
+
+// openBaselineDB returns a database of the former automatic migration with a user, an article and its comments.
+func openBaselineDB(t *testing.T) *gorm.DB {
+	db := openTestDB(t)
+	for _, statement := range baselineSchema {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal("Create baseline schema failed")
+		}
+	}
+	for _, name := range []string{"first", "second"} {
+		db.Exec("INSERT INTO users (username, password, email, created_at) VALUES (?, 'x', ?, CURRENT_TIMESTAMP)", name, name+"@b.c")
+	}
+	db.Exec("INSERT INTO categories (name, created_at) VALUES ('c', CURRENT_TIMESTAMP)")
+	db.Exec("INSERT INTO articles (title, content, created_at, updated_at) VALUES ('a', 'a', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+	db.Exec("INSERT INTO article_categories (article_id, category_id) VALUES (1, 1)")
+	for i := 0; i < 2; i++ {
+		db.Exec("INSERT INTO comments (content, article_id, user_id, created_at, updated_at) VALUES ('c', 1, 2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+	}
+	return db
+}
+
+func TestInitialSchemaBaseline(t *testing.T) {
+	db := openBaselineDB(t)
+
+	if err := initialSchemaUp(db); err != nil {
+		t.Fatal("Initial schema failed")
+	}
+	if db.Migrator().HasColumn("users", "role") || db.Migrator().HasColumn("articles", "user_id") {
+		t.Fatal("Initial schema changed an existing database")
+	}
+}
+
+func TestUpgradeBaseline(t *testing.T) {
+	db := openBaselineDB(t)
+
+	done, err := Up(db)
+	if err != nil || len(done) != len(Migrations()) {
+		t.Fatalf("Up baseline failed: %v", err)
+	}
+	if err := Check(db); err != nil {
+		t.Fatal("Check upgraded database failed")
+	}
+	for _, column := range []string{"role", "display_name", "disabled", "password_reset_required", "totp_secret", "totp_enabled", "totp_last_step", "version"} {
+		if !db.Migrator().HasColumn("users", column) {
+			t.Fatalf("Up baseline failed: no users.%s", column)
+		}
+	}
+	for _, table := range append(accountTables, "audit_events") {
+		if !db.Migrator().HasTable(table) {
+			t.Fatalf("Up baseline failed: no %s", table)
+		}
+	}
+
+	// The data is kept, the oldest user is admin and the comments are counted
+	var roles []string
+	db.Raw("SELECT role FROM users ORDER BY id").Scan(&roles)
+	if len(roles) != 2 || roles[0] != "admin" || roles[1] != "user" {
+		t.Fatalf("Up baseline failed: %v", roles)
+	}
+	var count int
+	db.Raw("SELECT comment_count FROM articles WHERE id = 1").Scan(&count)
+	if count != 2 {
+		t.Fatal("Up baseline failed")
+	}
+	db.Raw("SELECT COUNT(*) FROM article_categories").Scan(&count)
+	if count != 1 {
+		t.Fatal("Up baseline failed")
+	}
+
+	// Articles of a deleted author are kept without an author
+	db.Exec("UPDATE articles SET user_id = 1")
+	db.Exec("DELETE FROM users WHERE id = 1")
+	db.Raw("SELECT COUNT(*) FROM articles WHERE user_id IS NULL").Scan(&count)
+	if count != 1 {
+		t.Fatal("Up baseline failed")
+	}
+}
+
+func TestAddAccountsPartial(t *testing.T) {
+	db := openBaselineDB(t)
+
+	// A database of the former automatic migration after the roles
+	db.Exec("ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'")
+	db.Exec("CREATE TABLE social_links (id INTEGER PRIMARY KEY AUTOINCREMENT, platform TEXT, url TEXT, user_id INTEGER)")
+
+	if err := addAccountsUp(db); err != nil {
+		t.Fatalf("Add accounts failed: %v", err)
+	}
+	if !db.Migrator().HasColumn("users", "totp_enabled") || !db.Migrator().HasTable("personal_access_tokens") {
+		t.Fatal("Add accounts failed")
+	}
+	if err := addAccountsDown(db); err != nil {
+		t.Fatalf("Remove accounts failed: %v", err)
+	}
+	if db.Migrator().HasColumn("users", "role") || db.Migrator().HasColumn("articles", "user_id") {
+		t.Fatal("Remove accounts failed")
+	}
+}
+
+func TestPromoteFirstAdmin(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := initialSchemaUp(db); err != nil || addAccountsUp(db) != nil {
+		t.Fatal("Initial schema failed")
+	}
+	// A database from before the roles, whose first user is deleted
+	for _, name := range []string{"deleted", "first", "second"} {
+		db.Exec("INSERT INTO users (username, password, email, role, created_at) VALUES (?, 'x', ?, 'user', CURRENT_TIMESTAMP)", name, name+"@b.c")
+	}
+	db.Exec("UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE username = 'deleted'")
+
+	if err := promoteFirstAdminUp(db); err != nil {
+		t.Fatal("Promote first admin failed")
+	}
+	var admins []string
+	db.Raw("SELECT username FROM users WHERE role = 'admin'").Scan(&admins)
+	if len(admins) != 1 || admins[0] != "first" {
+		t.Fatalf("Promote first admin failed: %v", admins)
+	}
+
+	// An admin is kept
+	db.Exec("UPDATE users SET role = 'user' WHERE username = 'first'")
+	db.Exec("UPDATE users SET role = 'admin' WHERE username = 'second'")
+	if err := promoteFirstAdminUp(db); err != nil {
+		t.Fatal("Promote first admin failed")
+	}
+	admins = nil
+	db.Raw("SELECT username FROM users WHERE role = 'admin'").Scan(&admins)
+	if len(admins) != 1 || admins[0] != "second" {
+		t.Fatalf("Promote first admin failed: %v", admins)
+	}
+}
+
+func TestBackfillCommentCount(t *testing.T) {
+	db := openTestDB(t)
+
+	// Stop before the backfill
+	if err := initialSchemaUp(db); err != nil || addAccountsUp(db) != nil {
+		t.Fatal("Initial schema failed")
+	}
+	db.Exec("INSERT INTO users (username, password, email, role, created_at) VALUES ('tester', 'x', 'a@b.c', 'user', CURRENT_TIMESTAMP)")
+	db.Exec("INSERT INTO articles (title, created_at, updated_at) VALUES ('a', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+	for i := 0; i < 3; i++ {
+		db.Exec("INSERT INTO comments (content, article_id, user_id, created_at, updated_at) VALUES ('c', 1, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+	}
+	db.Exec("UPDATE comments SET deleted_at = CURRENT_TIMESTAMP WHERE id = 3")
+
+	if err := backfillCommentCountUp(db); err != nil {
+		t.Fatal("Backfill failed")
+	}
+	var count int
+	db.Raw("SELECT comment_count FROM articles WHERE id = 1").Scan(&count)
+	if count != 2 {
+		t.Fatal("Backfill failed")
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := openTestDB(t)
+
+	var out bytes.Buffer
+	if err := Run(db, []string{"status"}, &out); err != nil || !strings.Contains(out.String(), "pending") {
+		t.Fatal("Run status failed")
+	}
+	if err := Run(db, []string{"up"}, &out); err != nil {
+		t.Fatal("Run up failed")
+	}
+	out.Reset()
+	if err := Run(db, []string{"down", "2"}, &out); err != nil || strings.Count(out.String(), "rolled back") != 2 {
+		t.Fatal("Run down failed")
+	}
+	if err := Run(db, []string{"down", "x"}, &out); err == nil {
+		t.Fatal("Run down with invalid steps failed")
+	}
+	if err := Run(db, []string{"sideways"}, &out); err == nil {
+		t.Fatal("Run unknown command failed")
+	}
+}
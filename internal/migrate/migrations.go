@@ -0,0 +1,367 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrations are the schema and data changes, a new one takes the next version.
+// The models used by a migration are copies of the models at that version, so later model changes don't alter it.
+var migrations = []Migration{
+	{Version: 1, Name: "initial_schema", Up: initialSchemaUp, Down: initialSchemaDown},
+	{Version: 2, Name: "add_accounts", Up: addAccountsUp, Down: addAccountsDown},
+	{Version: 3, Name: "backfill_comment_count", Up: backfillCommentCountUp, Down: noop},
+	{Version: 4, Name: "add_version_columns", Up: addVersionColumnsUp, Down: addVersionColumnsDown},
+	{Version: 5, Name: "add_list_indexes", Up: addListIndexesUp, Down: addListIndexesDown},
+	{Version: 6, Name: "add_audit_events", Up: addAuditEventsUp, Down: addAuditEventsDown},
+	{Version: 7, Name: "add_totp_last_step", Up: addTOTPLastStepUp, Down: addTOTPLastStepDown},
+	{Version: 8, Name: "promote_first_admin", Up: promoteFirstAdminUp, Down: noop},
+	{Version: 9, Name: "add_token_version", Up: addTokenVersionUp, Down: addTokenVersionDown},
+}
+
+// initialSchemaUp creates the tables as they were before versioned migrations. It is the baseline of databases
+// created by the former automatic migration: they already have the tables, so it is only recorded for them, since
+// AutoMigrate would alter their columns to these models.
+func initialSchemaUp(tx *gorm.DB) error {
+	if tx.Migrator().HasTable("users") {
+		return nil
+	}
+
+	// The type names are kept, since GORM derives the join table columns from them.
+	type User struct {
+		gorm.Model
+		Username    string    `gorm:"size:20;not null;unique"`
+		Password    string    `gorm:"size:64;not null"`
+		Email       string    `gorm:"size:100;not null;unique"`
+		CreatedAt   time.Time `gorm:"not null"`
+		LastLoginAt time.Time
+	}
+	type Category struct {
+		gorm.Model
+		Name string `gorm:"size:50;not null"`
+	}
+	type Article struct {
+		gorm.Model
+		Title        string `gorm:"size:100;not null"`
+		Content      string
+		CreatedAt    time.Time `gorm:"not null"`
+		UpdatedAt    time.Time `gorm:"not null"`
+		CommentCount int       `gorm:"not null;default:0"`
+		ReadCount    int       `gorm:"not null;default:0"`
+
+		Categories []*Category `gorm:"many2many:article_categories"`
+	}
+	type Comment struct {
+		gorm.Model
+		Content   string    `gorm:"size:500;not null"`
+		CreatedAt time.Time `gorm:"not null"`
+		UpdatedAt time.Time `gorm:"not null"`
+		Article   *Article  `gorm:"foreignKey:ArticleID;constraint:OnDelete:CASCADE"`
+		ArticleID uint      `gorm:"not null"`
+		User      *User     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+		UserID    uint      `gorm:"not null"`
+	}
+
+	return tx.AutoMigrate(&User{}, &Category{}, &Article{}, &Comment{})
+}
+
+func initialSchemaDown(tx *gorm.DB) error {
+	// DropTable drops in reverse order, so the referencing tables go first.
+	return tx.Migrator().DropTable("users", "categories", "articles", "comments", "article_categories")
+}
+
+// accountColumns are the columns of the roles, profiles, account states and two-factor authentication.
+var accountColumns = []string{
+	"Role", "DisplayName", "Bio", "AvatarURL", "Website", "Disabled", "DisabledReason", "PasswordResetRequired",
+	"TOTPSecret", "TOTPEnabled",
+}
+
+// accountTables are the tables of the accounts, which reference the users.
+var accountTables = []string{"recovery_codes", "social_links", "user_identities", "login_attempts", "personal_access_tokens"}
+
+// addAccountsUp adds the account columns, the article authors and the account tables. Databases of the former
+// automatic migration may already have some of them, so only the missing ones are added.
+func addAccountsUp(tx *gorm.DB) error {
+	type User struct {
+		gorm.Model
+		Role                  string `gorm:"size:20;not null;default:user"`
+		DisplayName           string `gorm:"size:50"`
+		Bio                   string `gorm:"size:500"`
+		AvatarURL             string `gorm:"size:255"`
+		Website               string `gorm:"size:255"`
+		Disabled              bool   `gorm:"not null;default:false"`
+		DisabledReason        string `gorm:"size:200"`
+		PasswordResetRequired bool   `gorm:"not null;default:false"`
+		TOTPSecret            string `gorm:"size:64"`
+		TOTPEnabled           bool   `gorm:"not null;default:false"`
+	}
+	type Article struct {
+		gorm.Model
+		User   *User `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL"`
+		UserID *uint
+	}
+	type RecoveryCode struct {
+		gorm.Model
+		User     *User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+		UserID   uint   `gorm:"not null;index"`
+		CodeHash string `gorm:"size:64;not null"`
+		UsedAt   *time.Time
+	}
+	type SocialLink struct {
+		gorm.Model
+		Platform string `gorm:"size:30;not null"`
+		URL      string `gorm:"size:255;not null"`
+		User     *User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+		UserID   uint   `gorm:"not null;index"`
+	}
+	type UserIdentity struct {
+		gorm.Model
+		Provider string `gorm:"size:50;not null;uniqueIndex:idx_provider_subject"`
+		Subject  string `gorm:"size:255;not null;uniqueIndex:idx_provider_subject"`
+		Email    string `gorm:"size:100"`
+		User     *User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+		UserID   uint   `gorm:"not null;index"`
+	}
+	type LoginAttempt struct {
+		ID            uint   `gorm:"primarykey"`
+		Key           string `gorm:"column:attempt_key;size:191;not null;uniqueIndex"`
+		Failures      int    `gorm:"not null;default:0"`
+		LastFailureAt *time.Time
+		BlockedUntil  *time.Time
+		UpdatedAt     time.Time
+	}
+	type PersonalAccessToken struct {
+		gorm.Model
+		Name        string `gorm:"size:100;not null"`
+		TokenHash   string `gorm:"size:64;not null;uniqueIndex"`
+		TokenPrefix string `gorm:"size:20;not null"`
+		Scopes      string `gorm:"size:255;not null"`
+		ExpiresAt   *time.Time
+		LastUsedAt  *time.Time
+		User        *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+		UserID      uint  `gorm:"not null;index"`
+	}
+
+	m := tx.Migrator()
+	for _, column := range accountColumns {
+		if m.HasColumn(&User{}, column) {
+			continue
+		}
+		if err := m.AddColumn(&User{}, column); err != nil {
+			return err
+		}
+	}
+
+	if !m.HasColumn(&Article{}, "UserID") {
+		if tx.Dialector.Name() == "sqlite" {
+			// The SQLite migrator adds a constraint by recreating the table, whose drop would cascade to the comments.
+			if err := tx.Exec("ALTER TABLE articles ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE SET NULL").Error; err != nil {
+				return err
+			}
+		} else {
+			if err := m.AddColumn(&Article{}, "UserID"); err != nil {
+				return err
+			}
+			if err := m.CreateConstraint(&Article{}, "User"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, table := range []interface{}{&RecoveryCode{}, &SocialLink{}, &UserIdentity{}, &LoginAttempt{}, &PersonalAccessToken{}} {
+		if m.HasTable(table) {
+			continue
+		}
+		if err := m.CreateTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAccountsDown drops the columns with ALTER TABLE, like addVersionColumnsDown.
+func addAccountsDown(tx *gorm.DB) error {
+	for _, table := range accountTables {
+		if err := tx.Migrator().DropTable(table); err != nil {
+			return err
+		}
+	}
+
+	if tx.Dialector.Name() != "sqlite" {
+		if err := tx.Migrator().DropConstraint("articles", "fk_articles_user"); err != nil {
+			return err
+		}
+	}
+	if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "articles"}, clause.Column{Name: "user_id"}).Error; err != nil {
+		return err
+	}
+
+	for _, column := range accountColumns {
+		name := tx.NamingStrategy.ColumnName("users", column)
+		if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: name}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillCommentCountUp sets the comment count of every article, which was not maintained before.
+func backfillCommentCountUp(tx *gorm.DB) error {
+	return tx.Exec("UPDATE articles SET comment_count = " +
+		"(SELECT COUNT(*) FROM comments WHERE comments.article_id = articles.id AND comments.deleted_at IS NULL)").Error
+}
+
+// versionedTables are the tables with a version column for optimistic concurrency control.
+var versionedTables = []string{"articles", "categories", "users"}
+
+// addVersionColumnsUp adds the version columns, existing rows start at version 1.
+func addVersionColumnsUp(tx *gorm.DB) error {
+	type Versioned struct {
+		Version uint `gorm:"not null;default:1"`
+	}
+	for _, table := range versionedTables {
+		if err := tx.Table(table).Migrator().AddColumn(&Versioned{}, "Version"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addVersionColumnsDown drops the version columns with ALTER TABLE, since the SQLite migrator would recreate
+// the tables, which fails while other tables reference their rows.
+func addVersionColumnsDown(tx *gorm.DB) error {
+	for _, table := range versionedTables {
+		if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: "version"}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listIndexes are the indexes of the list queries, whose filters and sorts the repository schemas allow.
+// Every list ends its order with the ID, which keeps the keyset conditions on the same index.
+var listIndexes = []struct {
+	Table, Name, Columns string
+}{
+	// The default order of the lists
+	{"articles", "idx_articles_created_at", "created_at, id"},
+	{"comments", "idx_comments_created_at", "created_at, id"},
+	{"users", "idx_users_created_at", "created_at, id"},
+	// Articles of an author and of a category, and the most read and commented articles
+	{"articles", "idx_articles_user_id_created_at", "user_id, created_at"},
+	{"article_categories", "idx_article_categories_category_id", "category_id, article_id"},
+	{"articles", "idx_articles_read_count", "read_count, id"},
+	{"articles", "idx_articles_comment_count", "comment_count, id"},
+	// Comments of an article and of a user
+	{"comments", "idx_comments_article_id_created_at", "article_id, created_at"},
+	{"comments", "idx_comments_user_id_created_at", "user_id, created_at"},
+}
+
+func addListIndexesUp(tx *gorm.DB) error {
+	for _, index := range listIndexes {
+		if err := tx.Exec("CREATE INDEX " + index.Name + " ON " + index.Table + " (" + index.Columns + ")").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addListIndexesDown(tx *gorm.DB) error {
+	for _, index := range listIndexes {
+		if err := tx.Migrator().DropIndex(index.Table, index.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditEventIndexes are the indexes of the audit trail: the default order, and the events of an actor and of a
+// resource.
+var auditEventIndexes = []struct {
+	Name, Columns string
+}{
+	{"idx_audit_events_created_at", "created_at, id"},
+	{"idx_audit_events_actor_id_created_at", "actor_id, created_at"},
+	{"idx_audit_events_resource_created_at", "resource_type, resource_id, created_at"},
+}
+
+// addAuditEventsUp creates the audit trail of the changes.
+func addAuditEventsUp(tx *gorm.DB) error {
+	type AuditEvent struct {
+		ID           uint      `gorm:"primarykey"`
+		CreatedAt    time.Time `gorm:"not null"`
+		ActorID      *uint
+		ActorName    string `gorm:"size:20"`
+		Action       string `gorm:"size:20;not null"`
+		ResourceType string `gorm:"size:20;not null"`
+		ResourceID   uint   `gorm:"not null"`
+		Changes      string `gorm:"type:text"`
+		IP           string `gorm:"size:45"`
+		RequestID    string `gorm:"size:128"`
+	}
+	if err := tx.AutoMigrate(&AuditEvent{}); err != nil {
+		return err
+	}
+	for _, index := range auditEventIndexes {
+		if err := tx.Exec("CREATE INDEX " + index.Name + " ON audit_events (" + index.Columns + ")").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addAuditEventsDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable("audit_events")
+}
+
+// addTOTPLastStepUp adds the time step of the last accepted two-factor code, so that codes cannot be replayed.
+func addTOTPLastStepUp(tx *gorm.DB) error {
+	type User struct {
+		TOTPLastStep int64 `gorm:"not null;default:0"`
+	}
+	return tx.Migrator().AddColumn(&User{}, "TOTPLastStep")
+}
+
+// addTOTPLastStepDown drops the column with ALTER TABLE, like addVersionColumnsDown.
+func addTOTPLastStepDown(tx *gorm.DB) error {
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: "totp_last_step"}).Error
+}
+
+// promoteFirstAdminUp makes the oldest user admin if there is no admin, which databases from before the roles
+// lack, since only sign ups on an empty database make admins.
+func promoteFirstAdminUp(tx *gorm.DB) error {
+	var admins int64
+	if err := tx.Table("users").Where("role = ? AND deleted_at IS NULL", "admin").Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+	var ids []uint
+	if err := tx.Table("users").Where("deleted_at IS NULL").Order("id").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Table("users").Where("id = ?", ids[0]).Update("role", "admin").Error
+}
+
+// addTokenVersionUp adds the version of the user's tokens, which a password change increments to revoke them.
+func addTokenVersionUp(tx *gorm.DB) error {
+	type User struct {
+		TokenVersion uint `gorm:"not null;default:0"`
+	}
+	return tx.Migrator().AddColumn(&User{}, "TokenVersion")
+}
+
+// addTokenVersionDown drops the column with ALTER TABLE, like addVersionColumnsDown.
+func addTokenVersionDown(tx *gorm.DB) error {
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: "token_version"}).Error
+}
+
+func noop(*gorm.DB) error {
+	return nil
+}
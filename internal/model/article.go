@@ -8,13 +8,19 @@ import (
 
 type Article struct {
 	gorm.Model
-	Title        string    `gorm:"type:varchar(100);not null" json:"title"`
-	Content      string    `gorm:"type:longtext" json:"content"`
-	CreatedAt    time.Time `gorm:"type:datetime;not null" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"type:datetime;not null" json:"updated_at"`
-	CommentCount int       `gorm:"type:int;not null;default:0" json:"comment_count"`
-	ReadCount    int       `gorm:"type:int;not null;default:0" json:"read_count"`
+	Title        string    `gorm:"size:100;not null" json:"title"`
+	Content      string    `json:"content"`
+	CreatedAt    time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
+	CommentCount int       `gorm:"not null;default:0" json:"comment_count"`
+	ReadCount    int       `gorm:"not null;default:0" json:"read_count"`
+	// Version counts the edits, for optimistic concurrency control.
+	Version uint `gorm:"not null;default:1" json:"version"`
+
+	// User is the author. Articles written before authors were recorded have none.
+	User   *User `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL" json:"user,omitempty"`
+	UserID *uint `json:"user_id"`
 
 	Comments   []*Comment  `json:"comments"`
-	Categories []*Category `gorm:"many2many:article_categories;"`
+	Categories []*Category `gorm:"many2many:article_categories"`
 }
@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// Actions of the audit events.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	// AuditPasswordChange is a new password of a user, which the snapshots leave out.
+	AuditPasswordChange = "password_change"
+	// AuditTOTPEnable and AuditTOTPDisable turn two-factor authentication of a user on and off.
+	AuditTOTPEnable  = "totp_enable"
+	AuditTOTPDisable = "totp_disable"
+	// AuditTOTPRecoveryCodes replaces the recovery codes of a user, which the snapshots leave out.
+	AuditTOTPRecoveryCodes = "totp_recovery_codes"
+	// AuditUnlock removes the login lockout of a username and/or a client IP, which are the changes of the event.
+	AuditUnlock = "unlock"
+)
+
+// Resource types of the audit events.
+const (
+	AuditArticle  = "article"
+	AuditCategory = "category"
+	AuditComment  = "comment"
+	AuditUser     = "user"
+	// AuditIdentity is a provider account linked to a user.
+	AuditIdentity = "identity"
+	// AuditAccessToken is a personal access token of a user.
+	AuditAccessToken = "access_token"
+	// AuditLockout is the login lockout, which has no ID.
+	AuditLockout = "lockout"
+)
+
+// AuditEvent records a change of a resource: who made it, when and from where, and the fields it changed.
+// Events are only added. The actor has no foreign key, so that the events of deleted users are kept, with the
+// username they had.
+type AuditEvent struct {
+	ID           uint      `gorm:"primarykey"`
+	CreatedAt    time.Time `gorm:"not null"`
+	ActorID      *uint
+	ActorName    string `gorm:"size:20"`
+	Action       string `gorm:"size:20;not null"`
+	ResourceType string `gorm:"size:20;not null"`
+	ResourceID   uint   `gorm:"not null"`
+	// Changes is a JSON object of the changed fields with their values before and after the change.
+	Changes   string `gorm:"type:text"`
+	IP        string `gorm:"size:45"`
+	RequestID string `gorm:"size:128"`
+}
@@ -4,7 +4,9 @@ import "gorm.io/gorm"
 
 type Category struct {
 	gorm.Model
-	Name string `gorm:"type:varchar(50);not null" json:"name"`
+	Name string `gorm:"size:50;not null" json:"name"`
+	// Version counts the edits, for optimistic concurrency control.
+	Version uint `gorm:"not null;default:1" json:"version"`
 
-	Articles []*Article `gorm:"many2many:article_categories;"`
+	Articles []*Article `gorm:"many2many:article_categories"`
 }
@@ -8,12 +8,12 @@ import (
 
 type Comment struct {
 	gorm.Model
-	Content   string    `gorm:"type:varchar(500);not null;" json:"content"`
-	CreatedAt time.Time `gorm:"type:datetime;not null" json:"created_at"`
-	UpdatedAt time.Time `gorm:"type:datetime;not null" json:"updated_at"`
+	Content   string    `gorm:"size:500;not null" json:"content"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
 
 	Article   *Article `gorm:"foreignKey:ArticleID;constraint:OnDelete:CASCADE" json:"article"`
-	ArticleID uint     `gorm:"type:int;not null" json:"article_id"`
+	ArticleID uint     `gorm:"not null" json:"article_id"`
 	User      *User    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user"`
-	UserID    uint     `gorm:"type:int;not null" json:"user_id"`
+	UserID    uint     `gorm:"not null" json:"user_id"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginAttempt counts the failed logins of a username or client IP, when the lockout state is shared through the database.
+type LoginAttempt struct {
+	ID            uint   `gorm:"primarykey"`
+	Key           string `gorm:"column:attempt_key;size:191;not null;uniqueIndex"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt *time.Time
+	BlockedUntil  *time.Time
+	UpdatedAt     time.Time
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes that can be granted to personal access tokens.
+const (
+	ScopeArticlesWrite   = "articles:write"
+	ScopeCategoriesWrite = "categories:write"
+	ScopeCommentsWrite   = "comments:write"
+	ScopeMediaWrite      = "media:write"
+)
+
+var Scopes = []string{ScopeArticlesWrite, ScopeCategoriesWrite, ScopeCommentsWrite, ScopeMediaWrite}
+
+// PersonalAccessToken is a long-lived token for automation, limited to a set of scopes.
+// Only the hash of the token is stored.
+type PersonalAccessToken struct {
+	gorm.Model
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	TokenPrefix string     `gorm:"size:20;not null" json:"token_prefix"`
+	Scopes      string     `gorm:"size:255;not null" json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+
+	User   *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID uint  `gorm:"not null;index" json:"user_id"`
+}
+
+// ScopeList splits the comma separated scopes.
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
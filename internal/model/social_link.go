@@ -0,0 +1,12 @@
+package model
+
+import "gorm.io/gorm"
+
+// SocialLink is a link to one of a user's accounts elsewhere, shown on the public profile.
+type SocialLink struct {
+	gorm.Model
+	Platform string `gorm:"size:30;not null" json:"platform"`
+	URL      string `gorm:"size:255;not null" json:"url"`
+
+	UserID uint `gorm:"not null;index" json:"-"`
+}
@@ -6,14 +6,40 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	gorm.Model
-	Username string `gorm:"type:varchar(20);not null;unique" json:"username" validate:"required,min=4,max=12"`
-	Password string `gorm:"type:varchar(64);not null" json:"password" validate:"required,min=4,max=32"`
-	Email    string `gorm:"type:varchar(100);not null;unique" json:"email" validate:"required,email"`
+	Username string `gorm:"size:20;not null;unique" json:"username"`
+	Password string `gorm:"size:64;not null" json:"-"`
+	Email    string `gorm:"size:100;not null;unique" json:"email"`
+	Role     string `gorm:"size:20;not null;default:user" json:"role"`
+
+	DisplayName string `gorm:"size:50" json:"display_name"`
+	Bio         string `gorm:"size:500" json:"bio"`
+	AvatarURL   string `gorm:"size:255" json:"avatar_url"`
+	Website     string `gorm:"size:255" json:"website"`
+
+	Disabled              bool   `gorm:"not null;default:false" json:"disabled,omitempty"`
+	DisabledReason        string `gorm:"size:200" json:"disabled_reason,omitempty"`
+	PasswordResetRequired bool   `gorm:"not null;default:false" json:"password_reset_required,omitempty"`
+	// TokenVersion counts the password changes and forced resets, tokens of an earlier version are rejected.
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+	// Version counts the edits of the username and email, for optimistic concurrency control.
+	Version uint `gorm:"not null;default:1" json:"version"`
 
-	CreatedAt   time.Time `gorm:"type:datetime;not null" json:"created_at"`
-	LastLoginAt time.Time `gorm:"type:datetime" json:"last_login_at"`
+	TOTPSecret  string `gorm:"size:64" json:"-"`
+	TOTPEnabled bool   `gorm:"not null;default:false" json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, codes of this step or earlier are rejected.
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
 
-	Comments []*Comment `json:"comments"`
+	Comments      []*Comment      `json:"comments"`
+	RecoveryCodes []*RecoveryCode `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	SocialLinks   []*SocialLink   `gorm:"constraint:OnDelete:CASCADE" json:"social_links,omitempty"`
 }
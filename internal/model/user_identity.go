@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+// UserIdentity links a user to an account at an external OAuth2 or OpenID Connect provider.
+type UserIdentity struct {
+	gorm.Model
+	Provider string `gorm:"size:50;not null;uniqueIndex:idx_provider_subject" json:"provider"`
+	Subject  string `gorm:"size:255;not null;uniqueIndex:idx_provider_subject" json:"subject"`
+	Email    string `gorm:"size:100" json:"email"`
+
+	User   *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID uint  `gorm:"not null;index" json:"user_id"`
+}
@@ -0,0 +1,316 @@
+package oauth
+
+import (
+	"blog-go/config"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProviderNotExist = errors.New("oauth provider does not exist")
+	ErrStateWrong       = errors.New("oauth state is wrong or expired")
+)
+
+// Identity is the external account returned by a provider.
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Username string
+}
+
+// Login is a finished login at a provider.
+type Login struct {
+	Identity
+	// LinkUserID is the user who started the login to link the identity to their account, or 0 for a sign in.
+	LinkUserID uint
+}
+
+// Provider runs the authorization code flow with PKCE against one OAuth2 or OpenID Connect provider.
+//
+// OpenID Connect providers are used like plain OAuth2 providers: the identity comes from the userinfo endpoint with
+// the access token, which the token endpoint returned to the confidential client over TLS. The id_token is not
+// requested to be valid and is ignored, so that both kinds of providers take the same path.
+type Provider struct {
+	Name   string
+	Config config.OAuthProviderConfig
+
+	client   *http.Client
+	mu       sync.Mutex
+	resolved bool
+	endpoint endpoint
+}
+
+type endpoint struct {
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*Provider{}
+)
+
+// InitProviders registers the providers from the config.
+func InitProviders() {
+	for name, providerConfig := range config.GetOAuthConfig() {
+		Register(name, providerConfig)
+	}
+}
+
+// Register adds or replaces a provider.
+func Register(name string, providerConfig config.OAuthProviderConfig) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = &Provider{
+		Name:   name,
+		Config: providerConfig,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// GetProvider returns a registered provider by name.
+func GetProvider(name string) (*Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, ErrProviderNotExist
+	}
+	return provider, nil
+}
+
+// AuthCodeURL starts a login, and returns the URL the user agent is redirected to and the value of the state
+// cookie, which the user agent has to bring to the callback. A login with a link user ID links the identity to that
+// user instead of signing in.
+func (p *Provider) AuthCodeURL(linkUserID uint) (string, string, error) {
+	ep, err := p.endpoints()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(64)
+	if err != nil {
+		return "", "", err
+	}
+	cookie, err := encodeLogin(pendingLogin{
+		Provider:   p.Name,
+		State:      state,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		ExpiresAt:  time.Now().Add(stateExpiry).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.Config.ClientID)
+	values.Set("redirect_uri", p.Config.RedirectURL)
+	values.Set("state", state)
+	values.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	values.Set("code_challenge_method", "S256")
+	if len(p.Config.Scopes) > 0 {
+		values.Set("scope", strings.Join(p.Config.Scopes, " "))
+	}
+
+	return appendQuery(ep.AuthURL, values), cookie, nil
+}
+
+// Exchange finishes a login with the code and state from the callback and the state cookie, and returns the
+// external identity. The state has to match the cookie, so that nobody can finish their own login in the browser of
+// someone else.
+func (p *Provider) Exchange(code, state, cookie string) (*Login, error) {
+	pending, ok := decodeLogin(cookie, p.Name, state)
+	if !ok {
+		return nil, ErrStateWrong
+	}
+
+	ep, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := p.exchangeCode(ep.TokenURL, code, pending.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.userInfo(ep.UserInfoURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &Login{
+		Identity: Identity{
+			Provider: p.Name,
+			Subject:  claimString(claims, p.Config.SubjectClaim, "sub"),
+			Email:    claimString(claims, p.Config.EmailClaim, "email"),
+			Username: claimString(claims, p.Config.UsernameClaim, "preferred_username"),
+		},
+		LinkUserID: pending.LinkUserID,
+	}
+	if login.Subject == "" {
+		return nil, errors.New("oauth userinfo has no subject")
+	}
+	return login, nil
+}
+
+// endpoints uses the configured URLs, and fills the missing ones from OpenID Connect discovery.
+// A successful discovery is cached, a failed one is retried on the next login.
+func (p *Provider) endpoints() (endpoint, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resolved {
+		return p.endpoint, nil
+	}
+
+	ep := endpoint{
+		AuthURL:     p.Config.AuthURL,
+		TokenURL:    p.Config.TokenURL,
+		UserInfoURL: p.Config.UserInfoURL,
+	}
+	if p.Config.Issuer != "" {
+		var discovered endpoint
+		wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := p.getJSON(wellKnown, "", &discovered); err != nil {
+			return endpoint{}, err
+		}
+		if ep.AuthURL == "" {
+			ep.AuthURL = discovered.AuthURL
+		}
+		if ep.TokenURL == "" {
+			ep.TokenURL = discovered.TokenURL
+		}
+		if ep.UserInfoURL == "" {
+			ep.UserInfoURL = discovered.UserInfoURL
+		}
+	}
+	if ep.AuthURL == "" || ep.TokenURL == "" || ep.UserInfoURL == "" {
+		return endpoint{}, fmt.Errorf("oauth provider %s has incomplete endpoints", p.Name)
+	}
+
+	p.endpoint = ep
+	p.resolved = true
+	return ep, nil
+}
+
+func (p *Provider) exchangeCode(tokenURL, code, verifier string) (string, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.Config.RedirectURL)
+	values.Set("client_id", p.Config.ClientID)
+	values.Set("client_secret", p.Config.ClientSecret)
+	values.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oauth token endpoint returned %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("oauth token endpoint returned no access token: %s", token.Error)
+	}
+	return token.AccessToken, nil
+}
+
+func (p *Provider) userInfo(userInfoURL, accessToken string) (map[string]interface{}, error) {
+	var claims map[string]interface{}
+	if err := p.getJSON(userInfoURL, accessToken, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (p *Provider) getJSON(rawURL, accessToken string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth request to %s returned %s", rawURL, resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	// Keep numeric subjects such as GitHub user ids intact.
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func claimString(claims map[string]interface{}, name, defaultName string) string {
+	if name == "" {
+		name = defaultName
+	}
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return ""
+	}
+}
+
+func appendQuery(rawURL string, values url.Values) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + values.Encode()
+	}
+	return rawURL + "?" + values.Encode()
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b)[:n], nil
+}
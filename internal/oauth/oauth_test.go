@@ -0,0 +1,146 @@
+package oauth
+
+import (
+	"blog-go/config"
+	"blog-go/internal/oauth/oauthtest"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// authorize follows the login URL to the mock provider, and returns the code and state of the callback with the
+// state cookie.
+func authorize(t *testing.T, provider *Provider, linkUserID uint) (string, string, string) {
+	authURL, cookie, err := provider.AuthCodeURL(linkUserID)
+	if err != nil {
+		t.Fatalf("AuthCodeURL Error: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorize Error: %v", err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Authorize Error: %v", resp.Status)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorize Error: %v", err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state"), cookie
+}
+
+func TestExchangeOpenIDConnect(t *testing.T) {
+	mock := oauthtest.NewProvider(map[string]interface{}{
+		"sub":                "subject-1",
+		"email":              "test@email.com",
+		"preferred_username": "tester",
+	})
+	defer mock.Close()
+
+	Register("mock", config.OAuthProviderConfig{
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  "http://localhost/api/oauth/mock/callback",
+		Issuer:       mock.URL,
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	provider, err := GetProvider("mock")
+	if err != nil {
+		t.Fatalf("GetProvider Error: %v", err)
+	}
+
+	code, state, cookie := authorize(t, provider, 0)
+	login, err := provider.Exchange(code, state, cookie)
+	if err != nil {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+	if login.Provider != "mock" || login.Subject != "subject-1" ||
+		login.Email != "test@email.com" || login.Username != "tester" || login.LinkUserID != 0 {
+		t.Fatalf("Exchange Error: %+v", login)
+	}
+
+	// A link keeps the user who started it
+	code, state, cookie = authorize(t, provider, 7)
+	login, err = provider.Exchange(code, state, cookie)
+	if err != nil || login.LinkUserID != 7 {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+}
+
+func TestExchangeOAuth2(t *testing.T) {
+	mock := oauthtest.NewProvider(map[string]interface{}{
+		"id":    12345678901,
+		"login": "octocat",
+	})
+	defer mock.Close()
+
+	Register("github", config.OAuthProviderConfig{
+		ClientID:      mock.ClientID,
+		ClientSecret:  mock.ClientSecret,
+		RedirectURL:   "http://localhost/api/oauth/github/callback",
+		AuthURL:       mock.URL + "/authorize",
+		TokenURL:      mock.URL + "/token",
+		UserInfoURL:   mock.URL + "/userinfo",
+		SubjectClaim:  "id",
+		UsernameClaim: "login",
+	})
+	provider, _ := GetProvider("github")
+
+	code, state, cookie := authorize(t, provider, 0)
+	login, err := provider.Exchange(code, state, cookie)
+	if err != nil {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+	if login.Subject != "12345678901" || login.Username != "octocat" || login.Email != "" {
+		t.Fatalf("Exchange Error: %+v", login)
+	}
+}
+
+func TestExchangeWrongState(t *testing.T) {
+	mock := oauthtest.NewProvider(map[string]interface{}{"sub": "subject-1"})
+	defer mock.Close()
+
+	Register("mock", config.OAuthProviderConfig{
+		ClientID:     mock.ClientID,
+		ClientSecret: "wrong-secret",
+		RedirectURL:  "http://localhost/api/oauth/mock/callback",
+		Issuer:       mock.URL,
+	})
+	provider, _ := GetProvider("mock")
+
+	if _, err := provider.Exchange("code", "unknown-state", ""); err != ErrStateWrong {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+
+	// The state of a callback has to be the one of the cookie, which cannot be changed
+	code, state, cookie := authorize(t, provider, 0)
+	_, otherState, otherCookie := authorize(t, provider, 0)
+	if _, err := provider.Exchange(code, otherState, cookie); err != ErrStateWrong {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+	if _, err := provider.Exchange(code, state, otherCookie); err != ErrStateWrong {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+	if _, err := provider.Exchange(code, state, cookie+"x"); err != ErrStateWrong {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+	// Nor used for another provider
+	Register("other", provider.Config)
+	other, _ := GetProvider("other")
+	if _, err := other.Exchange(code, state, cookie); err != ErrStateWrong {
+		t.Fatalf("Exchange Error: %v", err)
+	}
+
+	if _, err := provider.Exchange(code, state, cookie); err == nil {
+		t.Fatal("Exchange Error: wrong client secret accepted")
+	}
+
+	if _, err := GetProvider("unknown"); err != ErrProviderNotExist {
+		t.Fatalf("GetProvider Error: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"blog-go/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// stateExpiry is how long a user has to finish the login at the provider.
+const stateExpiry = 10 * time.Minute
+
+// StateCookie is the name of the cookie that keeps a pending login in the browser that started it. Handlers set it
+// as HttpOnly and SameSite=Lax, so that scripts cannot read it and the redirect back from the provider still sends it.
+const StateCookie = "oauth_state"
+
+// pendingLogin is what the callback needs of a login that was started: the state, which the callback has to come
+// back with, and the PKCE verifier. It is kept in a cookie instead of on the server, so that the login finishes on
+// any node, and only in the browser that started it.
+type pendingLogin struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Verifier   string `json:"verifier"`
+	LinkUserID uint   `json:"link_user_id,omitempty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// stateKey derives the key of the cookie signatures from the JWT key, so that a cookie is no token and the other way
+// round. It reads the key on every use, since the config is loaded after package initialization.
+func stateKey() []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetServerConfig().JwtKey))
+	mac.Write([]byte("oauth state"))
+	return mac.Sum(nil)
+}
+
+// encodeLogin returns the signed cookie value of a pending login.
+func encodeLogin(login pendingLogin) (string, error) {
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(encoded), nil
+}
+
+// decodeLogin checks a cookie value against the provider and the state of the callback, and returns its pending
+// login. Cookies that were changed, expired or belong to another login are rejected.
+func decodeLogin(cookie, provider, state string) (pendingLogin, bool) {
+	encoded, signature, ok := strings.Cut(cookie, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(encoded))) {
+		return pendingLogin{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return pendingLogin{}, false
+	}
+	var login pendingLogin
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return pendingLogin{}, false
+	}
+	if login.Provider != provider || time.Now().Unix() > login.ExpiresAt ||
+		subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+func sign(encoded string) string {
+	mac := hmac.New(sha256.New, stateKey())
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CookiePath returns the path of the state cookie, which only the callback of the provider needs.
+func (p *Provider) CookiePath() string {
+	redirect, err := url.Parse(p.Config.RedirectURL)
+	if err != nil || redirect.Path == "" {
+		return "/"
+	}
+	return redirect.Path
+}
+
+// CookieSecure reports whether the state cookie is only sent over HTTPS, which is the case if the callback is.
+func (p *Provider) CookieSecure() bool {
+	return strings.HasPrefix(p.Config.RedirectURL, "https://")
+}
+
+// CookieMaxAge is the lifetime of the state cookie in seconds.
+func CookieMaxAge() int {
+	return int(stateExpiry / time.Second)
+}
@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"blog-go/internal/db"
 	"blog-go/internal/model"
 	"blog-go/utils"
 	"errors"
@@ -9,108 +8,85 @@ import (
 	"gorm.io/gorm"
 )
 
-// CreateArticle adds an article to the database, and returns a status code.
-func CreateArticle(article *model.Article) int {
-	err := db.DB.Create(article).Error
+// CreateArticle adds an article to the database, and returns an error.
+func (r *gormArticleRepository) CreateArticle(article *model.Article) error {
+	err := r.db.Create(article).Error
 	if err != nil {
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return nil
 }
 
-// GetArticle gets an article's information from the database, and returns the article and a status code.
-func GetArticle(id int) (*model.Article, int) {
+// GetArticle gets an article's information with the fields and relations of a view from the database, and returns
+// the article and an error. The default view has all fields and the categories.
+func (r *gormArticleRepository) GetArticle(id int, view View) (*model.Article, error) {
+	if err := ArticleSchema.checkView(view, false); err != nil {
+		return nil, err
+	}
 	var article model.Article
-	err := db.DB.Where("id = ?", id).First(&article).Error
+	err := ArticleSchema.selectView(r.db.Where("articles.id = ?", id), view, articleFields, nil).First(&article).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, utils.ErrorArticleNotExist
+			return nil, utils.NewError(utils.ErrorArticleNotExist)
 		}
-		return nil, utils.UnknownErr
-	}
-	return &article, utils.Success
-}
-
-// GetArticleList gets a list of articles from the database, and returns the list and a status code.
-func GetArticleList(pageSize, pageNum int) ([]model.Article, int) {
-	var articles []model.Article
-	err := db.DB.Model(&model.Article{}).
-		Select("id", "title", "created_at", "updated_at", "comment_count", "read_count").
-		Preload("Categories").
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&articles).Error
-	if err != nil {
-		return nil, utils.UnknownErr
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return articles, utils.Success
+	return &article, nil
 }
 
-// GetArticleListByCategory gets a list of articles from the database by category, and returns the list and a status code.
-func GetArticleListByCategory(categoryId, pageSize, pageNum int) ([]model.Article, int) {
-	var articles []model.Article
-	err := db.DB.Select("articles.id", "title", "articles.created_at", "articles.updated_at", "comment_count", "read_count").
-		Joins("JOIN article_categories on article_categories.article_id=articles.id").
-		Joins("JOIN categories on categories.id=article_categories.category_id").
-		Preload("Categories").
-		Where("categories.id = ?", categoryId).
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&articles).Error
-	if err != nil {
-		return nil, utils.UnknownErr
-	}
-	return articles, utils.Success
+// GetArticleList gets a page of the articles that match a query from the database, and returns the list and an error.
+// The default view leaves out the content.
+func (r *gormArticleRepository) GetArticleList(query Query, page Page) (*List[model.Article], error) {
+	return findPage(r.db.Model(&model.Article{}), ArticleSchema, query, page, func(db *gorm.DB) *gorm.DB {
+		return ArticleSchema.selectView(db, query.View, articleListFields, query.order())
+	})
 }
 
-// GetArticleListByTitle gets a list of articles from the database by title, and returns the list and a status code.
-func GetArticleListByTitle(title string, pageSize, pageNum int) ([]model.Article, int) {
-	var articles []model.Article
-	err := db.DB.Select("articles.id", "title", "articles.created_at", "articles.updated_at", "comment_count", "read_count").
-		Joins("JOIN article_categories on article_categories.article_id=articles.id").
-		Joins("JOIN categories on categories.id=article_categories.category_id").
-		Preload("Categories").
-		Where("title like ?", "%"+title+"%").
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&articles).Error
+// CountArticlesByUser counts an author's articles in the database, and returns the count and an error.
+func (r *gormArticleRepository) CountArticlesByUser(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Article{}).Where("user_id = ?", userID).Count(&count).Error
 	if err != nil {
-		return nil, utils.UnknownErr
+		return 0, utils.WrapError(utils.UnknownErr, err)
 	}
-	return articles, utils.Success
+	return count, nil
 }
 
-// UpdateArticle updates an article in the database, and returns a status code.
-func UpdateArticle(id int, data *model.Article) int {
-	var article model.Article
-	err := db.DB.Where("id = ?", id).First(&article).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorArticleNotExist
+// UpdateArticle replaces the title, content and categories of an article in the database, and returns an error.
+func (r *gormArticleRepository) UpdateArticle(id int, data *model.Article) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		err := updateVersioned(tx, &model.Article{}, id, data.Version, map[string]interface{}{
+			"title":   data.Title,
+			"content": data.Content,
+		}, utils.ErrorArticleNotExist)
+		if err != nil {
+			return err
 		}
-		return utils.UnknownErr
-	}
 
-	data.ID = uint(id)
-	err = db.DB.Model(&article).Updates(data).Error
-	if err != nil {
-		return utils.UnknownErr
-	}
-	return utils.Success
+		categories := tx.Model(&model.Article{Model: gorm.Model{ID: uint(id)}}).Association("Categories")
+		if len(data.Categories) == 0 {
+			err = categories.Clear()
+		} else {
+			err = categories.Replace(data.Categories)
+		}
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return nil
+	})
 }
 
-// DeleteArticle deletes an article from the database, and returns a status code.
-func DeleteArticle(id int) int {
-	if err := db.DB.Where("article_id = ?", id).Delete(&model.Comment{}).Error; err != nil {
-		return utils.UnknownErr
-	}
+// DeleteArticle deletes an article from the database, and returns an error.
+func (r *gormArticleRepository) DeleteArticle(id int) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		if err := tx.Where("article_id = ?", id).Delete(&model.Comment{}).Error; err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
 
-	if err := db.DB.Where("id = ?", id).Delete(&model.Article{}).Error; err != nil {
-		return utils.UnknownErr
-	}
+		if err := tx.Where("id = ?", id).Delete(&model.Article{}).Error; err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
 
-	return utils.Success
+		return nil
+	})
 }
@@ -10,271 +10,284 @@ import (
 )
 
 func TestCreateArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test1",
 		Content: "test1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test2",
 		Content: "test2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 }
 
 func TestGetArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test1",
 		Content: "test1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test2",
 		Content: "test2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if _, code := GetArticle(1); code != utils.Success {
+	if _, err := repos.Articles.GetArticle(1, View{}); err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if _, code := GetArticle(2); code != utils.Success {
+	if _, err := repos.Articles.GetArticle(2, View{}); err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if _, code := GetArticle(3); code != utils.ErrorArticleNotExist {
+	if _, err := repos.Articles.GetArticle(3, View{}); !utils.IsCode(err, utils.ErrorArticleNotExist) {
 		t.Fatal("GetArticle failed")
 	}
 }
 
 func TestGetArticleList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
 	db.DB.Create(&model.Category{
 		Name: "test",
 	})
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateArticle(&model.Article{
+		if err := repos.Articles.CreateArticle(&model.Article{
 			Title:      "test" + strconv.Itoa(i),
 			Content:    "test" + strconv.Itoa(i),
 			Categories: []*model.Category{category},
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateArticle failed")
 		}
 	}
 
-	articles, code := GetArticleList(3, 2)
-	if code != utils.Success {
+	articles, err := repos.Articles.GetArticleList(Query{}, Page{Size: 3, Num: 2})
+	if err != nil {
 		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 3 {
+	if len(articles.Items) != 3 {
 		t.Fatal("GetArticleList failed")
 	}
 
-	articles, code = GetArticleList(3, 4)
-	if code != utils.Success {
+	articles, err = repos.Articles.GetArticleList(Query{}, Page{Size: 3, Num: 4})
+	if err != nil {
 		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 1 {
+	if len(articles.Items) != 1 {
 		t.Fatal("GetArticleList failed")
 	}
 }
 
 func TestGetArticleListByCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
 	db.DB.Create(&model.Category{
 		Name: "test",
 	})
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateArticle(&model.Article{
+		if err := repos.Articles.CreateArticle(&model.Article{
 			Title:      "test" + strconv.Itoa(i),
 			Content:    "test" + strconv.Itoa(i),
 			Categories: []*model.Category{category},
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateArticle failed")
 		}
 	}
 
-	articles, code := GetArticleListByCategory(1, 3, 2)
-	if code != utils.Success {
-		t.Fatal("GetArticleListByCategory failed")
+	articles, err := repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "category", Op: OpEq, Value: int64(1)}}}, Page{Size: 3, Num: 2})
+	if err != nil {
+		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 3 {
-		t.Fatal("GetArticleListByCategory failed")
+	if len(articles.Items) != 3 {
+		t.Fatal("GetArticleList failed")
 	}
 
-	articles, code = GetArticleListByCategory(1, 3, 4)
-	if code != utils.Success {
-		t.Fatal("GetArticleListByCategory failed")
+	articles, err = repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "category", Op: OpEq, Value: int64(1)}}}, Page{Size: 3, Num: 4})
+	if err != nil {
+		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 1 {
-		t.Fatal("GetArticleListByCategory failed")
+	if len(articles.Items) != 1 {
+		t.Fatal("GetArticleList failed")
 	}
 
-	articles, code = GetArticleListByCategory(2, 3, 2)
-	if code != utils.Success {
-		t.Fatal("GetArticleListByCategory failed")
+	articles, err = repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "category", Op: OpEq, Value: int64(2)}}}, Page{Size: 3, Num: 2})
+	if err != nil {
+		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 0 {
-		t.Fatal("GetArticleListByCategory failed")
+	if len(articles.Items) != 0 {
+		t.Fatal("GetArticleList failed")
 	}
 }
 
 func TestGetArticleListByTitle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
 	db.DB.Create(&model.Category{
 		Name: "test",
 	})
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateArticle(&model.Article{
+		if err := repos.Articles.CreateArticle(&model.Article{
 			Title:      "test" + strconv.Itoa(i),
 			Content:    "test" + strconv.Itoa(i),
 			Categories: []*model.Category{category},
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateArticle failed")
 		}
 	}
 	for i := 0; i < 10; i++ {
-		if code := CreateArticle(&model.Article{
+		if err := repos.Articles.CreateArticle(&model.Article{
 			Title:      "title" + strconv.Itoa(i),
 			Content:    "test" + strconv.Itoa(i),
 			Categories: []*model.Category{category},
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateArticle failed")
 		}
 	}
 
-	articles, code := GetArticleListByTitle("test", 3, 2)
-	if code != utils.Success {
-		t.Fatal("GetArticleListByTitle failed")
+	articles, err := repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "title", Op: OpContains, Value: "test"}}}, Page{Size: 3, Num: 2})
+	if err != nil {
+		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 3 {
-		t.Fatal("GetArticleListByTitle failed")
+	if len(articles.Items) != 3 {
+		t.Fatal("GetArticleList failed")
 	}
 
-	articles, code = GetArticleListByTitle("test", 3, 4)
-	if code != utils.Success {
-		t.Fatal("GetArticleListByTitle failed")
+	articles, err = repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "title", Op: OpContains, Value: "test"}}}, Page{Size: 3, Num: 4})
+	if err != nil {
+		t.Fatal("GetArticleList failed")
 	}
-	if len(articles) != 1 {
-		t.Fatal("GetArticleListByTitle failed")
+	if len(articles.Items) != 1 {
+		t.Fatal("GetArticleList failed")
 	}
 }
 
 func TestUpdateArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test1",
 		Content: "test1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test2",
 		Content: "test2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
 	article.Title = "test3"
-	if code := UpdateArticle(1, article); code != utils.Success {
+	if err := repos.Articles.UpdateArticle(1, article); err != nil {
 		t.Fatal("UpdateArticle failed")
 	}
 
-	article, code = GetArticle(1)
-	if code != utils.Success {
+	article, err = repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
-	if article.Title != "test3" {
+	if article.Title != "test3" || article.Version != 2 {
+		t.Fatal("UpdateArticle failed")
+	}
+
+	// The version has changed since the article was read.
+	article.Version = 1
+	if err := repos.Articles.UpdateArticle(1, article); !utils.IsCode(err, utils.ErrorVersionConflict) {
 		t.Fatal("UpdateArticle failed")
 	}
 }
 
 func TestDeleteArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:      "test1",
 		Content:    "test1",
 		Categories: []*model.Category{category},
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:      "test2",
 		Content:    "test2",
 		Categories: []*model.Category{category},
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := DeleteArticle(1); code != utils.Success {
+	if err := repos.Articles.DeleteArticle(1); err != nil {
 		t.Fatal("DeleteArticle failed")
 	}
 
-	if _, code := GetArticle(1); code != utils.ErrorArticleNotExist {
+	if _, err := repos.Articles.GetArticle(1, View{}); !utils.IsCode(err, utils.ErrorArticleNotExist) {
 		t.Fatal("DeleteArticle failed")
 	}
 
-	if code := DeleteCategory(1); code != utils.Success {
+	if err := repos.Categories.DeleteCategory(1); err != nil {
 		t.Fatal("DeleteCategory failed")
 	}
 
-	article, code := GetArticle(2)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(2, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 	if len(article.Categories) != 0 {
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// CreateAuditEvent adds an event to the audit trail in the database, and returns an error.
+func (r *gormAuditRepository) CreateAuditEvent(event *model.AuditEvent) error {
+	err := r.db.Create(event).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	return nil
+}
+
+// GetAuditEventList gets a page of the audit events that match a query from the database, and returns the list
+// and an error.
+func (r *gormAuditRepository) GetAuditEventList(query Query, page Page) (*List[model.AuditEvent], error) {
+	return findPage(r.db.Model(&model.AuditEvent{}), AuditEventSchema, query, page, func(query *gorm.DB) *gorm.DB {
+		return query
+	})
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"testing"
+	"time"
+)
+
+func TestAuditEvent(t *testing.T) {
+	config.InitTestConfig()
+
+	for name, repos := range map[string]Repositories{
+		"gorm":   NewGormRepositories(db.DB),
+		"memory": NewMemoryRepositories(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "gorm" {
+				db.InitTestDB()
+				repos = NewGormRepositories(db.DB)
+			}
+
+			admin := uint(1)
+			for _, event := range []model.AuditEvent{
+				{ActorID: &admin, ActorName: "admin", Action: model.AuditCreate, ResourceType: model.AuditArticle, ResourceID: 1, Changes: `{}`},
+				{ActorID: &admin, ActorName: "admin", Action: model.AuditUpdate, ResourceType: model.AuditArticle, ResourceID: 1, Changes: `{}`},
+				{Action: model.AuditCreate, ResourceType: model.AuditUser, ResourceID: 2, Changes: `{}`, RequestID: "signup"},
+			} {
+				if err := repos.AuditEvents.CreateAuditEvent(&event); err != nil || event.ID == 0 {
+					t.Fatal("CreateAuditEvent failed")
+				}
+			}
+
+			events, err := repos.AuditEvents.GetAuditEventList(Query{}, Page{Size: 10, Num: 1})
+			if err != nil || len(events.Items) != 3 || events.Items[0].ResourceType != model.AuditUser {
+				t.Fatal("GetAuditEventList failed")
+			}
+
+			query := Query{Filters: []Filter{
+				{Field: "resource_type", Op: OpEq, Value: model.AuditArticle},
+				{Field: "resource_id", Op: OpEq, Value: int64(1)},
+				{Field: "actor_id", Op: OpEq, Value: int64(admin)},
+			}}
+			events, err = repos.AuditEvents.GetAuditEventList(query, Page{Size: 1, Num: 1, Total: true})
+			if err != nil || len(events.Items) != 1 || *events.Total != 2 || events.Items[0].Action != model.AuditUpdate || events.Next == nil {
+				t.Fatal("GetAuditEventList failed")
+			}
+			events, err = repos.AuditEvents.GetAuditEventList(query, Page{Size: 1, After: events.Next})
+			if err != nil || len(events.Items) != 1 || events.Items[0].Action != model.AuditCreate || events.Next != nil {
+				t.Fatal("GetAuditEventList failed")
+			}
+
+			// Events without an actor do not match a filter on the actor.
+			query = Query{Filters: []Filter{
+				{Field: "actor_id", Op: OpEq, Value: int64(2)},
+			}}
+			if events, err := repos.AuditEvents.GetAuditEventList(query, Page{Size: 10, Num: 1}); err != nil || len(events.Items) != 0 {
+				t.Fatal("GetAuditEventList failed")
+			}
+
+			query = Query{Filters: []Filter{
+				{Field: "created_at", Op: OpGte, Value: time.Now().Add(-time.Hour)},
+				{Field: "request_id", Op: OpEq, Value: "signup"},
+			}}
+			if events, err := repos.AuditEvents.GetAuditEventList(query, Page{Size: 10, Num: 1}); err != nil || len(events.Items) != 1 {
+				t.Fatal("GetAuditEventList failed")
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"blog-go/internal/db"
 	"blog-go/internal/model"
 	"blog-go/utils"
 	"errors"
@@ -9,105 +8,98 @@ import (
 	"gorm.io/gorm"
 )
 
-// CheckCategoryName checks if a category name empty or exists in the database, and returns a status code.
-func CheckCategoryName(id int, name string) int {
+// CheckCategoryName checks if a category name empty or exists in the database, and returns an error.
+func (r *gormCategoryRepository) CheckCategoryName(id int, name string) error {
 	if name == "" {
-		return utils.ErrorCategoryNameEmpty
+		return utils.NewError(utils.ErrorCategoryNameEmpty)
 	}
 	var category model.Category
-	err := db.DB.Where("name = ? AND id <> ?", name, id).First(&category).Error
+	err := r.db.Where("name = ? AND id <> ?", name, id).First(&category).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Success
+			return nil
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.ErrorCategoryNameUsed
+	return utils.NewError(utils.ErrorCategoryNameUsed)
 }
 
-// CreateCategory adds a category to the database, and returns a status code.
-func CreateCategory(category *model.Category) int {
-	if code := CheckCategoryName(-1, category.Name); code != utils.Success {
-		return code
+// CreateCategory adds a category to the database, and returns an error.
+func (r *gormCategoryRepository) CreateCategory(category *model.Category) error {
+	if err := r.CheckCategoryName(-1, category.Name); err != nil {
+		return err
 	}
-	err := db.DB.Create(category).Error
+	err := r.db.Create(category).Error
 	if err != nil {
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return nil
 }
 
-// GetCategory gets a category's information from the database, and returns the category and a status code.
-func GetCategory(id int) (*model.Category, int) {
+// GetCategory gets a category's information from the database, and returns the category and an error.
+func (r *gormCategoryRepository) GetCategory(id int) (*model.Category, error) {
 	var category model.Category
-	err := db.DB.Where("id = ?", id).First(&category).
+	err := r.db.Where("id = ?", id).First(&category).
 		Preload("Articles", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id", "title", "created_at", "updated_at", "comment_count", "read_count")
 		}).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, utils.ErrorCategoryNotExist
+			return nil, utils.NewError(utils.ErrorCategoryNotExist)
 		}
-		return nil, utils.UnknownErr
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return &category, utils.Success
+	return &category, nil
 }
 
-// GetCategoryList gets a list of categories from the database, and returns the list and a status code.
-func GetCategoryList() ([]model.Category, int) {
-	var categories []model.Category
-	err := db.DB.Find(&categories).
-		Preload("Articles", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "title", "created_at", "updated_at", "comment_count", "read_count")
-		}).Error
-	if err != nil {
-		return nil, utils.UnknownErr
-	}
-	return categories, utils.Success
+// GetCategoryList gets a page of categories from the database, and returns the list and an error.
+func (r *gormCategoryRepository) GetCategoryList(query Query, page Page) (*List[model.Category], error) {
+	return findPage(r.db.Model(&model.Category{}), CategorySchema, query, page, func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name", "created_at", "updated_at", "version")
+	})
 }
 
-// UpdateCategory edits a category in the database, and returns a status code.
-func UpdateCategory(id int, data *model.Category) int {
+// UpdateCategory edits a category in the database, and returns an error.
+func (r *gormCategoryRepository) UpdateCategory(id int, data *model.Category) error {
 	var category model.Category
-	err := db.DB.Where("id = ?", id).First(&category).Error
+	err := r.db.Where("id = ?", id).First(&category).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorCategoryNotExist
+			return utils.NewError(utils.ErrorCategoryNotExist)
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
 
-	if code := CheckCategoryName(id, data.Name); code != utils.Success {
-		return code
+	if err := r.CheckCategoryName(id, data.Name); err != nil {
+		return err
 	}
 
-	data.ID = uint(id)
-	err = db.DB.Model(&category).Updates(data).Error
-	if err != nil {
-		return utils.UnknownErr
-	}
-	return utils.Success
+	return updateVersioned(r.db, &model.Category{}, id, data.Version, map[string]interface{}{
+		"name": data.Name,
+	}, utils.ErrorCategoryNotExist)
 }
 
-// DeleteCategory deletes a category from the database, and returns a status code.
-func DeleteCategory(id int) int {
-	var category model.Category
-	err := db.DB.Where("id = ?", id).First(&category).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorCategoryNotExist
+// DeleteCategory deletes a category from the database, and returns an error.
+func (r *gormCategoryRepository) DeleteCategory(id int) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		var category model.Category
+		err := tx.Where("id = ?", id).First(&category).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.NewError(utils.ErrorCategoryNotExist)
+			}
+			return utils.WrapError(utils.UnknownErr, err)
 		}
-		return utils.UnknownErr
-	}
 
-	err = db.DB.Model(&category).Association("Articles").Clear()
-	if err != nil {
-		return utils.UnknownErr
-	}
+		err = tx.Model(&category).Association("Articles").Clear()
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
 
-	err = db.DB.Delete(&category).Error
-	if err != nil {
-		return utils.UnknownErr
-	}
-	return utils.Success
+		err = tx.Delete(&category).Error
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return nil
+	})
 }
@@ -10,159 +10,179 @@ import (
 )
 
 func TestCreateCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{}); code != utils.ErrorCategoryNameEmpty {
+	if err := repos.Categories.CreateCategory(&model.Category{}); !utils.IsCode(err, utils.ErrorCategoryNameEmpty) {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestCreateCategory1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestCreateCategory2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestCreateCategory1",
-	}); code != utils.ErrorCategoryNameUsed {
+	}); !utils.IsCode(err, utils.ErrorCategoryNameUsed) {
 		t.Fatal("CreateCategory failed")
 	}
 }
 
 func TestGetCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestGetCategory1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestGetCategory2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 	if category.Name != "TestGetCategory1" {
 		t.Fatal("GetCategory failed")
 	}
 
-	category, code = GetCategory(2)
-	if code != utils.Success {
+	category, err = repos.Categories.GetCategory(2)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 	if category.Name != "TestGetCategory2" {
 		t.Fatal("GetCategory failed")
 	}
 
-	if _, code = GetCategory(3); code != utils.ErrorCategoryNotExist {
+	if _, err = repos.Categories.GetCategory(3); !utils.IsCode(err, utils.ErrorCategoryNotExist) {
 		t.Fatal("GetCategory failed")
 	}
 }
 
 func TestGetCategoryList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestGetCategoryList1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestGetCategoryList2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	categories, code := GetCategoryList()
-	if code != utils.Success {
+	categories, err := repos.Categories.GetCategoryList(Query{}, Page{Size: 10, Num: 1, Total: true})
+	if err != nil {
 		t.Fatal("GetCategoryList failed")
 	}
-	if len(categories) != 2 {
+	if len(categories.Items) != 2 || *categories.Total != 2 || categories.Next != nil {
 		fmt.Printf("%+v\n", categories)
 		t.Fatal("GetCategoryList failed")
 	}
-	fmt.Printf("%+v\n", categories)
+
+	// A page of one by name, followed by the next page
+	categories, err = repos.Categories.GetCategoryList(Query{Sort: []Sort{{Field: "name"}}}, Page{Size: 1, Num: 1})
+	if err != nil || len(categories.Items) != 1 || categories.Items[0].Name != "TestGetCategoryList1" || categories.Next == nil {
+		t.Fatal("GetCategoryList failed")
+	}
+	categories, err = repos.Categories.GetCategoryList(Query{Sort: []Sort{{Field: "name"}}}, Page{Size: 1, After: categories.Next})
+	if err != nil || len(categories.Items) != 1 || categories.Items[0].Name != "TestGetCategoryList2" || categories.Next != nil {
+		t.Fatal("GetCategoryList failed")
+	}
 }
 
 func TestUpdateCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestUpdateCategory1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestUpdateCategory2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := UpdateCategory(1, &model.Category{
+	if err := repos.Categories.UpdateCategory(1, &model.Category{
 		Name: "TestUpdateCategory3",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("UpdateCategory failed")
 	}
 
-	category, code := GetCategory(1)
-	if code != utils.Success {
+	category, err := repos.Categories.GetCategory(1)
+	if err != nil {
 		t.Fatal("GetCategory failed")
 	}
 	if category.Name != "TestUpdateCategory3" {
 		t.Fatal("UpdateCategory failed")
 	}
 
-	if code := UpdateCategory(1, &model.Category{
+	if err := repos.Categories.UpdateCategory(1, &model.Category{
 		Name: "TestUpdateCategory2",
-	}); code != utils.ErrorCategoryNameUsed {
+	}); !utils.IsCode(err, utils.ErrorCategoryNameUsed) {
+		t.Fatal("UpdateCategory failed")
+	}
+	if err := repos.Categories.UpdateCategory(1, &model.Category{
+		Name:    "TestUpdateCategory4",
+		Version: 1,
+	}); !utils.IsCode(err, utils.ErrorVersionConflict) {
 		t.Fatal("UpdateCategory failed")
 	}
 }
 
 func TestDeleteCategory(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestDeleteCategory1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := CreateCategory(&model.Category{
+	if err := repos.Categories.CreateCategory(&model.Category{
 		Name: "TestDeleteCategory2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateCategory failed")
 	}
 
-	if code := DeleteCategory(1); code != utils.Success {
+	if err := repos.Categories.DeleteCategory(1); err != nil {
 		t.Fatal("DeleteCategory failed")
 	}
 
-	if code := DeleteCategory(1); code != utils.ErrorCategoryNotExist {
+	if err := repos.Categories.DeleteCategory(1); !utils.IsCode(err, utils.ErrorCategoryNotExist) {
 		t.Fatal("DeleteCategory failed")
 	}
 
-	category, code := GetCategory(1)
-	if code != utils.ErrorCategoryNotExist {
+	category, err := repos.Categories.GetCategory(1)
+	if !utils.IsCode(err, utils.ErrorCategoryNotExist) {
 		t.Fatal("DeleteCategory failed")
 	}
 	if category != nil {
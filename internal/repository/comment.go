@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"blog-go/internal/db"
 	"blog-go/internal/model"
 	"blog-go/utils"
 	"errors"
@@ -9,109 +8,127 @@ import (
 	"gorm.io/gorm"
 )
 
-// CreateComment adds a comment to the database, and returns a status code.
-func CreateComment(comment *model.Comment) int {
-	err := db.DB.Create(comment).Error
+// CreateComment adds a comment to the database and counts it on the article, and returns an error.
+func (r *gormCommentRepository) CreateComment(comment *model.Comment) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Article{}).Where("id = ?", comment.ArticleID).
+			UpdateColumn("comment_count", gorm.Expr("comment_count + ?", 1)).Error
+	})
 	if err != nil {
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return nil
 }
 
-// GetComment gets a comment's information from the database, and returns the comment and a status code.
-func GetComment(id int) (*model.Comment, int) {
+// GetComment gets a comment's information with the fields and relations of a view from the database, and returns
+// the comment and an error. The default view has all fields, and the user and the article.
+func (r *gormCommentRepository) GetComment(id int, view View) (*model.Comment, error) {
+	if err := CommentSchema.checkView(view, false); err != nil {
+		return nil, err
+	}
 	var comment model.Comment
-	err := db.DB.Where("id = ?", id).
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email")
-		}).
-		Preload("Article", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "title", "created_at", "updated_at", "comment_count", "read_count")
-		}).
-		First(&comment).Error
+	err := CommentSchema.selectView(r.db.Where("comments.id = ?", id), view, commentFields, nil).First(&comment).Error
 	if err != nil {
-		return nil, utils.UnknownErr
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewError(utils.ErrorCommentNotExist)
+		}
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return &comment, utils.Success
+	return &comment, nil
 }
 
-// GetCommentList gets a list of comments from the database, and returns the list and a status code.
-func GetCommentList(pageSize, pageNum int) ([]*model.Comment, int) {
-	var comments []*model.Comment
-	err := db.DB.Model(&model.Comment{}).
-		Select("id", "content", "created_at", "user_id", "article_id").
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email")
-		}).
-		Preload("Article", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "title", "created_at", "updated_at", "comment_count", "read_count")
-		}).
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&comments).Error
-	if err != nil {
-		return nil, utils.UnknownErr
-	}
-	return comments, utils.Success
+// GetCommentList gets a page of the comments that match a query from the database, and returns the list and an error.
+func (r *gormCommentRepository) GetCommentList(query Query, page Page) (*List[*model.Comment], error) {
+	return findPage(r.db.Model(&model.Comment{}), CommentSchema, query, page, func(db *gorm.DB) *gorm.DB {
+		return CommentSchema.selectView(db, query.View, commentFields, query.order())
+	})
 }
 
-// GetCommentListByArticle gets a list of comments from the database by article, and returns the list and a status code.
-func GetCommentListByArticle(articleId, pageSize, pageNum int) ([]*model.Comment, int) {
-	var comments []*model.Comment
-	err := db.DB.Model(&model.Comment{}).
-		Select("ID", "Content", "CreatedAt", "UserID", "ArticleID").
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email")
-		}).
-		Preload("Article", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "title", "created_at", "updated_at", "comment_count", "read_count")
-		}).
-		Where("article_id = ?", articleId).
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&comments).Error
+// GetCommentUserID gets a comment's user id from the database, and returns the user id and an error.
+func (r *gormCommentRepository) GetCommentUserID(id int) (uint, error) {
+	var comment model.Comment
+	err := r.db.Select("user_id").Where("id = ?", id).First(&comment).Error
 	if err != nil {
-		return nil, utils.UnknownErr
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, utils.NewError(utils.ErrorCommentNotExist)
+		}
+		return 0, utils.WrapError(utils.UnknownErr, err)
 	}
-	return comments, utils.Success
+	return comment.UserID, nil
 }
 
-// GetCommentUserID gets a comment's user id from the database, and returns the user id and a status code.
-func GetCommentUserID(id int) (uint, int) {
-	var comment model.Comment
-	err := db.DB.Select("user_id").Where("id = ?", id).First(&comment).Error
+// CountCommentsByUser counts a user's comments in the database, and returns the count and an error.
+func (r *gormCommentRepository) CountCommentsByUser(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Comment{}).Where("user_id = ?", userID).Count(&count).Error
 	if err != nil {
-		return 0, utils.UnknownErr
+		return 0, utils.WrapError(utils.UnknownErr, err)
 	}
-	return comment.UserID, utils.Success
+	return count, nil
 }
 
-// UpdateComment edits a comment in the database, and returns a status code.
-func UpdateComment(id int, data *model.Comment) int {
+// UpdateComment edits a comment in the database, and returns an error.
+func (r *gormCommentRepository) UpdateComment(id int, data *model.Comment) error {
 	var comment model.Comment
-	err := db.DB.Where("id = ?", id).First(&comment).Error
+	err := r.db.Where("id = ?", id).First(&comment).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorCommentNotExist
+			return utils.NewError(utils.ErrorCommentNotExist)
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
 
 	comment.ID = uint(id)
-	err = db.DB.Model(&comment).Updates(data).Error
+	err = r.db.Model(&comment).Updates(data).Error
 	if err != nil {
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return nil
 }
 
-// DeleteComment deletes a comment from the database, and returns a status code.
-func DeleteComment(id int) int {
-	err := db.DB.Delete(&model.Comment{}, id).Error
+// DeleteComment deletes a comment from the database and uncounts it on the article, and returns an error.
+func (r *gormCommentRepository) DeleteComment(id int) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var comment model.Comment
+		if err := tx.Select("id", "article_id").Where("id = ?", id).First(&comment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Article{}).Where("id = ?", comment.ArticleID).
+			UpdateColumn("comment_count", gorm.Expr("comment_count - ?", 1)).Error
+	})
 	if err != nil {
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	return nil
+}
+
+// deleteUserComments deletes a user's comments and recounts the comments of their articles.
+func deleteUserComments(tx *gorm.DB, userID int, unscoped bool) error {
+	var articleIDs []uint
+	if err := tx.Model(&model.Comment{}).Where("user_id = ?", userID).Distinct().Pluck("article_id", &articleIDs).Error; err != nil {
+		return err
 	}
-	return utils.Success
+
+	query := tx
+	if unscoped {
+		query = tx.Unscoped()
+	}
+	if err := query.Where("user_id = ?", userID).Delete(&model.Comment{}).Error; err != nil {
+		return err
+	}
+	if len(articleIDs) == 0 {
+		return nil
+	}
+
+	return tx.Model(&model.Article{}).Where("id IN ?", articleIDs).
+		UpdateColumn("comment_count", tx.Model(&model.Comment{}).Select("COUNT(*)").Where("comments.article_id = articles.id")).Error
 }
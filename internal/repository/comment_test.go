@@ -10,82 +10,84 @@ import (
 )
 
 func TestCreateComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test",
 		Content: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test",
 		User:    user,
 		Article: article,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 }
 
 func TestGetComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test",
 		Content: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test",
 		User:    user,
 		Article: article,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 
-	comment, code := GetComment(1)
-	if code != utils.Success {
+	comment, err := repos.Comments.GetComment(1, View{})
+	if err != nil {
 		t.Fatal("GetComment failed")
 	}
 	if comment == nil {
@@ -94,221 +96,229 @@ func TestGetComment(t *testing.T) {
 }
 
 func TestGetCommentList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test",
 		Content: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateComment(&model.Comment{
+		if err := repos.Comments.CreateComment(&model.Comment{
 			Content: "test" + strconv.Itoa(i),
 			User:    user,
 			Article: article,
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateComment failed")
 		}
 	}
 
-	comments, code := GetCommentList(3, 2)
-	if code != utils.Success {
+	comments, err := repos.Comments.GetCommentList(Query{}, Page{Size: 3, Num: 2})
+	if err != nil {
 		t.Fatal("GetCommentList failed")
 	}
-	if len(comments) != 3 {
+	if len(comments.Items) != 3 {
 		t.Fatal("GetCommentList failed")
 	}
 
-	comments, code = GetCommentList(3, 4)
-	if code != utils.Success {
+	comments, err = repos.Comments.GetCommentList(Query{}, Page{Size: 3, Num: 4})
+	if err != nil {
 		t.Fatal("GetCommentList failed")
 	}
-	if len(comments) != 1 {
+	if len(comments.Items) != 1 {
 		t.Fatal("GetCommentList failed")
 	}
 }
 
 func TestGetCommentListByArticle(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test1",
 		Content: "test1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test2",
 		Content: "test2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article1, code := GetArticle(1)
-	if code != utils.Success {
+	article1, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	article2, code := GetArticle(2)
-	if code != utils.Success {
+	article2, err := repos.Articles.GetArticle(2, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateComment(&model.Comment{
+		if err := repos.Comments.CreateComment(&model.Comment{
 			Content: "test1" + strconv.Itoa(i),
 			User:    user,
 			Article: article1,
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateComment failed")
 		}
-		if code := CreateComment(&model.Comment{
+		if err := repos.Comments.CreateComment(&model.Comment{
 			Content: "test2" + strconv.Itoa(i),
 			User:    user,
 			Article: article2,
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateComment failed")
 		}
 	}
 
-	comments, code := GetCommentListByArticle(1, 3, 2)
-	if code != utils.Success {
-		t.Fatal("GetCommentListByArticle failed")
+	comments, err := repos.Comments.GetCommentList(Query{Filters: []Filter{{Field: "article_id", Op: OpEq, Value: int64(1)}}}, Page{Size: 3, Num: 2})
+	if err != nil {
+		t.Fatal("GetCommentList failed")
 	}
-	if len(comments) != 3 {
-		t.Fatal("GetCommentListByArticle failed")
+	if len(comments.Items) != 3 {
+		t.Fatal("GetCommentList failed")
 	}
 
-	comments, code = GetCommentListByArticle(1, 3, 4)
-	if code != utils.Success {
-		t.Fatal("GetCommentListByArticle failed")
+	comments, err = repos.Comments.GetCommentList(Query{Filters: []Filter{{Field: "article_id", Op: OpEq, Value: int64(1)}}}, Page{Size: 3, Num: 4})
+	if err != nil {
+		t.Fatal("GetCommentList failed")
 	}
-	if len(comments) != 1 {
-		t.Fatal("GetCommentListByArticle failed")
+	if len(comments.Items) != 1 {
+		t.Fatal("GetCommentList failed")
 	}
 }
 
 func TestGetCommentUserID(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test",
 		Content: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test",
 		User:    user,
 		Article: article,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 
-	userId, code := GetCommentUserID(1)
-	if code != utils.Success {
+	userId, err := repos.Comments.GetCommentUserID(1)
+	if err != nil {
 		t.Fatal("GetCommentUserID failed")
 	}
 	if userId != 1 {
 		t.Fatal("GetCommentUserID failed")
 	}
+
+	if _, err := repos.Comments.GetCommentUserID(2); !utils.IsCode(err, utils.ErrorCommentNotExist) {
+		t.Fatal("GetCommentUserID failed")
+	}
 }
 
 func TestUpdateComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test",
 		Content: "test",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article, code := GetArticle(1)
-	if code != utils.Success {
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test",
 		User:    user,
 		Article: article,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 
-	comment, code := GetComment(1)
-	if code != utils.Success {
+	comment, err := repos.Comments.GetComment(1, View{})
+	if err != nil {
 		t.Fatal("GetComment failed")
 	}
 	if comment == nil {
@@ -316,12 +326,12 @@ func TestUpdateComment(t *testing.T) {
 	}
 
 	comment.Content = "test2"
-	if code := UpdateComment(1, comment); code != utils.Success {
+	if err := repos.Comments.UpdateComment(1, comment); err != nil {
 		t.Fatal("UpdateComment failed")
 	}
 
-	comment, code = GetComment(1)
-	if code != utils.Success {
+	comment, err = repos.Comments.GetComment(1, View{})
+	if err != nil {
 		t.Fatal("GetComment failed")
 	}
 	if comment.Content != "test2" {
@@ -330,91 +340,113 @@ func TestUpdateComment(t *testing.T) {
 }
 
 func TestDeleteComment(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "test",
 		Email:    "test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test1",
 		Content: "test1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	if code := CreateArticle(&model.Article{
+	if err := repos.Articles.CreateArticle(&model.Article{
 		Title:   "test2",
 		Content: "test2",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateArticle failed")
 	}
 
-	article1, code := GetArticle(1)
-	if code != utils.Success {
+	article1, err := repos.Articles.GetArticle(1, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	article2, code := GetArticle(2)
-	if code != utils.Success {
+	article2, err := repos.Articles.GetArticle(2, View{})
+	if err != nil {
 		t.Fatal("GetArticle failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test1",
 		User:    user,
 		Article: article1,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test2",
 		User:    user,
 		Article: article1,
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateComment failed")
 	}
 
-	if code := CreateComment(&model.Comment{
+	if err := repos.Comments.CreateComment(&model.Comment{
 		Content: "test3",
 		User:    user,
 		Article: article2,
-	}); code != utils.Success {
+	}); err != nil {
+		t.Fatal("CreateComment failed")
+	}
+
+	if article, _ := repos.Articles.GetArticle(1, View{}); article.CommentCount != 2 {
 		t.Fatal("CreateComment failed")
 	}
 
-	if code := DeleteComment(1); code != utils.Success {
+	if err := repos.Comments.DeleteComment(1); err != nil {
 		t.Fatal("DeleteComment failed")
 	}
 
-	if _, code := GetComment(1); code == utils.Success {
+	if _, err := repos.Comments.GetComment(1, View{}); !utils.IsCode(err, utils.ErrorCommentNotExist) {
 		t.Fatal("DeleteComment failed")
 	}
 
-	if code := DeleteArticle(1); code != utils.Success {
+	if article, _ := repos.Articles.GetArticle(1, View{}); article.CommentCount != 1 {
+		t.Fatal("DeleteComment failed")
+	}
+
+	if err := repos.Articles.DeleteArticle(1); err != nil {
 		t.Fatal("DeleteUser failed")
 	}
 
-	if _, code := GetComment(2); code == utils.Success {
+	if _, err := repos.Comments.GetComment(2, View{}); !utils.IsCode(err, utils.ErrorCommentNotExist) {
 		t.Fatal("DeleteComment failed")
 	}
 
-	if code := DeleteUser(1); code != utils.Success {
+	// The last admin cannot be deleted, so there is another one
+	admin := model.User{Username: "admin", Email: "admin@email.com", Password: "TestPassword"}
+	if err := repos.Users.CreateUser(&admin); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+	if err := repos.Users.UpdateUserRole(int(admin.ID), model.RoleAdmin); err != nil {
+		t.Fatal("UpdateUserRole failed")
+	}
+
+	if err := repos.Users.DeleteUser(1); err != nil {
 		t.Fatal("DeleteUser failed")
 	}
 
-	if _, code := GetComment(3); code == utils.Success {
+	if _, err := repos.Comments.GetComment(3, View{}); !utils.IsCode(err, utils.ErrorCommentNotExist) {
 		t.Fatal("DeleteComment failed")
 	}
+
+	if article, _ := repos.Articles.GetArticle(2, View{}); article.CommentCount != 0 {
+		t.Fatal("DeleteUser failed")
+	}
 }
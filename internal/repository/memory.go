@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"context"
+	"sync"
+)
+
+// memoryStore keeps all data of the in-memory repositories. It behaves like the GORM repositories,
+// including the columns they select, so that handlers can be tested without a database.
+type memoryStore struct {
+	mu   sync.Mutex
+	txMu sync.Mutex
+	memoryData
+}
+
+type memoryData struct {
+	lastID map[string]uint
+
+	articles          map[uint]*model.Article
+	articleCategories map[uint][]uint
+	categories        map[uint]*model.Category
+	comments          map[uint]*model.Comment
+	users             map[uint]*model.User
+	recoveryCodes     map[uint]*model.RecoveryCode
+	socialLinks       map[uint][]model.SocialLink
+	identities        map[uint]*model.UserIdentity
+	tokens            map[uint]*model.PersonalAccessToken
+	auditEvents       map[uint]*model.AuditEvent
+}
+
+type memoryTransactor struct {
+	s      *memoryStore
+	nested bool
+}
+type memoryArticleRepository struct{ s *memoryStore }
+type memoryCategoryRepository struct{ s *memoryStore }
+type memoryCommentRepository struct{ s *memoryStore }
+type memoryUserRepository struct{ s *memoryStore }
+type memoryAccessTokenRepository struct{ s *memoryStore }
+type memoryIdentityRepository struct{ s *memoryStore }
+type memoryAuditRepository struct{ s *memoryStore }
+
+// NewMemoryRepositories creates empty repositories that keep the data in memory, for tests.
+func NewMemoryRepositories() Repositories {
+	s := &memoryStore{memoryData: memoryData{
+		lastID:            map[string]uint{},
+		articles:          map[uint]*model.Article{},
+		articleCategories: map[uint][]uint{},
+		categories:        map[uint]*model.Category{},
+		comments:          map[uint]*model.Comment{},
+		users:             map[uint]*model.User{},
+		recoveryCodes:     map[uint]*model.RecoveryCode{},
+		socialLinks:       map[uint][]model.SocialLink{},
+		identities:        map[uint]*model.UserIdentity{},
+		tokens:            map[uint]*model.PersonalAccessToken{},
+		auditEvents:       map[uint]*model.AuditEvent{},
+	}}
+	return s.repositories(false)
+}
+
+func (s *memoryStore) repositories(inTransaction bool) Repositories {
+	return Repositories{
+		Transactor:   &memoryTransactor{s: s, nested: inTransaction},
+		Contexter:    &memoryTransactor{s: s, nested: inTransaction},
+		Articles:     &memoryArticleRepository{s: s},
+		Categories:   &memoryCategoryRepository{s: s},
+		Comments:     &memoryCommentRepository{s: s},
+		Users:        &memoryUserRepository{s: s},
+		AccessTokens: &memoryAccessTokenRepository{s: s},
+		Identities:   &memoryIdentityRepository{s: s},
+		AuditEvents:  &memoryAuditRepository{s: s},
+	}
+}
+
+// WithContext returns the same repositories, since the store does not wait for anything.
+func (t *memoryTransactor) WithContext(context.Context) Repositories {
+	return t.s.repositories(t.nested)
+}
+
+// Transaction restores the data from before fn if fn fails. Transactions run one at a time,
+// but a rollback also discards the writes made outside of the transaction meanwhile, which is fine for tests.
+func (t *memoryTransactor) Transaction(fn func(repos Repositories) error) error {
+	if !t.nested {
+		t.s.txMu.Lock()
+		defer t.s.txMu.Unlock()
+	}
+
+	t.s.mu.Lock()
+	saved := t.s.memoryData.clone()
+	t.s.mu.Unlock()
+
+	err := fn(t.s.repositories(true))
+	if err != nil {
+		t.s.mu.Lock()
+		t.s.memoryData = saved
+		t.s.mu.Unlock()
+		return utils.AsAppError(err)
+	}
+	return nil
+}
+
+func (d memoryData) clone() memoryData {
+	c := memoryData{
+		lastID:            make(map[string]uint, len(d.lastID)),
+		articles:          cloneRows(d.articles),
+		articleCategories: make(map[uint][]uint, len(d.articleCategories)),
+		categories:        cloneRows(d.categories),
+		comments:          cloneRows(d.comments),
+		users:             cloneRows(d.users),
+		recoveryCodes:     cloneRows(d.recoveryCodes),
+		socialLinks:       make(map[uint][]model.SocialLink, len(d.socialLinks)),
+		identities:        cloneRows(d.identities),
+		tokens:            cloneRows(d.tokens),
+		auditEvents:       cloneRows(d.auditEvents),
+	}
+	for table, id := range d.lastID {
+		c.lastID[table] = id
+	}
+	for id, categoryIDs := range d.articleCategories {
+		c.articleCategories[id] = append([]uint(nil), categoryIDs...)
+	}
+	for id, links := range d.socialLinks {
+		c.socialLinks[id] = append([]model.SocialLink(nil), links...)
+	}
+	return c
+}
+
+func cloneRows[T any](rows map[uint]*T) map[uint]*T {
+	c := make(map[uint]*T, len(rows))
+	for id, row := range rows {
+		copied := *row
+		c[id] = &copied
+	}
+	return c
+}
+
+// nextID returns a new primary key of a table, which counts from 1 like an auto increment column.
+func (s *memoryStore) nextID(table string) uint {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// checkVersion returns ErrorVersionConflict if an update expects another version than the stored one.
+func checkVersion(stored, expected uint) error {
+	if expected != 0 && expected != stored {
+		return utils.NewError(utils.ErrorVersionConflict)
+	}
+	return nil
+}
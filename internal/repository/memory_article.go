@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"time"
+)
+
+// CreateArticle adds an article to the store, and links its categories, which are created if they have no ID.
+func (r *memoryArticleRepository) CreateArticle(article *model.Article) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	article.ID = r.s.nextID("articles")
+	// Like GORM, a creation time that is set is kept.
+	if article.CreatedAt.IsZero() {
+		article.CreatedAt = now
+	}
+	article.UpdatedAt = now
+	article.Version = 1
+
+	stored := *article
+	stored.User = nil
+	stored.Comments = nil
+	stored.Categories = nil
+	r.s.articles[article.ID] = &stored
+	r.s.linkCategories(article.ID, article.Categories)
+	return nil
+}
+
+// GetArticle gets an article with the relations of a view from the store, and returns the article and an error.
+func (r *memoryArticleRepository) GetArticle(id int, view View) (*model.Article, error) {
+	if err := ArticleSchema.checkView(view, false); err != nil {
+		return nil, err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	article, ok := r.s.articles[uint(id)]
+	if !ok {
+		return nil, utils.NewError(utils.ErrorArticleNotExist)
+	}
+	found := *article
+	if !selects(view, articleFields, "content") {
+		found.Content = ""
+	}
+	r.s.expandArticle(&found, view)
+	return &found, nil
+}
+
+// GetArticleList gets a page of the articles that match a query from the store, and returns the list and an error.
+func (r *memoryArticleRepository) GetArticleList(query Query, page Page) (*List[model.Article], error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// The categories are matched by the category filter, and then replaced by the relations of the view.
+	articles := make([]model.Article, 0, len(r.s.articles))
+	for _, article := range r.s.articles {
+		found := *article
+		found.Categories = r.s.articleCategoryList(found.ID)
+		articles = append(articles, found)
+	}
+	list, err := listOf(articles, ArticleSchema, query, page)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		if !selects(query.View, articleListFields, "content") {
+			list.Items[i].Content = ""
+		}
+		r.s.expandArticle(&list.Items[i], query.View)
+	}
+	return list, nil
+}
+
+// CountArticlesByUser counts an author's articles in the store, and returns the count and an error.
+func (r *memoryArticleRepository) CountArticlesByUser(userID int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var count int64
+	for _, article := range r.s.articles {
+		if article.UserID != nil && *article.UserID == uint(userID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateArticle replaces the title, content and categories of an article in the store, and returns an error.
+func (r *memoryArticleRepository) UpdateArticle(id int, data *model.Article) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	article, ok := r.s.articles[uint(id)]
+	if !ok {
+		return utils.NewError(utils.ErrorArticleNotExist)
+	}
+	if err := checkVersion(article.Version, data.Version); err != nil {
+		return err
+	}
+
+	article.Title = data.Title
+	article.Content = data.Content
+	article.Version++
+	article.UpdatedAt = time.Now()
+	delete(r.s.articleCategories, article.ID)
+	r.s.linkCategories(article.ID, data.Categories)
+	return nil
+}
+
+// DeleteArticle deletes an article and its comments from the store, and returns an error.
+func (r *memoryArticleRepository) DeleteArticle(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for commentID, comment := range r.s.comments {
+		if comment.ArticleID == uint(id) {
+			delete(r.s.comments, commentID)
+		}
+	}
+	delete(r.s.articles, uint(id))
+	return nil
+}
+
+// linkCategories adds categories to an article, and creates the categories that have no ID.
+func (s *memoryStore) linkCategories(articleID uint, categories []*model.Category) {
+	for _, category := range categories {
+		if category.ID == 0 {
+			now := time.Now()
+			category.ID = s.nextID("categories")
+			category.CreatedAt = now
+			category.UpdatedAt = now
+			stored := *category
+			stored.Articles = nil
+			s.categories[category.ID] = &stored
+		}
+		if _, ok := s.categories[category.ID]; !ok {
+			continue
+		}
+
+		linked := false
+		for _, id := range s.articleCategories[articleID] {
+			if id == category.ID {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			s.articleCategories[articleID] = append(s.articleCategories[articleID], category.ID)
+		}
+	}
+}
+
+func (s *memoryStore) articleCategoryList(articleID uint) []*model.Category {
+	categories := make([]*model.Category, 0)
+	for _, id := range s.articleCategories[articleID] {
+		if category, ok := s.categories[id]; ok {
+			found := *category
+			categories = append(categories, &found)
+		}
+	}
+	return categories
+}
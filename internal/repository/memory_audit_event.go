@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"time"
+)
+
+// CreateAuditEvent adds an event to the audit trail in the store, and returns an error.
+func (r *memoryAuditRepository) CreateAuditEvent(event *model.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	event.ID = r.s.nextID("audit_events")
+	event.CreatedAt = time.Now()
+	stored := *event
+	r.s.auditEvents[event.ID] = &stored
+	return nil
+}
+
+// GetAuditEventList gets a page of the audit events that match a query from the store, and returns the list and
+// an error.
+func (r *memoryAuditRepository) GetAuditEventList(query Query, page Page) (*List[model.AuditEvent], error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	events := make([]model.AuditEvent, 0, len(r.s.auditEvents))
+	for _, event := range r.s.auditEvents {
+		events = append(events, *event)
+	}
+	return listOf(events, AuditEventSchema, query, page)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"time"
+)
+
+// CheckCategoryName checks if a category name empty or exists in the store, and returns an error.
+func (r *memoryCategoryRepository) CheckCategoryName(id int, name string) error {
+	if name == "" {
+		return utils.NewError(utils.ErrorCategoryNameEmpty)
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, category := range r.s.categories {
+		if category.Name == name && category.ID != uint(id) {
+			return utils.NewError(utils.ErrorCategoryNameUsed)
+		}
+	}
+	return nil
+}
+
+// CreateCategory adds a category to the store, and returns an error.
+func (r *memoryCategoryRepository) CreateCategory(category *model.Category) error {
+	if err := r.CheckCategoryName(-1, category.Name); err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	category.ID = r.s.nextID("categories")
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	category.Version = 1
+	stored := *category
+	stored.Articles = nil
+	r.s.categories[category.ID] = &stored
+	return nil
+}
+
+// GetCategory gets a category from the store, and returns the category and an error.
+func (r *memoryCategoryRepository) GetCategory(id int) (*model.Category, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[uint(id)]
+	if !ok {
+		return nil, utils.NewError(utils.ErrorCategoryNotExist)
+	}
+	found := *category
+	return &found, nil
+}
+
+// GetCategoryList gets a page of categories from the store, and returns the list and an error.
+func (r *memoryCategoryRepository) GetCategoryList(query Query, page Page) (*List[model.Category], error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	categories := make([]model.Category, 0, len(r.s.categories))
+	for _, category := range r.s.categories {
+		categories = append(categories, *category)
+	}
+	return listOf(categories, CategorySchema, query, page)
+}
+
+// UpdateCategory edits a category in the store, and returns an error.
+func (r *memoryCategoryRepository) UpdateCategory(id int, data *model.Category) error {
+	r.s.mu.Lock()
+	category, ok := r.s.categories[uint(id)]
+	r.s.mu.Unlock()
+	if !ok {
+		return utils.NewError(utils.ErrorCategoryNotExist)
+	}
+
+	if err := r.CheckCategoryName(id, data.Name); err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := checkVersion(category.Version, data.Version); err != nil {
+		return err
+	}
+	category.Name = data.Name
+	category.Version++
+	category.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteCategory removes a category from its articles and deletes it from the store, and returns an error.
+func (r *memoryCategoryRepository) DeleteCategory(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.categories[uint(id)]; !ok {
+		return utils.NewError(utils.ErrorCategoryNotExist)
+	}
+
+	for articleID, categoryIDs := range r.s.articleCategories {
+		kept := categoryIDs[:0]
+		for _, categoryID := range categoryIDs {
+			if categoryID != uint(id) {
+				kept = append(kept, categoryID)
+			}
+		}
+		r.s.articleCategories[articleID] = kept
+	}
+	delete(r.s.categories, uint(id))
+	return nil
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"time"
+)
+
+// CreateComment adds a comment to the store and counts it on the article, and returns an error.
+func (r *memoryCommentRepository) CreateComment(comment *model.Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if comment.Article != nil {
+		comment.ArticleID = comment.Article.ID
+	}
+	if comment.User != nil {
+		comment.UserID = comment.User.ID
+	}
+	// The foreign keys reject comments on missing articles or by missing users.
+	article, ok := r.s.articles[comment.ArticleID]
+	if !ok {
+		return utils.NewError(utils.UnknownErr)
+	}
+	if _, ok := r.s.users[comment.UserID]; !ok {
+		return utils.NewError(utils.UnknownErr)
+	}
+
+	now := time.Now()
+	comment.ID = r.s.nextID("comments")
+	comment.CreatedAt = now
+	comment.UpdatedAt = now
+	stored := *comment
+	stored.Article = nil
+	stored.User = nil
+	r.s.comments[comment.ID] = &stored
+	article.CommentCount++
+	return nil
+}
+
+// GetComment gets a comment with the relations of a view from the store, and returns the comment and an error.
+func (r *memoryCommentRepository) GetComment(id int, view View) (*model.Comment, error) {
+	if err := CommentSchema.checkView(view, false); err != nil {
+		return nil, err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[uint(id)]
+	if !ok {
+		return nil, utils.NewError(utils.ErrorCommentNotExist)
+	}
+	return r.s.expandComment(comment, view), nil
+}
+
+// GetCommentList gets a page of the comments that match a query from the store, and returns the list and an error.
+func (r *memoryCommentRepository) GetCommentList(query Query, page Page) (*List[*model.Comment], error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comments := make([]*model.Comment, 0, len(r.s.comments))
+	for _, comment := range r.s.comments {
+		comments = append(comments, r.s.expandComment(comment, query.View))
+	}
+	return listOf(comments, CommentSchema, query, page)
+}
+
+// GetCommentUserID gets a comment's user id from the store, and returns the user id and an error.
+func (r *memoryCommentRepository) GetCommentUserID(id int) (uint, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[uint(id)]
+	if !ok {
+		return 0, utils.NewError(utils.ErrorCommentNotExist)
+	}
+	return comment.UserID, nil
+}
+
+// CountCommentsByUser counts a user's comments in the store, and returns the count and an error.
+func (r *memoryCommentRepository) CountCommentsByUser(userID int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var count int64
+	for _, comment := range r.s.comments {
+		if comment.UserID == uint(userID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateComment edits the content of a comment in the store, and returns an error.
+func (r *memoryCommentRepository) UpdateComment(id int, data *model.Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[uint(id)]
+	if !ok {
+		return utils.NewError(utils.ErrorCommentNotExist)
+	}
+	if data.Content != "" {
+		comment.Content = data.Content
+	}
+	comment.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteComment deletes a comment from the store and uncounts it on the article, and returns an error.
+func (r *memoryCommentRepository) DeleteComment(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[uint(id)]
+	if !ok {
+		return nil
+	}
+	delete(r.s.comments, uint(id))
+	if article, ok := r.s.articles[comment.ArticleID]; ok {
+		article.CommentCount--
+	}
+	return nil
+}
+
+// deleteUserComments deletes a user's comments and uncounts them on the articles.
+func (s *memoryStore) deleteUserComments(userID uint) {
+	for id, comment := range s.comments {
+		if comment.UserID != userID {
+			continue
+		}
+		delete(s.comments, id)
+		if article, ok := s.articles[comment.ArticleID]; ok {
+			article.CommentCount--
+		}
+	}
+}
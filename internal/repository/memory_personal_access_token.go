@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"sort"
+	"time"
+)
+
+// CreatePersonalAccessToken adds a personal access token to the store, and returns an error.
+func (r *memoryAccessTokenRepository) CreatePersonalAccessToken(token *model.PersonalAccessToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	token.ID = r.s.nextID("personal_access_tokens")
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	stored := *token
+	stored.User = nil
+	r.s.tokens[token.ID] = &stored
+	return nil
+}
+
+// GetPersonalAccessTokenByHash gets a personal access token and its user's name by the token hash, and returns the token and an error.
+func (r *memoryAccessTokenRepository) GetPersonalAccessTokenByHash(hash string) (*model.PersonalAccessToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, token := range r.s.tokens {
+		if token.TokenHash != hash {
+			continue
+		}
+		user, ok := r.s.users[token.UserID]
+		if !ok {
+			return nil, utils.NewError(utils.ErrorAccessTokenNotExist)
+		}
+		found := *token
+		found.User = &model.User{Username: user.Username}
+		found.User.ID = user.ID
+		return &found, nil
+	}
+	return nil, utils.NewError(utils.ErrorAccessTokenNotExist)
+}
+
+// GetPersonalAccessTokenList gets the personal access tokens of a user, and returns the list and an error.
+func (r *memoryAccessTokenRepository) GetPersonalAccessTokenList(userID int) ([]model.PersonalAccessToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tokens := make([]model.PersonalAccessToken, 0)
+	for _, token := range r.s.tokens {
+		if token.UserID == uint(userID) {
+			tokens = append(tokens, *token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+// TouchPersonalAccessToken records the last use of a personal access token, and returns an error.
+func (r *memoryAccessTokenRepository) TouchPersonalAccessToken(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if token, ok := r.s.tokens[id]; ok {
+		now := time.Now()
+		token.LastUsedAt = &now
+	}
+	return nil
+}
+
+// DeletePersonalAccessToken revokes a personal access token of a user, and returns an error.
+func (r *memoryAccessTokenRepository) DeletePersonalAccessToken(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.tokens[uint(id)]
+	if !ok || token.UserID != uint(userID) {
+		return utils.NewError(utils.ErrorAccessTokenNotExist)
+	}
+	delete(r.s.tokens, uint(id))
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"testing"
+)
+
+// TestMemoryRepositories runs the same operations on the GORM and the in-memory repositories, which must agree.
+func TestMemoryRepositories(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	for name, repos := range map[string]Repositories{
+		"gorm":   NewGormRepositories(db.DB),
+		"memory": NewMemoryRepositories(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "gorm" {
+				db.InitTestDB()
+			}
+
+			admin := model.User{Username: "admin", Email: "admin@email.com", Password: "TestPassword"}
+			if err := repos.Users.CreateUser(&admin); err != nil || admin.ID != 1 {
+				t.Fatal("CreateUser failed")
+			}
+			user := model.User{Username: "test", Email: "test@email.com", Password: "TestPassword"}
+			if err := repos.Users.CreateUser(&user); err != nil {
+				t.Fatal("CreateUser failed")
+			}
+			if err := repos.Users.CreateUser(&model.User{Username: "test", Email: "other@email.com", Password: "TestPassword"}); !utils.IsCode(err, utils.ErrorUsernameUsed) {
+				t.Fatal("CreateUser failed")
+			}
+			if status, _ := repos.Users.GetUserStatus(1); status.Role != model.RoleAdmin {
+				t.Fatal("GetUserStatus failed")
+			}
+			if status, _ := repos.Users.GetUserStatus(2); status.Role != model.RoleUser {
+				t.Fatal("GetUserStatus failed")
+			}
+
+			// The last admin is kept, until there is another one
+			if err := repos.Users.UpdateUserRole(1, model.RoleUser); !utils.IsCode(err, utils.ErrorLastAdmin) {
+				t.Fatal("UpdateUserRole failed")
+			}
+			if err := repos.Users.DeleteUser(1); !utils.IsCode(err, utils.ErrorLastAdmin) {
+				t.Fatal("DeleteUser failed")
+			}
+			if err := repos.Users.DeleteUserByAdmin(1, true, 0); !utils.IsCode(err, utils.ErrorLastAdmin) {
+				t.Fatal("DeleteUserByAdmin failed")
+			}
+			if err := repos.Users.UpdateUserRole(2, model.RoleAdmin); err != nil {
+				t.Fatal("UpdateUserRole failed")
+			}
+			if err := repos.Users.UpdateUserRole(1, model.RoleUser); err != nil {
+				t.Fatal("UpdateUserRole failed")
+			}
+			if err := repos.Users.UpdateUserRole(2, model.RoleUser); !utils.IsCode(err, utils.ErrorLastAdmin) {
+				t.Fatal("UpdateUserRole failed")
+			}
+			_ = repos.Users.UpdateUserRole(1, model.RoleAdmin)
+			_ = repos.Users.UpdateUserRole(2, model.RoleUser)
+			if found, _ := repos.Users.GetUser(2); found.Password != "" || found.Email != "test@email.com" {
+				t.Fatal("GetUser failed")
+			}
+			// Password changes and forced resets revoke the tokens
+			if err := repos.Users.UpdateUserPassword(2, &model.User{Password: "Changed"}); err != nil {
+				t.Fatal("UpdateUserPassword failed")
+			}
+			if err := repos.Users.RequireUserPasswordReset(2); err != nil {
+				t.Fatal("RequireUserPasswordReset failed")
+			}
+			if err := repos.Users.ResetUserPassword(2, "Reset"); err != nil {
+				t.Fatal("ResetUserPassword failed")
+			}
+			if status, _ := repos.Users.GetUserStatus(2); status.TokenVersion != 3 {
+				t.Fatal("Token version failed")
+			}
+
+			category := model.Category{Name: "go"}
+			if err := repos.Categories.CreateCategory(&category); err != nil {
+				t.Fatal("CreateCategory failed")
+			}
+			article := model.Article{Title: "test", Content: "test", UserID: &user.ID, Categories: []*model.Category{&category}}
+			if err := repos.Articles.CreateArticle(&article); err != nil {
+				t.Fatal("CreateArticle failed")
+			}
+			articles, err := repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "category", Op: OpEq, Value: int64(category.ID)}}}, Page{Size: 10, Num: 1})
+			if err != nil || len(articles.Items) != 1 || articles.Items[0].Content != "" || len(articles.Items[0].Categories) != 1 {
+				t.Fatal("GetArticleList failed")
+			}
+			// Contains ignores the case
+			articles, err = repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "title", Op: OpContains, Value: "TeS"}}}, Page{Size: 10, Num: 1})
+			if err != nil || len(articles.Items) != 1 {
+				t.Fatal("GetArticleList failed")
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := repos.Comments.CreateComment(&model.Comment{Content: "test", ArticleID: article.ID, UserID: user.ID}); err != nil {
+					t.Fatal("CreateComment failed")
+				}
+			}
+			if found, _ := repos.Articles.GetArticle(int(article.ID), View{}); found.CommentCount != 2 {
+				t.Fatal("CreateComment failed")
+			}
+			comment, err := repos.Comments.GetComment(1, View{})
+			if err != nil || comment.User.Username != "test" || comment.Article.Title != "test" {
+				t.Fatal("GetComment failed")
+			}
+
+			// An update replaces the categories and increments the version, updates of another version are rejected.
+			if err := repos.Articles.UpdateArticle(int(article.ID), &model.Article{Title: "edited", Content: "edited", Version: 1}); err != nil {
+				t.Fatal("UpdateArticle failed")
+			}
+			if err := repos.Articles.UpdateArticle(int(article.ID), &model.Article{Title: "stale", Content: "stale", Version: 1}); !utils.IsCode(err, utils.ErrorVersionConflict) {
+				t.Fatal("UpdateArticle failed")
+			}
+			if found, _ := repos.Articles.GetArticle(int(article.ID), View{}); found.Title != "edited" || found.Version != 2 || len(found.Categories) != 0 {
+				t.Fatal("UpdateArticle failed")
+			}
+			if err := repos.Articles.UpdateArticle(100, &model.Article{Title: "test", Content: "test"}); !utils.IsCode(err, utils.ErrorArticleNotExist) {
+				t.Fatal("UpdateArticle failed")
+			}
+
+			if err := repos.Users.DeleteUserByAdmin(int(user.ID), true, 0); err != nil {
+				t.Fatal("DeleteUserByAdmin failed")
+			}
+			found, _ := repos.Articles.GetArticle(int(article.ID), View{})
+			if found.CommentCount != 0 || found.UserID != nil {
+				t.Fatal("DeleteUserByAdmin failed")
+			}
+			if _, err := repos.Users.GetUser(int(user.ID)); !utils.IsCode(err, utils.ErrorUserNotExist) {
+				t.Fatal("DeleteUserByAdmin failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,527 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"time"
+)
+
+// CheckUsername checks if a user empty or exists in the store, and returns an error.
+func (r *memoryUserRepository) CheckUsername(id int, username string) error {
+	if username == "" {
+		return utils.NewError(utils.ErrorUsernameEmpty)
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Username == username && user.ID != uint(id) {
+			return utils.NewError(utils.ErrorUsernameUsed)
+		}
+	}
+	return nil
+}
+
+// CheckEmail checks if an email empty or exists in the store, and returns an error.
+func (r *memoryUserRepository) CheckEmail(id int, email string) error {
+	if email == "" {
+		return utils.NewError(utils.ErrorEmailEmpty)
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Email == email && user.ID != uint(id) {
+			return utils.NewError(utils.ErrorEmailUsed)
+		}
+	}
+	return nil
+}
+
+// CreateUser adds a user to the store, and returns an error. A user without a role becomes admin if there is no
+// admin yet, and a user otherwise.
+func (r *memoryUserRepository) CreateUser(user *model.User) error {
+	if err := r.CheckUsername(-1, user.Username); err != nil {
+		return err
+	}
+	if err := r.CheckEmail(-1, user.Email); err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return utils.NewError(utils.ErrorPasswordEmpty)
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Like in the database, a user without a role becomes admin if there is no admin yet. Deleted users are gone
+	// from the store, but the last admin cannot be deleted.
+	if user.Role == "" {
+		user.Role = model.RoleAdmin
+		for _, other := range r.s.users {
+			if other.Role == model.RoleAdmin {
+				user.Role = model.RoleUser
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	user.ID = r.s.nextID("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Version = 1
+	stored := *user
+	stored.Comments = nil
+	stored.RecoveryCodes = nil
+	stored.SocialLinks = nil
+	r.s.users[user.ID] = &stored
+	r.s.setSocialLinks(user.ID, user.SocialLinks)
+	return nil
+}
+
+// GetUser gets a user's public account information from the store, and returns the user and an error.
+func (r *memoryUserRepository) GetUser(id int) (*model.User, error) {
+	return r.get(id, func(user *model.User) *model.User {
+		found := accountColumns(user)
+		return &found
+	})
+}
+
+// GetUserList gets a page of the users that match a query from the store, and returns the list and an error.
+func (r *memoryUserRepository) GetUserList(query Query, page Page) (*List[model.User], error) {
+	return r.list(UserSchema, query, page, accountColumns)
+}
+
+// UpdateUser edits the username and email of a user in the store, and returns an error.
+func (r *memoryUserRepository) UpdateUser(id int, data *model.User) error {
+	if _, err := r.GetUserStatus(id); err != nil {
+		return err
+	}
+	if err := r.CheckUsername(id, data.Username); err != nil {
+		return err
+	}
+	if err := r.CheckEmail(id, data.Email); err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok {
+		return utils.NewError(utils.ErrorUserNotExist)
+	}
+	if err := checkVersion(user.Version, data.Version); err != nil {
+		return err
+	}
+	user.Username = data.Username
+	user.Email = data.Email
+	user.Version++
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateUserPassword edits a user's password in the store, and returns an error.
+func (r *memoryUserRepository) UpdateUserPassword(id int, data *model.User) error {
+	if _, err := r.GetUserStatus(id); err != nil {
+		return err
+	}
+	if data.Password == "" {
+		return utils.NewError(utils.ErrorPasswordEmpty)
+	}
+	return r.update(id, func(user *model.User) {
+		user.Password = data.Password
+		user.TokenVersion++
+	})
+}
+
+// DeleteUser deletes a user and the user's comments from the store, and returns an error.
+func (r *memoryUserRepository) DeleteUser(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.isLastAdmin(id) {
+		return utils.NewError(utils.ErrorLastAdmin)
+	}
+	r.s.deleteUserComments(uint(id))
+	delete(r.s.users, uint(id))
+	return nil
+}
+
+// GetUserWithPasswordByUsername gets a user with the password from the store, and returns the user and an error.
+func (r *memoryUserRepository) GetUserWithPasswordByUsername(username string) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Username == username {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, utils.NewError(utils.ErrorUserNotExist)
+}
+
+// GetUserTOTP gets a user's two-factor settings from the store, and returns the user and an error.
+func (r *memoryUserRepository) GetUserTOTP(id int) (*model.User, error) {
+	return r.get(id, func(user *model.User) *model.User {
+		found := &model.User{Username: user.Username, TOTPSecret: user.TOTPSecret, TOTPEnabled: user.TOTPEnabled}
+		found.ID = user.ID
+		return found
+	})
+}
+
+// SetUserTOTPSecret stores a pending two-factor secret for a user, and returns an error.
+func (r *memoryUserRepository) SetUserTOTPSecret(id int, secret string) error {
+	r.update(id, func(user *model.User) {
+		user.TOTPSecret = secret
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+	})
+	return nil
+}
+
+// EnableUserTOTP turns on two-factor authentication for a user and stores the recovery code hashes, and returns an error.
+func (r *memoryUserRepository) EnableUserTOTP(id int, codeHashes []string) error {
+	r.update(id, func(user *model.User) {
+		user.TOTPEnabled = true
+	})
+	return r.ReplaceRecoveryCodes(id, codeHashes)
+}
+
+// UseTOTPStep records the time step of an accepted two-factor code, and returns ErrorTOTPCodeWrong if a code of
+// that step or a later one was accepted already.
+func (r *memoryUserRepository) UseTOTPStep(id int, step int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok || user.TOTPLastStep >= step {
+		return utils.NewError(utils.ErrorTOTPCodeWrong)
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// DisableUserTOTP turns off two-factor authentication for a user and removes the recovery codes, and returns an error.
+func (r *memoryUserRepository) DisableUserTOTP(id int) error {
+	r.update(id, func(user *model.User) {
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+	})
+	return r.ReplaceRecoveryCodes(id, nil)
+}
+
+// ReplaceRecoveryCodes removes a user's recovery codes and adds the given hashes, and returns an error.
+func (r *memoryUserRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteRecoveryCodes(uint(userID))
+	for _, hash := range codeHashes {
+		code := &model.RecoveryCode{UserID: uint(userID), CodeHash: hash}
+		code.ID = r.s.nextID("recovery_codes")
+		code.CreatedAt = time.Now()
+		r.s.recoveryCodes[code.ID] = code
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, and returns an error.
+func (r *memoryUserRepository) UseRecoveryCode(userID int, codeHash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, code := range r.s.recoveryCodes {
+		if code.UserID == uint(userID) && code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			return nil
+		}
+	}
+	return utils.NewError(utils.ErrorTOTPCodeWrong)
+}
+
+// CountRecoveryCodes counts the unused recovery codes of a user, and returns the count and an error.
+func (r *memoryUserRepository) CountRecoveryCodes(userID int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var count int64
+	for _, code := range r.s.recoveryCodes {
+		if code.UserID == uint(userID) && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetUserStatus gets a user's role and account state from the store, and returns the user and an error.
+func (r *memoryUserRepository) GetUserStatus(id int) (*model.User, error) {
+	return r.get(id, func(user *model.User) *model.User {
+		found := &model.User{
+			Username:              user.Username,
+			Role:                  user.Role,
+			Disabled:              user.Disabled,
+			PasswordResetRequired: user.PasswordResetRequired,
+			TOTPEnabled:           user.TOTPEnabled,
+			TokenVersion:          user.TokenVersion,
+		}
+		found.ID = user.ID
+		return found
+	})
+}
+
+// GetUserStatusList gets a page of the users that match a query from the store with their status for admins,
+// and returns the list and an error.
+func (r *memoryUserRepository) GetUserStatusList(query Query, page Page) (*List[model.User], error) {
+	return r.list(AdminUserSchema, query, page, func(user *model.User) model.User {
+		found := accountColumns(user)
+		found.Disabled = user.Disabled
+		found.DisabledReason = user.DisabledReason
+		found.PasswordResetRequired = user.PasswordResetRequired
+		return found
+	})
+}
+
+// UpdateUserRole changes a user's role in the store, and returns an error.
+func (r *memoryUserRepository) UpdateUserRole(id int, role string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok {
+		return utils.NewError(utils.ErrorUserNotExist)
+	}
+	if role != model.RoleAdmin && r.isLastAdmin(id) {
+		return utils.NewError(utils.ErrorLastAdmin)
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// isLastAdmin reports whether the user is the only admin left. The caller holds the lock.
+func (r *memoryUserRepository) isLastAdmin(id int) bool {
+	user, ok := r.s.users[uint(id)]
+	if !ok || user.Role != model.RoleAdmin {
+		return false
+	}
+	for _, other := range r.s.users {
+		if other.Role == model.RoleAdmin && other.ID != user.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// SetUserDisabled disables or enables a user, and returns an error.
+func (r *memoryUserRepository) SetUserDisabled(id int, disabled bool, reason string) error {
+	if !disabled {
+		reason = ""
+	}
+	return r.update(id, func(user *model.User) {
+		user.Disabled = disabled
+		user.DisabledReason = reason
+	})
+}
+
+// RequireUserPasswordReset makes a user choose a new password at the next login, and returns an error.
+func (r *memoryUserRepository) RequireUserPasswordReset(id int) error {
+	return r.update(id, func(user *model.User) {
+		user.PasswordResetRequired = true
+		user.TokenVersion++
+	})
+}
+
+// ResetUserPassword sets a user's new password and clears a required reset, and returns an error.
+func (r *memoryUserRepository) ResetUserPassword(id int, password string) error {
+	if password == "" {
+		return utils.NewError(utils.ErrorPasswordEmpty)
+	}
+	return r.update(id, func(user *model.User) {
+		user.Password = password
+		user.PasswordResetRequired = false
+		user.TokenVersion++
+	})
+}
+
+// DeleteUserByAdmin deletes a user and moves the user's articles and comments to another author, and returns an error.
+// Without a new author, a soft delete keeps the content, and a hard delete removes the comments and leaves the articles without an author.
+// A hard delete also removes everything else that belongs to the user.
+func (r *memoryUserRepository) DeleteUserByAdmin(id int, hard bool, reassignTo int) error {
+	if _, err := r.GetUserStatus(id); err != nil {
+		return err
+	}
+	if reassignTo > 0 {
+		if reassignTo == id {
+			return utils.NewError(utils.ErrorInvalidParam)
+		}
+		if _, err := r.GetUserStatus(reassignTo); err != nil {
+			return err
+		}
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.isLastAdmin(id) {
+		return utils.NewError(utils.ErrorLastAdmin)
+	}
+	if reassignTo > 0 {
+		newAuthor := uint(reassignTo)
+		for _, article := range r.s.articles {
+			if article.UserID != nil && *article.UserID == uint(id) {
+				article.UserID = &newAuthor
+			}
+		}
+		for _, comment := range r.s.comments {
+			if comment.UserID == uint(id) {
+				comment.UserID = newAuthor
+			}
+		}
+	}
+
+	if hard {
+		for _, article := range r.s.articles {
+			if article.UserID != nil && *article.UserID == uint(id) {
+				article.UserID = nil
+			}
+		}
+		r.s.deleteUserComments(uint(id))
+		r.s.deleteRecoveryCodes(uint(id))
+		for tokenID, token := range r.s.tokens {
+			if token.UserID == uint(id) {
+				delete(r.s.tokens, tokenID)
+			}
+		}
+		for identityID, identity := range r.s.identities {
+			if identity.UserID == uint(id) {
+				delete(r.s.identities, identityID)
+			}
+		}
+		delete(r.s.socialLinks, uint(id))
+	}
+	delete(r.s.users, uint(id))
+	return nil
+}
+
+// GetUserProfile gets the public profile of a user from the store, and returns the user and an error.
+// Disabled users have no public profile.
+func (r *memoryUserRepository) GetUserProfile(id int) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok || user.Disabled {
+		return nil, utils.NewError(utils.ErrorUserNotExist)
+	}
+
+	found := &model.User{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		Website:     user.Website,
+		CreatedAt:   user.CreatedAt,
+		SocialLinks: make([]*model.SocialLink, 0),
+	}
+	found.ID = user.ID
+	for _, link := range r.s.socialLinks[user.ID] {
+		link := link
+		found.SocialLinks = append(found.SocialLinks, &link)
+	}
+	return found, nil
+}
+
+// UpdateUserProfile edits a user's profile and replaces the social links in the store, and returns an error.
+func (r *memoryUserRepository) UpdateUserProfile(id int, data *model.User) error {
+	err := r.update(id, func(user *model.User) {
+		user.DisplayName = data.DisplayName
+		user.Bio = data.Bio
+		user.AvatarURL = data.AvatarURL
+		user.Website = data.Website
+	})
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.setSocialLinks(uint(id), data.SocialLinks)
+	return nil
+}
+
+// get returns the columns of a user picked by columns.
+func (r *memoryUserRepository) get(id int, columns func(*model.User) *model.User) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok {
+		return nil, utils.NewError(utils.ErrorUserNotExist)
+	}
+	return columns(user), nil
+}
+
+func (r *memoryUserRepository) list(schema *Schema[model.User], query Query, page Page, columns func(*model.User) model.User) (*List[model.User], error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	users := make([]model.User, 0, len(r.s.users))
+	for _, user := range r.s.users {
+		users = append(users, columns(user))
+	}
+	return listOf(users, schema, query, page)
+}
+
+func (r *memoryUserRepository) update(id int, change func(*model.User)) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[uint(id)]
+	if !ok {
+		return utils.NewError(utils.ErrorUserNotExist)
+	}
+	change(user)
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// accountColumns copies the columns of the user lists.
+func accountColumns(user *model.User) model.User {
+	found := model.User{
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        user.Role,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLoginAt,
+		Version:     user.Version,
+	}
+	found.ID = user.ID
+	return found
+}
+
+func (s *memoryStore) setSocialLinks(userID uint, links []*model.SocialLink) {
+	stored := make([]model.SocialLink, 0, len(links))
+	for _, link := range links {
+		copied := model.SocialLink{Platform: link.Platform, URL: link.URL, UserID: userID}
+		copied.ID = s.nextID("social_links")
+		copied.CreatedAt = time.Now()
+		stored = append(stored, copied)
+	}
+	s.socialLinks[userID] = stored
+}
+
+func (s *memoryStore) deleteRecoveryCodes(userID uint) {
+	for id, code := range s.recoveryCodes {
+		if code.UserID == userID {
+			delete(s.recoveryCodes, id)
+		}
+	}
+}
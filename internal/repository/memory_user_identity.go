@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"sort"
+	"time"
+)
+
+// CreateUserIdentity links an external account to a user, and returns an error.
+func (r *memoryIdentityRepository) CreateUserIdentity(identity *model.UserIdentity) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, linked := range r.s.identities {
+		if linked.Provider == identity.Provider && linked.Subject == identity.Subject {
+			return utils.NewError(utils.UnknownErr)
+		}
+	}
+
+	now := time.Now()
+	identity.ID = r.s.nextID("user_identities")
+	identity.CreatedAt = now
+	identity.UpdatedAt = now
+	stored := *identity
+	stored.User = nil
+	r.s.identities[identity.ID] = &stored
+	return nil
+}
+
+// GetUserIdentity gets a linked external account by provider and subject, and returns the identity and an error.
+func (r *memoryIdentityRepository) GetUserIdentity(provider, subject string) (*model.UserIdentity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, identity := range r.s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, utils.NewError(utils.ErrorIdentityNotExist)
+}
+
+// GetUserIdentityList gets the external accounts linked to a user, and returns the list and an error.
+func (r *memoryIdentityRepository) GetUserIdentityList(userID int) ([]model.UserIdentity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	identities := make([]model.UserIdentity, 0)
+	for _, identity := range r.s.identities {
+		if identity.UserID == uint(userID) {
+			identities = append(identities, *identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+// DeleteUserIdentity unlinks an external account from a user, and returns an error.
+func (r *memoryIdentityRepository) DeleteUserIdentity(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	identity, ok := r.s.identities[uint(id)]
+	if !ok || identity.UserID != uint(userID) {
+		return utils.NewError(utils.ErrorIdentityNotExist)
+	}
+	delete(r.s.identities, uint(id))
+	return nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"blog-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// Page selects a page of a list for offset or keyset pagination.
+type Page struct {
+	// Size is the maximum number of items.
+	Size int
+	// Num is the page number for offset pagination, counted from 1. It is ignored if After is set.
+	Num int
+	// After starts the page behind an item for keyset pagination, which stays stable when items are added.
+	After *Cursor
+	// Total asks for the number of all items in the list, which takes another query.
+	Total bool
+}
+
+// Cursor is the position of an item in a list: the values of the sort fields and the ID of the item.
+type Cursor struct {
+	// Sort is the order of the list in the form of the sort parameter. The cursor is only valid in that order.
+	Sort   string
+	Values []interface{}
+	ID     uint
+}
+
+// cursorToken is the encoding of a cursor.
+type cursorToken struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     uint          `json:"id"`
+}
+
+// List is a page of a list.
+type List[T any] struct {
+	Items []T
+	// Next is the cursor of the last item if more items follow, and nil otherwise.
+	Next *Cursor
+	// Total is the number of all items if the page asked for it.
+	Total *int64
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c Cursor) String() string {
+	data, _ := json.Marshal(cursorToken{Sort: c.Sort, Values: c.Values, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor token, and returns the cursor and an error. The values are checked against the
+// sort fields when the cursor is used.
+func ParseCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, utils.WrapError(utils.ErrorInvalidParam, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var t cursorToken
+	if err := decoder.Decode(&t); err != nil {
+		return nil, utils.WrapError(utils.ErrorInvalidParam, err)
+	}
+	return &Cursor{Sort: t.Sort, Values: t.Values, ID: t.ID}, nil
+}
+
+// findPage finds a page of the items that a GORM query with a model selects, filtered and ordered by a query on
+// the schema. columns selects the columns and preloads of the items, which the count leaves out.
+func findPage[T any](db *gorm.DB, schema *Schema[T], q Query, page Page, columns func(*gorm.DB) *gorm.DB) (*List[T], error) {
+	if err := schema.check(q); err != nil {
+		return nil, err
+	}
+	if err := schema.checkView(q.View, true); err != nil {
+		return nil, err
+	}
+	sorts := q.order()
+	db = schema.where(db, q).Session(&gorm.Session{})
+
+	list := &List[T]{}
+	if page.Total {
+		var total int64
+		if err := db.Count(&total).Error; err != nil {
+			return nil, utils.WrapError(utils.UnknownErr, err)
+		}
+		list.Total = &total
+	}
+
+	find := schema.orderBy(columns(db), sorts)
+	if page.After != nil {
+		condition, args, err := schema.after(sorts, page.After)
+		if err != nil {
+			return nil, err
+		}
+		find = find.Where(condition, args...)
+	} else {
+		find = find.Offset((page.Num - 1) * page.Size)
+	}
+
+	// One more row tells whether another page follows.
+	var items []T
+	if err := find.Limit(page.Size + 1).Find(&items).Error; err != nil {
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	list.Items, list.Next = trimPage(items, page.Size, func(item T) Cursor { return schema.cursor(sorts, item) })
+	return list, nil
+}
+
+// listOf filters, sorts and pages the items of an in-memory repository like findPage.
+func listOf[T any](items []T, schema *Schema[T], q Query, page Page) (*List[T], error) {
+	if err := schema.check(q); err != nil {
+		return nil, err
+	}
+	if err := schema.checkView(q.View, true); err != nil {
+		return nil, err
+	}
+	sorts := q.order()
+
+	rows := make([]T, 0, len(items))
+	for _, item := range items {
+		if schema.match(q, item) {
+			rows = append(rows, item)
+		}
+	}
+	keys := make(map[uint][]interface{}, len(rows))
+	for _, row := range rows {
+		keys[schema.id(row)] = schema.cursor(sorts, row).Values
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := schema.id(rows[i]), schema.id(rows[j])
+		return before(sorts, keys[a], a, keys[b], b)
+	})
+
+	list := &List[T]{}
+	if page.Total {
+		total := int64(len(rows))
+		list.Total = &total
+	}
+
+	start := 0
+	if page.After != nil {
+		values, err := schema.cursorValues(sorts, page.After)
+		if err != nil {
+			return nil, err
+		}
+		for start < len(rows) {
+			id := schema.id(rows[start])
+			if before(sorts, values, page.After.ID, keys[id], id) {
+				break
+			}
+			start++
+		}
+	} else if page.Num > 1 {
+		start = (page.Num - 1) * page.Size
+	}
+	if start > len(rows) {
+		start = len(rows)
+	}
+	rows = rows[start:]
+	if len(rows) > page.Size+1 {
+		rows = rows[:page.Size+1]
+	}
+	list.Items, list.Next = trimPage(rows, page.Size, func(item T) Cursor { return schema.cursor(sorts, item) })
+	return list, nil
+}
+
+// trimPage cuts the row behind a page, and returns the items and the cursor of the next page.
+func trimPage[T any](rows []T, size int, cursor func(T) Cursor) ([]T, *Cursor) {
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) <= size {
+		return rows, nil
+	}
+	rows = rows[:size]
+	if size == 0 {
+		return rows, nil
+	}
+	next := cursor(rows[size-1])
+	return rows, &next
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestPage(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	for name, repos := range map[string]Repositories{
+		"gorm":   NewGormRepositories(db.DB),
+		"memory": NewMemoryRepositories(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "gorm" {
+				db.InitTestDB()
+			}
+
+			// The first four articles are created at the same time, which the IDs order.
+			start := time.Now().Add(-time.Hour)
+			for i := 0; i < 7; i++ {
+				createdAt := start
+				if i >= 4 {
+					createdAt = start.Add(time.Duration(i) * time.Minute)
+				}
+				if err := repos.Articles.CreateArticle(&model.Article{Title: "test", Content: "test", CreatedAt: createdAt}); err != nil {
+					t.Fatal("CreateArticle failed")
+				}
+			}
+
+			var ids []uint
+			page := Page{Size: 3, Total: true}
+			for {
+				list, err := repos.Articles.GetArticleList(Query{}, page)
+				if err != nil || list.Total == nil || *list.Total != int64(7+len(ids)/3) {
+					t.Fatal("GetArticleList failed")
+				}
+				for _, article := range list.Items {
+					ids = append(ids, article.ID)
+				}
+				if list.Next == nil {
+					break
+				}
+				page.After, err = ParseCursor(list.Next.String())
+				if err != nil {
+					t.Fatal("ParseCursor failed")
+				}
+
+				// New articles do not move the following pages.
+				if err := repos.Articles.CreateArticle(&model.Article{Title: "new", Content: "new"}); err != nil {
+					t.Fatal("CreateArticle failed")
+				}
+			}
+			want := []uint{7, 6, 5, 4, 3, 2, 1}
+			if len(ids) != len(want) {
+				t.Fatalf("GetArticleList failed: %v", ids)
+			}
+			for i := range want {
+				if ids[i] != want[i] {
+					t.Fatalf("GetArticleList failed: %v", ids)
+				}
+			}
+
+			// Offset pagination counts the two new articles.
+			list, err := repos.Articles.GetArticleList(Query{}, Page{Size: 3, Num: 2})
+			if err != nil || len(list.Items) != 3 || list.Items[0].ID != 6 || list.Next == nil || list.Total != nil {
+				t.Fatal("GetArticleList failed")
+			}
+			list, err = repos.Articles.GetArticleList(Query{}, Page{Size: 3, Num: 4})
+			if err != nil || len(list.Items) != 0 || list.Next != nil {
+				t.Fatal("GetArticleList failed")
+			}
+		})
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	sorts := []Sort{{Field: "read_count", Desc: true}, {Field: "title"}}
+	cursor := ArticleSchema.cursor(sorts, model.Article{Model: gorm.Model{ID: 42}, Title: "go", ReadCount: 3})
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil || parsed.ID != 42 {
+		t.Fatal("ParseCursor failed")
+	}
+	values, err := ArticleSchema.cursorValues(sorts, parsed)
+	if err != nil || values[0] != int64(3) || values[1] != "go" {
+		t.Fatal("ParseCursor failed")
+	}
+	if _, err := ArticleSchema.cursorValues(defaultSort, parsed); !utils.IsCode(err, utils.ErrorInvalidParam) {
+		t.Fatal("ParseCursor failed")
+	}
+
+	for _, token := range []string{"", "!!", "MTIz", "YS4x"} {
+		if _, err := ParseCursor(token); err == nil {
+			t.Fatalf("ParseCursor failed: %q", token)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	for name, repos := range map[string]Repositories{
+		"gorm":   NewGormRepositories(db.DB),
+		"memory": NewMemoryRepositories(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "gorm" {
+				db.InitTestDB()
+			}
+
+			golang := model.Category{Name: "go"}
+			if err := repos.Categories.CreateCategory(&golang); err != nil {
+				t.Fatal("CreateCategory failed")
+			}
+			for i, readCount := range []int{5, 3, 5, 1, 5, 0} {
+				article := model.Article{Title: "test" + strconv.Itoa(i%2), Content: "test", ReadCount: readCount}
+				if i < 5 {
+					article.Categories = []*model.Category{&golang}
+				}
+				if err := repos.Articles.CreateArticle(&article); err != nil {
+					t.Fatal("CreateArticle failed")
+				}
+			}
+
+			// Articles 1 to 5 are in the category, with the read counts 5, 3, 5, 1, 5
+			query := Query{
+				Filters: []Filter{
+					{Field: "category", Op: OpEq, Value: int64(golang.ID)},
+					{Field: "read_count", Op: OpGte, Value: int64(3)},
+				},
+				Sort: []Sort{{Field: "read_count", Desc: true}, {Field: "title"}},
+			}
+			var ids []uint
+			page := Page{Size: 2, Total: true}
+			for {
+				list, err := repos.Articles.GetArticleList(query, page)
+				if err != nil || *list.Total != 4 {
+					t.Fatal("GetArticleList failed")
+				}
+				for _, article := range list.Items {
+					ids = append(ids, article.ID)
+				}
+				if list.Next == nil {
+					break
+				}
+				page.After, _ = ParseCursor(list.Next.String())
+			}
+			// Read count 5 with title test0 (articles 1, 3, 5 by ID), then read count 3
+			want := []uint{5, 3, 1, 2}
+			if len(ids) != len(want) {
+				t.Fatalf("GetArticleList failed: %v", ids)
+			}
+			for i := range want {
+				if ids[i] != want[i] {
+					t.Fatalf("GetArticleList failed: %v", ids)
+				}
+			}
+
+			list, err := repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "title", Op: OpContains, Value: "st1"}}}, Page{Size: 10})
+			if err != nil || len(list.Items) != 3 {
+				t.Fatal("GetArticleList failed")
+			}
+
+			// A cursor only works in the order of its list
+			if _, err := repos.Articles.GetArticleList(Query{}, page); !utils.IsCode(err, utils.ErrorInvalidParam) {
+				t.Fatal("GetArticleList failed")
+			}
+			for _, query := range []Query{
+				{Filters: []Filter{{Field: "content", Op: OpEq, Value: "test"}}},
+				{Filters: []Filter{{Field: "category", Op: OpGt, Value: int64(1)}}},
+				{Filters: []Filter{{Field: "read_count", Op: OpEq, Value: "1"}}},
+				{Sort: []Sort{{Field: "category"}}},
+			} {
+				if _, err := repos.Articles.GetArticleList(query, Page{Size: 10}); !utils.IsCode(err, utils.ErrorInvalidParam) {
+					t.Fatalf("GetArticleList failed: %v", query)
+				}
+			}
+		})
+	}
+}
+
+func TestView(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+
+	for name, repos := range map[string]Repositories{
+		"gorm":   NewGormRepositories(db.DB),
+		"memory": NewMemoryRepositories(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "gorm" {
+				db.InitTestDB()
+			}
+
+			user := &model.User{Username: "author", Password: "password", Email: "author@example.com"}
+			if err := repos.Users.CreateUser(user); err != nil {
+				t.Fatal("CreateUser failed")
+			}
+			category := &model.Category{Name: "test"}
+			if err := repos.Categories.CreateCategory(category); err != nil {
+				t.Fatal("CreateCategory failed")
+			}
+			article := &model.Article{Title: "test", Content: "content", UserID: &user.ID, Categories: []*model.Category{category}}
+			if err := repos.Articles.CreateArticle(article); err != nil {
+				t.Fatal("CreateArticle failed")
+			}
+			if err := repos.Comments.CreateComment(&model.Comment{Content: "comment", ArticleID: article.ID, UserID: user.ID}); err != nil {
+				t.Fatal("CreateComment failed")
+			}
+
+			// The default view has all fields and the categories.
+			found, err := repos.Articles.GetArticle(int(article.ID), View{})
+			if err != nil || found.Content != "content" || len(found.Categories) != 1 || found.User != nil || found.Comments != nil {
+				t.Fatal("GetArticle failed")
+			}
+			found, err = repos.Articles.GetArticle(int(article.ID), View{Fields: []string{"title"}, Expand: []string{"author", "comments"}})
+			if err != nil || found.Title != "test" || found.Content != "" || found.Version != 1 || found.Categories != nil ||
+				found.User == nil || found.User.Username != "author" || len(found.Comments) != 1 {
+				t.Fatal("GetArticle failed")
+			}
+			if _, err := repos.Articles.GetArticle(int(article.ID), View{Fields: []string{"slug"}}); !utils.IsCode(err, utils.ErrorInvalidParam) {
+				t.Fatal("GetArticle failed")
+			}
+
+			// Lists leave out the content unless the view selects it, and cannot expand the comments.
+			list, err := repos.Articles.GetArticleList(Query{}, Page{Size: 10})
+			if err != nil || len(list.Items) != 1 || list.Items[0].Content != "" || len(list.Items[0].Categories) != 1 {
+				t.Fatal("GetArticleList failed")
+			}
+			query := Query{Sort: []Sort{{Field: "read_count"}}, View: View{Fields: []string{"content"}, Expand: []string{"author"}}}
+			list, err = repos.Articles.GetArticleList(query, Page{Size: 10})
+			if err != nil || len(list.Items) != 1 || list.Items[0].Content != "content" || list.Items[0].Categories != nil || list.Items[0].User == nil {
+				t.Fatal("GetArticleList failed")
+			}
+			query.View = View{Expand: []string{"comments"}}
+			if _, err := repos.Articles.GetArticleList(query, Page{Size: 10}); !utils.IsCode(err, utils.ErrorInvalidParam) {
+				t.Fatal("GetArticleList failed")
+			}
+
+			comment, err := repos.Comments.GetComment(1, View{Expand: []string{"user"}})
+			if err != nil || comment.Content != "comment" || comment.User == nil || comment.User.Email != "" || comment.Article != nil {
+				t.Fatal("GetComment failed")
+			}
+			comments, err := repos.Comments.GetCommentList(Query{View: View{Fields: []string{"article_id"}, Expand: []string{}}}, Page{Size: 10})
+			if err != nil || len(comments.Items) != 1 || comments.Items[0].ArticleID != article.ID || comments.Items[0].User != nil || comments.Items[0].Article != nil {
+				t.Fatal("GetCommentList failed")
+			}
+		})
+	}
+}
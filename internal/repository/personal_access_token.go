@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreatePersonalAccessToken adds a personal access token to the database, and returns an error.
+func (r *gormAccessTokenRepository) CreatePersonalAccessToken(token *model.PersonalAccessToken) error {
+	err := r.db.Create(token).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	return nil
+}
+
+// GetPersonalAccessTokenByHash gets a personal access token and its user's name by the token hash, and returns the token and an error.
+func (r *gormAccessTokenRepository) GetPersonalAccessTokenByHash(hash string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	err := r.db.Where("token_hash = ?", hash).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "username")
+		}).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewError(utils.ErrorAccessTokenNotExist)
+		}
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	if token.User == nil {
+		return nil, utils.NewError(utils.ErrorAccessTokenNotExist)
+	}
+	return &token, nil
+}
+
+// GetPersonalAccessTokenList gets the personal access tokens of a user, and returns the list and an error.
+func (r *gormAccessTokenRepository) GetPersonalAccessTokenList(userID int) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	return tokens, nil
+}
+
+// TouchPersonalAccessToken records the last use of a personal access token, and returns an error.
+func (r *gormAccessTokenRepository) TouchPersonalAccessToken(id uint) error {
+	err := r.db.Model(&model.PersonalAccessToken{}).Where("id = ?", id).
+		UpdateColumn("last_used_at", time.Now()).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	return nil
+}
+
+// DeletePersonalAccessToken revokes a personal access token of a user, and returns an error.
+func (r *gormAccessTokenRepository) DeletePersonalAccessToken(userID, id int) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.PersonalAccessToken{})
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrorAccessTokenNotExist)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"testing"
+)
+
+func TestPersonalAccessToken(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
+
+	if err := repos.Users.CreateUser(&model.User{
+		Username: "TestUsername",
+		Email:    "Test@email.com",
+		Password: "TestPassword",
+	}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+
+	if err := repos.AccessTokens.CreatePersonalAccessToken(&model.PersonalAccessToken{
+		Name:      "test",
+		TokenHash: "hash1",
+		Scopes:    model.ScopeArticlesWrite + "," + model.ScopeCommentsWrite,
+		UserID:    1,
+	}); err != nil {
+		t.Fatal("CreatePersonalAccessToken failed")
+	}
+
+	token, err := repos.AccessTokens.GetPersonalAccessTokenByHash("hash1")
+	if err != nil || token.User.Username != "TestUsername" || len(token.ScopeList()) != 2 {
+		t.Fatal("GetPersonalAccessTokenByHash failed")
+	}
+
+	if err := repos.AccessTokens.TouchPersonalAccessToken(token.ID); err != nil {
+		t.Fatal("TouchPersonalAccessToken failed")
+	}
+
+	if err := repos.AccessTokens.DeletePersonalAccessToken(2, int(token.ID)); !utils.IsCode(err, utils.ErrorAccessTokenNotExist) {
+		t.Fatal("DeletePersonalAccessToken failed")
+	}
+
+	if err := repos.AccessTokens.DeletePersonalAccessToken(1, int(token.ID)); err != nil {
+		t.Fatal("DeletePersonalAccessToken failed")
+	}
+
+	if _, err := repos.AccessTokens.GetPersonalAccessTokenByHash("hash1"); !utils.IsCode(err, utils.ErrorAccessTokenNotExist) {
+		t.Fatal("GetPersonalAccessTokenByHash failed")
+	}
+}
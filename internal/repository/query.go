@@ -0,0 +1,545 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"blog-go/internal/model"
+	"blog-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// Kind is the type of the values of a field: int64, string, time.Time or bool.
+type Kind int
+
+const (
+	KindInt Kind = iota
+	KindString
+	KindTime
+	KindBool
+)
+
+// Op compares a field with a value in a filter.
+type Op string
+
+const (
+	OpEq  Op = "eq"
+	OpNe  Op = "ne"
+	OpGt  Op = "gt"
+	OpGte Op = "gte"
+	OpLt  Op = "lt"
+	OpLte Op = "lte"
+	// OpContains matches strings that contain the value, ignoring the case.
+	OpContains Op = "contains"
+)
+
+var opSQL = map[Op]string{OpEq: "=", OpNe: "<>", OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<="}
+
+var (
+	equalOps   = []Op{OpEq, OpNe}
+	textOps    = []Op{OpEq, OpNe, OpContains}
+	compareOps = []Op{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte}
+	rangeOps   = []Op{OpGt, OpGte, OpLt, OpLte}
+)
+
+// Filter matches the items whose field compares to a value of the field's kind.
+type Filter struct {
+	Field string
+	Op    Op
+	Value interface{}
+}
+
+// Sort orders a list by a field.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query selects and orders the items of a list. Without Sort, lists are ordered by creation time with the newest
+// first. Items whose sort fields are equal are ordered by ID with the highest first, so that every item has a
+// unique position for the cursors.
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	// View selects the fields and relations of the items.
+	View View
+}
+
+var defaultSort = []Sort{{Field: "created_at", Desc: true}}
+
+func (q Query) order() []Sort {
+	if len(q.Sort) == 0 {
+		return defaultSort
+	}
+	return q.Sort
+}
+
+// sortKey returns the order of a list in the form of the sort parameter, which cursors keep.
+func sortKey(sorts []Sort) string {
+	fields := make([]string, len(sorts))
+	for i, s := range sorts {
+		fields[i] = s.Field
+		if s.Desc {
+			fields[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Field is a field that the lists of a resource can be filtered or sorted by.
+type Field[T any] struct {
+	Kind Kind
+	// Ops are the operators of the filters on the field.
+	Ops []Op
+	// Sortable fields can order the list.
+	Sortable bool
+
+	column string
+	// join is the join that the column needs.
+	join string
+	// value returns the field of an item for the in-memory repositories. Fields with several values return
+	// []int64, and match a filter if one of the values is equal to it.
+	value func(T) interface{}
+}
+
+// Allows reports whether filters on the field can use the operator.
+func (f Field[T]) Allows(op Op) bool {
+	for _, allowed := range f.Ops {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema is the whitelist of the fields that the lists of a resource can be filtered and sorted by, with their
+// names in the API. Queries on other fields are rejected.
+type Schema[T any] struct {
+	Fields map[string]Field[T]
+	// Columns are the fields that views can select, with their columns. Schemas without them have no views.
+	Columns map[string]string
+	// Relations are the relations that views can expand.
+	Relations map[string]Relation
+
+	table string
+	id    func(T) uint
+	// required are the columns that every view selects.
+	required []string
+}
+
+// ArticleSchema is the whitelist of the article lists.
+//
+// Indexes serve the default order, the filters on category and user_id with it, and the sorts by read_count and
+// comment_count. Filters on title and the other sorts scan the articles.
+var ArticleSchema = &Schema[model.Article]{
+	table: "articles",
+	id:    func(article model.Article) uint { return article.ID },
+	Fields: map[string]Field[model.Article]{
+		"category": {Kind: KindInt, Ops: []Op{OpEq},
+			column: "article_categories.category_id",
+			join:   "JOIN article_categories ON article_categories.article_id = articles.id",
+			value: func(article model.Article) interface{} {
+				ids := make([]int64, 0, len(article.Categories))
+				for _, category := range article.Categories {
+					ids = append(ids, int64(category.ID))
+				}
+				return ids
+			}},
+		"user_id": {Kind: KindInt, Ops: equalOps, column: "articles.user_id",
+			value: func(article model.Article) interface{} {
+				if article.UserID == nil {
+					return nil
+				}
+				return int64(*article.UserID)
+			}},
+		"title": {Kind: KindString, Ops: textOps, Sortable: true, column: "articles.title",
+			value: func(article model.Article) interface{} { return article.Title }},
+		"read_count": {Kind: KindInt, Ops: compareOps, Sortable: true, column: "articles.read_count",
+			value: func(article model.Article) interface{} { return int64(article.ReadCount) }},
+		"comment_count": {Kind: KindInt, Ops: compareOps, Sortable: true, column: "articles.comment_count",
+			value: func(article model.Article) interface{} { return int64(article.CommentCount) }},
+		"created_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "articles.created_at",
+			value: func(article model.Article) interface{} { return article.CreatedAt }},
+		"updated_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "articles.updated_at",
+			value: func(article model.Article) interface{} { return article.UpdatedAt }},
+	},
+}
+
+// CommentSchema is the whitelist of the comment lists.
+//
+// Indexes serve the default order, and the filters on article_id and user_id with it.
+var CommentSchema = &Schema[*model.Comment]{
+	table: "comments",
+	id:    func(comment *model.Comment) uint { return comment.ID },
+	Fields: map[string]Field[*model.Comment]{
+		"article_id": {Kind: KindInt, Ops: []Op{OpEq}, column: "comments.article_id",
+			value: func(comment *model.Comment) interface{} { return int64(comment.ArticleID) }},
+		"user_id": {Kind: KindInt, Ops: []Op{OpEq}, column: "comments.user_id",
+			value: func(comment *model.Comment) interface{} { return int64(comment.UserID) }},
+		"created_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "comments.created_at",
+			value: func(comment *model.Comment) interface{} { return comment.CreatedAt }},
+	},
+}
+
+// CategorySchema is the whitelist of the category list. Blogs have few categories, so the filters scan them.
+var CategorySchema = &Schema[model.Category]{
+	table: "categories",
+	id:    func(category model.Category) uint { return category.ID },
+	Fields: map[string]Field[model.Category]{
+		"name": {Kind: KindString, Ops: textOps, Sortable: true, column: "categories.name",
+			value: func(category model.Category) interface{} { return category.Name }},
+		"created_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "categories.created_at",
+			value: func(category model.Category) interface{} { return category.CreatedAt }},
+	},
+}
+
+var userFields = map[string]Field[model.User]{
+	"username": {Kind: KindString, Ops: textOps, Sortable: true, column: "users.username",
+		value: func(user model.User) interface{} { return user.Username }},
+	"created_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "users.created_at",
+		value: func(user model.User) interface{} { return user.CreatedAt }},
+}
+
+// UserSchema is the whitelist of the public user lists. It has no filters on the email and the role, which the
+// public users do not show, so that the list cannot tell whether an address is registered.
+//
+// Indexes serve the default order, the sort by username and the filter on username with eq.
+var UserSchema = &Schema[model.User]{
+	table:  "users",
+	id:     func(user model.User) uint { return user.ID },
+	Fields: userFields,
+}
+
+// AdminUserSchema is the whitelist of the user list for admins, which can also filter on the email, the role and
+// the disabled flag.
+//
+// Indexes serve the filter on email with eq.
+var AdminUserSchema = &Schema[model.User]{
+	table: "users",
+	id:    func(user model.User) uint { return user.ID },
+	Fields: withFields(userFields, map[string]Field[model.User]{
+		"email": {Kind: KindString, Ops: textOps, column: "users.email",
+			value: func(user model.User) interface{} { return user.Email }},
+		"role": {Kind: KindString, Ops: equalOps, column: "users.role",
+			value: func(user model.User) interface{} { return user.Role }},
+		"disabled": {Kind: KindBool, Ops: []Op{OpEq}, column: "users.disabled",
+			value: func(user model.User) interface{} { return user.Disabled }},
+	}),
+}
+
+// AuditEventSchema is the whitelist of the audit trail.
+//
+// Indexes serve the default order, and the filters on actor_id and on resource_type with resource_id.
+var AuditEventSchema = &Schema[model.AuditEvent]{
+	table: "audit_events",
+	id:    func(event model.AuditEvent) uint { return event.ID },
+	Fields: map[string]Field[model.AuditEvent]{
+		"actor_id": {Kind: KindInt, Ops: []Op{OpEq}, column: "audit_events.actor_id",
+			value: func(event model.AuditEvent) interface{} {
+				if event.ActorID == nil {
+					return nil
+				}
+				return int64(*event.ActorID)
+			}},
+		"action": {Kind: KindString, Ops: []Op{OpEq}, column: "audit_events.action",
+			value: func(event model.AuditEvent) interface{} { return event.Action }},
+		"resource_type": {Kind: KindString, Ops: []Op{OpEq}, column: "audit_events.resource_type",
+			value: func(event model.AuditEvent) interface{} { return event.ResourceType }},
+		"resource_id": {Kind: KindInt, Ops: []Op{OpEq}, column: "audit_events.resource_id",
+			value: func(event model.AuditEvent) interface{} { return int64(event.ResourceID) }},
+		"request_id": {Kind: KindString, Ops: []Op{OpEq}, column: "audit_events.request_id",
+			value: func(event model.AuditEvent) interface{} { return event.RequestID }},
+		"created_at": {Kind: KindTime, Ops: rangeOps, Sortable: true, column: "audit_events.created_at",
+			value: func(event model.AuditEvent) interface{} { return event.CreatedAt }},
+	},
+}
+
+func withFields[T any](fields map[string]Field[T], more map[string]Field[T]) map[string]Field[T] {
+	c := make(map[string]Field[T], len(fields)+len(more))
+	for n, f := range fields {
+		c[n] = f
+	}
+	for n, f := range more {
+		c[n] = f
+	}
+	return c
+}
+
+// ParseValue parses a value of a kind in a query string, and returns the value and an error. Times are RFC 3339
+// timestamps or dates, which start at midnight in the server's time zone.
+func ParseValue(kind Kind, s string) (interface{}, error) {
+	switch kind {
+	case KindInt:
+		return strconv.ParseInt(s, 10, 64)
+	case KindTime:
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t.Local(), nil
+		}
+		return time.ParseInLocation(time.DateOnly, s, time.Local)
+	case KindBool:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// check returns ErrorInvalidParam if a query uses fields, operators or sorts that the schema does not allow.
+func (s *Schema[T]) check(q Query) error {
+	for _, f := range q.Filters {
+		field, ok := s.Fields[f.Field]
+		if !ok || !field.Allows(f.Op) {
+			return utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("cannot filter on %s %s", f.Field, f.Op))
+		}
+		if _, err := decodeValue(field.Kind, f.Value); err != nil {
+			return err
+		}
+	}
+	for _, sort := range q.Sort {
+		if !s.Fields[sort.Field].Sortable {
+			return utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("cannot sort by %s", sort.Field))
+		}
+	}
+	return nil
+}
+
+// where adds the filters of a query to a GORM query.
+func (s *Schema[T]) where(db *gorm.DB, q Query) *gorm.DB {
+	joined := map[string]bool{}
+	for _, f := range q.Filters {
+		field := s.Fields[f.Field]
+		if field.join != "" && !joined[field.join] {
+			db = db.Joins(field.join)
+			joined[field.join] = true
+		}
+		if f.Op == OpContains {
+			// LIKE ignores the case on MySQL and SQLite but not on PostgreSQL, so both sides are lowered.
+			db = db.Where("LOWER("+field.column+") LIKE ? ESCAPE '"+likeEscape+"'", "%"+escapeLike(strings.ToLower(f.Value.(string)))+"%")
+			continue
+		}
+		db = db.Where(field.column+" "+opSQL[f.Op]+" ?", f.Value)
+	}
+	return db
+}
+
+// likeEscape is the escape character of the LIKE patterns. It is no backslash, which MySQL, PostgreSQL and SQLite
+// would each need written differently in the ESCAPE clause.
+const likeEscape = "!"
+
+var likeEscaper = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// escapeLike escapes the wildcards of a value, so that a contains filter matches it literally.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// orderBy adds the order of the sort fields and the ID to a GORM query.
+func (s *Schema[T]) orderBy(db *gorm.DB, sorts []Sort) *gorm.DB {
+	for _, sort := range sorts {
+		if sort.Desc {
+			db = db.Order(s.Fields[sort.Field].column + " DESC")
+		} else {
+			db = db.Order(s.Fields[sort.Field].column + " ASC")
+		}
+	}
+	return db.Order(s.table + ".id DESC")
+}
+
+// after returns the condition of the items behind a cursor in a GORM query: the items that are behind it in the
+// first sort field, or equal in it and behind in the next, and so on until the ID.
+func (s *Schema[T]) after(sorts []Sort, cursor *Cursor) (string, []interface{}, error) {
+	values, err := s.cursorValues(sorts, cursor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var terms []string
+	var args []interface{}
+	for i := 0; i <= len(sorts); i++ {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, s.Fields[sorts[j].Field].column+" = ?")
+			args = append(args, values[j])
+		}
+		if i < len(sorts) {
+			op := " > ?"
+			if sorts[i].Desc {
+				op = " < ?"
+			}
+			parts = append(parts, s.Fields[sorts[i].Field].column+op)
+			args = append(args, values[i])
+		} else {
+			parts = append(parts, s.table+".id < ?")
+			args = append(args, cursor.ID)
+		}
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args, nil
+}
+
+// cursorValues returns the values of a cursor in the kinds of the sort fields, or ErrorInvalidParam if the cursor
+// comes from a list with another order.
+func (s *Schema[T]) cursorValues(sorts []Sort, cursor *Cursor) ([]interface{}, error) {
+	if cursor.Sort != sortKey(sorts) || len(cursor.Values) != len(sorts) {
+		return nil, utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("cursor of another order"))
+	}
+	values := make([]interface{}, len(sorts))
+	for i, sort := range sorts {
+		value, err := decodeValue(s.Fields[sort.Field].Kind, cursor.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// cursor returns the cursor of an item.
+func (s *Schema[T]) cursor(sorts []Sort, item T) Cursor {
+	values := make([]interface{}, len(sorts))
+	for i, sort := range sorts {
+		values[i] = s.Fields[sort.Field].value(item)
+	}
+	return Cursor{Sort: sortKey(sorts), Values: values, ID: s.id(item)}
+}
+
+// match reports whether an item matches the filters of a query.
+func (s *Schema[T]) match(q Query, item T) bool {
+	for _, f := range q.Filters {
+		value := s.Fields[f.Field].value(item)
+		if value == nil {
+			return false
+		}
+		if values, ok := value.([]int64); ok {
+			if !containsValue(values, f.Value.(int64)) {
+				return false
+			}
+			continue
+		}
+		if f.Op == OpContains {
+			if !strings.Contains(strings.ToLower(value.(string)), strings.ToLower(f.Value.(string))) {
+				return false
+			}
+			continue
+		}
+
+		c := compareValues(value, f.Value)
+		switch f.Op {
+		case OpEq:
+			if c != 0 {
+				return false
+			}
+		case OpNe:
+			if c == 0 {
+				return false
+			}
+		case OpGt:
+			if c <= 0 {
+				return false
+			}
+		case OpGte:
+			if c < 0 {
+				return false
+			}
+		case OpLt:
+			if c >= 0 {
+				return false
+			}
+		case OpLte:
+			if c > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// before reports whether an item with the sort values and ID a comes before one with b in a list.
+func before(sorts []Sort, a []interface{}, aID uint, b []interface{}, bID uint) bool {
+	for i, sort := range sorts {
+		c := compareValues(a[i], b[i])
+		if c == 0 {
+			continue
+		}
+		if sort.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return aID > bID
+}
+
+// compareValues compares two values of the same kind, and returns -1, 0 or 1.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		b := b.(bool)
+		if !a && b {
+			return -1
+		} else if a && !b {
+			return 1
+		}
+	}
+	return 0
+}
+
+func containsValue(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeValue converts a value of a filter or a cursor to a kind. Cursors that were parsed from a token have
+// numbers as json.Number and times as strings.
+func decodeValue(kind Kind, value interface{}) (interface{}, error) {
+	var ok bool
+	switch kind {
+	case KindInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return nil, utils.WrapError(utils.ErrorInvalidParam, err)
+			}
+			return n, nil
+		}
+	case KindString:
+		_, ok = value.(string)
+	case KindTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, utils.WrapError(utils.ErrorInvalidParam, err)
+			}
+			return t.Local(), nil
+		}
+	case KindBool:
+		_, ok = value.(bool)
+	}
+	if !ok {
+		return nil, utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("%v is no value of kind %d", value, kind))
+	}
+	return value, nil
+}
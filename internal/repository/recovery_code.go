@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReplaceRecoveryCodes removes a user's recovery codes and adds the given hashes, and returns an error.
+func (r *gormUserRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+
+		codes := make([]model.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, model.RecoveryCode{UserID: uint(userID), CodeHash: hash})
+		}
+		err = tx.Create(&codes).Error
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, and returns an error.
+func (r *gormUserRepository) UseRecoveryCode(userID int, codeHash string) error {
+	result := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrorTOTPCodeWrong)
+	}
+	return nil
+}
+
+// CountRecoveryCodes counts the unused recovery codes of a user, and returns the count and an error.
+func (r *gormUserRepository) CountRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		return 0, utils.WrapError(utils.UnknownErr, err)
+	}
+	return count, nil
+}
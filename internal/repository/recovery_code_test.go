@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"testing"
+)
+
+func TestUseRecoveryCode(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
+
+	if err := repos.Users.CreateUser(&model.User{
+		Username: "TestUsername",
+		Email:    "Test@email.com",
+		Password: "TestPassword",
+	}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+
+	if err := repos.Users.ReplaceRecoveryCodes(1, []string{"hash1", "hash2"}); err != nil {
+		t.Fatal("ReplaceRecoveryCodes failed")
+	}
+
+	if count, err := repos.Users.CountRecoveryCodes(1); err != nil || count != 2 {
+		t.Fatal("CountRecoveryCodes failed")
+	}
+
+	if err := repos.Users.UseRecoveryCode(1, "hash1"); err != nil {
+		t.Fatal("UseRecoveryCode failed")
+	}
+
+	if err := repos.Users.UseRecoveryCode(1, "hash1"); !utils.IsCode(err, utils.ErrorTOTPCodeWrong) {
+		t.Fatal("UseRecoveryCode failed")
+	}
+
+	if err := repos.Users.UseRecoveryCode(1, "hash3"); !utils.IsCode(err, utils.ErrorTOTPCodeWrong) {
+		t.Fatal("UseRecoveryCode failed")
+	}
+
+	if count, err := repos.Users.CountRecoveryCodes(1); err != nil || count != 1 {
+		t.Fatal("CountRecoveryCodes failed")
+	}
+
+	if err := repos.Users.ReplaceRecoveryCodes(1, []string{"hash4"}); err != nil {
+		t.Fatal("ReplaceRecoveryCodes failed")
+	}
+
+	if err := repos.Users.UseRecoveryCode(1, "hash2"); !utils.IsCode(err, utils.ErrorTOTPCodeWrong) {
+		t.Fatal("UseRecoveryCode failed")
+	}
+}
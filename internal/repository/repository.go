@@ -0,0 +1,206 @@
+// Package repository stores the blog's data. Handlers use the interfaces, which are implemented on GORM
+// for the server and in memory for tests.
+//
+// All methods return nil if nothing went wrong, and a *utils.AppError with a status code from utils otherwise.
+//
+// The list methods return the items that match a Query on the fields that the Schema of the resource allows,
+// a Page at a time.
+//
+// Articles, categories and users have a version, which their update methods increment. An update whose data has
+// a non-zero Version only applies to that version, and returns utils.ErrorVersionConflict if the stored one differs.
+package repository
+
+import (
+	"context"
+
+	"blog-go/internal/model"
+	"blog-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs several repository operations atomically.
+type Transactor interface {
+	// Transaction calls fn with repositories that work in one transaction, which is committed if fn returns nil
+	// and rolled back otherwise. It returns the error of fn.
+	Transaction(fn func(repos Repositories) error) error
+}
+
+// Contexter binds repositories to a context.
+type Contexter interface {
+	// WithContext returns repositories whose queries run with ctx, which carries the trace and the cancellation of
+	// a request.
+	WithContext(ctx context.Context) Repositories
+}
+
+// ArticleRepository stores articles.
+type ArticleRepository interface {
+	CreateArticle(article *model.Article) error
+	GetArticle(id int, view View) (*model.Article, error)
+	GetArticleList(query Query, page Page) (*List[model.Article], error)
+	CountArticlesByUser(userID int) (int64, error)
+	UpdateArticle(id int, data *model.Article) error
+	DeleteArticle(id int) error
+}
+
+// CategoryRepository stores categories.
+type CategoryRepository interface {
+	CheckCategoryName(id int, name string) error
+	CreateCategory(category *model.Category) error
+	GetCategory(id int) (*model.Category, error)
+	GetCategoryList(query Query, page Page) (*List[model.Category], error)
+	UpdateCategory(id int, data *model.Category) error
+	DeleteCategory(id int) error
+}
+
+// CommentRepository stores comments, and keeps the comment counts of the articles.
+type CommentRepository interface {
+	CreateComment(comment *model.Comment) error
+	GetComment(id int, view View) (*model.Comment, error)
+	GetCommentList(query Query, page Page) (*List[*model.Comment], error)
+	GetCommentUserID(id int) (uint, error)
+	CountCommentsByUser(userID int) (int64, error)
+	UpdateComment(id int, data *model.Comment) error
+	DeleteComment(id int) error
+}
+
+// UserRepository stores users with their two-factor settings and recovery codes.
+type UserRepository interface {
+	CheckUsername(id int, username string) error
+	CheckEmail(id int, email string) error
+	CreateUser(user *model.User) error
+	GetUser(id int) (*model.User, error)
+	GetUserList(query Query, page Page) (*List[model.User], error)
+	UpdateUser(id int, data *model.User) error
+	UpdateUserPassword(id int, data *model.User) error
+	DeleteUser(id int) error
+	GetUserWithPasswordByUsername(username string) (*model.User, error)
+
+	GetUserTOTP(id int) (*model.User, error)
+	SetUserTOTPSecret(id int, secret string) error
+	EnableUserTOTP(id int, codeHashes []string) error
+	DisableUserTOTP(id int) error
+	UseTOTPStep(id int, step int64) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) error
+	CountRecoveryCodes(userID int) (int64, error)
+
+	GetUserStatus(id int) (*model.User, error)
+	GetUserStatusList(query Query, page Page) (*List[model.User], error)
+	UpdateUserRole(id int, role string) error
+	SetUserDisabled(id int, disabled bool, reason string) error
+	RequireUserPasswordReset(id int) error
+	ResetUserPassword(id int, password string) error
+	DeleteUserByAdmin(id int, hard bool, reassignTo int) error
+
+	GetUserProfile(id int) (*model.User, error)
+	UpdateUserProfile(id int, data *model.User) error
+}
+
+// AccessTokenRepository stores personal access tokens.
+type AccessTokenRepository interface {
+	CreatePersonalAccessToken(token *model.PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(hash string) (*model.PersonalAccessToken, error)
+	GetPersonalAccessTokenList(userID int) ([]model.PersonalAccessToken, error)
+	TouchPersonalAccessToken(id uint) error
+	DeletePersonalAccessToken(userID, id int) error
+}
+
+// IdentityRepository stores the external accounts linked to users.
+type IdentityRepository interface {
+	CreateUserIdentity(identity *model.UserIdentity) error
+	GetUserIdentity(provider, subject string) (*model.UserIdentity, error)
+	GetUserIdentityList(userID int) ([]model.UserIdentity, error)
+	DeleteUserIdentity(userID, id int) error
+}
+
+// AuditRepository stores the audit trail of the changes.
+type AuditRepository interface {
+	CreateAuditEvent(event *model.AuditEvent) error
+	GetAuditEventList(query Query, page Page) (*List[model.AuditEvent], error)
+}
+
+// Repositories are all repositories of one store.
+type Repositories struct {
+	Transactor
+	Contexter
+
+	Articles     ArticleRepository
+	Categories   CategoryRepository
+	Comments     CommentRepository
+	Users        UserRepository
+	AccessTokens AccessTokenRepository
+	Identities   IdentityRepository
+	AuditEvents  AuditRepository
+}
+
+type gormTransactor struct{ db *gorm.DB }
+type gormArticleRepository struct{ db *gorm.DB }
+type gormCategoryRepository struct{ db *gorm.DB }
+type gormCommentRepository struct{ db *gorm.DB }
+type gormUserRepository struct{ db *gorm.DB }
+type gormAccessTokenRepository struct{ db *gorm.DB }
+type gormIdentityRepository struct{ db *gorm.DB }
+type gormAuditRepository struct{ db *gorm.DB }
+
+// NewGormRepositories creates the repositories on a database.
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Transactor:   &gormTransactor{db: db},
+		Contexter:    &gormTransactor{db: db},
+		Articles:     &gormArticleRepository{db: db},
+		Categories:   &gormCategoryRepository{db: db},
+		Comments:     &gormCommentRepository{db: db},
+		Users:        &gormUserRepository{db: db},
+		AccessTokens: &gormAccessTokenRepository{db: db},
+		Identities:   &gormIdentityRepository{db: db},
+		AuditEvents:  &gormAuditRepository{db: db},
+	}
+}
+
+func (t *gormTransactor) WithContext(ctx context.Context) Repositories {
+	return NewGormRepositories(t.db.WithContext(ctx))
+}
+
+func (t *gormTransactor) Transaction(fn func(repos Repositories) error) error {
+	return inTransaction(t.db, func(tx *gorm.DB) error {
+		return fn(NewGormRepositories(tx))
+	})
+}
+
+// updateVersioned updates the columns of a row and increments its version. With a non-zero version only that
+// version is updated. If no row is updated, it returns the notExist code or ErrorVersionConflict.
+func updateVersioned(tx *gorm.DB, model interface{}, id int, version uint, columns map[string]interface{}, notExist int) error {
+	columns["version"] = gorm.Expr("version + ?", 1)
+	query := tx.Model(model).Where("id = ?", id)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Updates(columns)
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	if count == 0 {
+		return utils.NewError(notExist)
+	}
+	return utils.NewError(utils.ErrorVersionConflict)
+}
+
+// inTransaction runs fn in a transaction, which is rolled back unless fn returns nil, and returns the error of fn.
+// Repository operations with several writes use it, so that they are atomic on their own, and when they run
+// in a Transactor transaction already, they take part in it through a savepoint.
+func inTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	// A failed commit becomes an unknown error.
+	if err := db.Transaction(fn); err != nil {
+		return utils.AsAppError(err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"blog-go/config"
+	"blog-go/internal/db"
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failOn makes every statement of a kind ("create", "update" or "delete") on a table fail until the test ends.
+func failOn(t *testing.T, kind, table string) {
+	name := "test:fail_" + kind + "_" + table
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			_ = tx.AddError(errInjected)
+		}
+	}
+
+	callback := db.DB.Callback()
+	var err error
+	switch kind {
+	case "create":
+		err = callback.Create().Before("gorm:create").Register(name, fail)
+		t.Cleanup(func() { _ = callback.Create().Remove(name) })
+	case "update":
+		err = callback.Update().Before("gorm:update").Register(name, fail)
+		t.Cleanup(func() { _ = callback.Update().Remove(name) })
+	case "delete":
+		err = callback.Delete().Before("gorm:delete").Register(name, fail)
+		t.Cleanup(func() { _ = callback.Delete().Remove(name) })
+	}
+	if err != nil {
+		t.Fatal("Register callback failed")
+	}
+}
+
+// createTestData creates a user, a category and an article in it with a comment.
+func createTestData(t *testing.T, repos Repositories) {
+	if err := repos.Users.CreateUser(&model.User{Username: "test", Email: "test@email.com", Password: "TestPassword"}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+	category := model.Category{Name: "test"}
+	if err := repos.Categories.CreateCategory(&category); err != nil {
+		t.Fatal("CreateCategory failed")
+	}
+	if err := repos.Articles.CreateArticle(&model.Article{Title: "test", Content: "test", Categories: []*model.Category{&category}}); err != nil {
+		t.Fatal("CreateArticle failed")
+	}
+	if err := repos.Comments.CreateComment(&model.Comment{Content: "test", ArticleID: 1, UserID: 1}); err != nil {
+		t.Fatal("CreateComment failed")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	config.InitTestConfig()
+
+	for name, newRepos := range map[string]func() Repositories{
+		"gorm": func() Repositories {
+			db.InitTestDB()
+			return NewGormRepositories(db.DB)
+		},
+		"memory": NewMemoryRepositories,
+	} {
+		t.Run(name, func(t *testing.T) {
+			repos := newRepos()
+
+			// A failed transaction leaves nothing behind, including nested operations
+			err := repos.Transaction(func(repos Repositories) error {
+				if err := repos.Categories.CreateCategory(&model.Category{Name: "first"}); err != nil {
+					return err
+				}
+				return repos.Categories.CreateCategory(&model.Category{Name: "first"})
+			})
+			if !utils.IsCode(err, utils.ErrorCategoryNameUsed) {
+				t.Fatal("Transaction failed")
+			}
+			if categories, _ := repos.Categories.GetCategoryList(Query{}, Page{Size: 10, Num: 1}); len(categories.Items) != 0 {
+				t.Fatal("Transaction rollback failed")
+			}
+
+			err = repos.Transaction(func(repos Repositories) error {
+				if err := repos.Categories.CreateCategory(&model.Category{Name: "first"}); err != nil {
+					return err
+				}
+				return repos.Categories.CreateCategory(&model.Category{Name: "second"})
+			})
+			if err != nil {
+				t.Fatal("Transaction failed")
+			}
+			if categories, _ := repos.Categories.GetCategoryList(Query{}, Page{Size: 10, Num: 1}); len(categories.Items) != 2 {
+				t.Fatal("Transaction commit failed")
+			}
+		})
+	}
+}
+
+func TestTransactionFailures(t *testing.T) {
+	config.InitTestConfig()
+
+	t.Run("DeleteArticle", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+		createTestData(t, repos)
+
+		// The comments are deleted before the article fails
+		failOn(t, "delete", "articles")
+		if err := repos.Articles.DeleteArticle(1); err == nil {
+			t.Fatal("DeleteArticle failed")
+		}
+		if _, err := repos.Comments.GetComment(1, View{}); err != nil {
+			t.Fatal("DeleteArticle rollback failed")
+		}
+	})
+
+	t.Run("DeleteCategory", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+		createTestData(t, repos)
+
+		// The articles are unlinked before the category fails
+		failOn(t, "delete", "categories")
+		if err := repos.Categories.DeleteCategory(1); err == nil {
+			t.Fatal("DeleteCategory failed")
+		}
+		if articles, _ := repos.Articles.GetArticleList(Query{Filters: []Filter{{Field: "category", Op: OpEq, Value: int64(1)}}}, Page{Size: 10, Num: 1}); len(articles.Items) != 1 {
+			t.Fatal("DeleteCategory rollback failed")
+		}
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+		createTestData(t, repos)
+
+		// The comments are deleted and counted before the user fails
+		failOn(t, "delete", "users")
+		if err := repos.Users.DeleteUser(1); err == nil {
+			t.Fatal("DeleteUser failed")
+		}
+		if article, _ := repos.Articles.GetArticle(1, View{}); article.CommentCount != 1 {
+			t.Fatal("DeleteUser rollback failed")
+		}
+		if _, err := repos.Comments.GetComment(1, View{}); err != nil {
+			t.Fatal("DeleteUser rollback failed")
+		}
+	})
+
+	t.Run("CreateComment", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+		createTestData(t, repos)
+
+		// The comment is created before the count fails
+		failOn(t, "update", "articles")
+		if err := repos.Comments.CreateComment(&model.Comment{Content: "test", ArticleID: 1, UserID: 1}); err == nil {
+			t.Fatal("CreateComment failed")
+		}
+		if count, _ := repos.Comments.CountCommentsByUser(1); count != 1 {
+			t.Fatal("CreateComment rollback failed")
+		}
+	})
+
+	t.Run("EnableUserTOTP", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+		createTestData(t, repos)
+
+		// Two-factor is enabled before the recovery codes fail
+		failOn(t, "create", "recovery_codes")
+		if err := repos.Users.EnableUserTOTP(1, []string{"hash"}); err == nil {
+			t.Fatal("EnableUserTOTP failed")
+		}
+		if user, _ := repos.Users.GetUserTOTP(1); user.TOTPEnabled {
+			t.Fatal("EnableUserTOTP rollback failed")
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		db.InitTestDB()
+		repos := NewGormRepositories(db.DB)
+
+		// The user is created before the identity fails
+		failOn(t, "create", "user_identities")
+		err := repos.Transaction(func(repos Repositories) error {
+			user := model.User{Username: "test", Email: "test@email.com", Password: "TestPassword"}
+			if err := repos.Users.CreateUser(&user); err != nil {
+				return err
+			}
+			return repos.Identities.CreateUserIdentity(&model.UserIdentity{Provider: "test", Subject: "test", UserID: user.ID})
+		})
+		if err == nil {
+			t.Fatal("Transaction failed")
+		}
+		if _, err := repos.Users.GetUser(1); !utils.IsCode(err, utils.ErrorUserNotExist) {
+			t.Fatal("Transaction rollback failed")
+		}
+	})
+}
@@ -1,181 +1,441 @@
 package repository
 
 import (
-	"blog-go/internal/db"
 	"blog-go/internal/model"
 	"blog-go/utils"
 	"errors"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// CheckUsername checks if a user empty or exists in the database, and returns a status code.
-func CheckUsername(id int, username string) int {
+// CheckUsername checks if a user empty or exists in the database, and returns an error.
+func (r *gormUserRepository) CheckUsername(id int, username string) error {
 	if username == "" {
-		return utils.ErrorUsernameEmpty
+		return utils.NewError(utils.ErrorUsernameEmpty)
 	}
 	var user model.User
-	err := db.DB.Where("username = ? AND id <> ?", username, id).First(&user).Error
+	err := r.db.Where("username = ? AND id <> ?", username, id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Success
+			return nil
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.ErrorUsernameUsed
+	return utils.NewError(utils.ErrorUsernameUsed)
 }
 
-// CheckEmail checks if an email empty or exists in the database, and returns a status code.
-func CheckEmail(id int, email string) int {
+// CheckEmail checks if an email empty or exists in the database, and returns an error.
+func (r *gormUserRepository) CheckEmail(id int, email string) error {
 	if email == "" {
-		return utils.ErrorEmailEmpty
+		return utils.NewError(utils.ErrorEmailEmpty)
 	}
 	var user model.User
-	err := db.DB.Where("email = ? AND id <> ?", email, id).First(&user).Error
+	err := r.db.Where("email = ? AND id <> ?", email, id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.Success
+			return nil
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.ErrorEmailUsed
+	return utils.NewError(utils.ErrorEmailUsed)
 }
 
-// CreateUser adds a user to the database, and returns a status code.
-func CreateUser(user *model.User) int {
-	if code := CheckUsername(-1, user.Username); code != utils.Success {
-		return code
+// CreateUser adds a user to the database, and returns an error. A user without a role becomes admin if there is no
+// admin yet, and a user otherwise.
+func (r *gormUserRepository) CreateUser(user *model.User) error {
+	if err := r.CheckUsername(-1, user.Username); err != nil {
+		return err
 	}
-	if code := CheckEmail(-1, user.Email); code != utils.Success {
-		return code
+	if err := r.CheckEmail(-1, user.Email); err != nil {
+		return err
 	}
 	if user.Password == "" {
-		return utils.ErrorPasswordEmpty
+		return utils.NewError(utils.ErrorPasswordEmpty)
 	}
-	err := db.DB.Create(user).Error
-	if err != nil {
-		return utils.UnknownErr
-	}
-	return utils.Success
+
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		// The first user who signs up with a password owns the blog and becomes its admin, the other sign ups
+		// choose the role. Deleted admins count as well, so that nobody becomes admin by signing up after the
+		// admins are deleted. The read locks the users table against concurrent first sign ups: MySQL locks the
+		// range it read, SQLite has one writer, and Postgres does not lock rows that are not there, so it locks
+		// the table.
+		if user.Role == "" {
+			if tx.Dialector.Name() == "postgres" {
+				if err := tx.Exec("LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+					return utils.WrapError(utils.UnknownErr, err)
+				}
+			}
+			var ids []uint
+			err := tx.Unscoped().Model(&model.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ?", model.RoleAdmin).Limit(1).Pluck("id", &ids).Error
+			if err != nil {
+				return utils.WrapError(utils.UnknownErr, err)
+			}
+			user.Role = model.RoleUser
+			if len(ids) == 0 {
+				user.Role = model.RoleAdmin
+			}
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return nil
+	})
 }
 
-// GetUser gets a user's information from the database, and returns the user and a status code.
-func GetUser(id int) (*model.User, int) {
+// GetUser gets a user's information from the database, and returns the user and an error.
+func (r *gormUserRepository) GetUser(id int) (*model.User, error) {
 	var user model.User
-	err := db.DB.Select("id", "username", "email", "created_at", "last_login_at").
+	err := r.db.Select("id", "username", "email", "role", "display_name", "avatar_url", "created_at", "last_login_at", "version").
 		Where("id = ?", id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, utils.ErrorUserNotExist
+			return nil, utils.NewError(utils.ErrorUserNotExist)
 		}
-		return nil, utils.UnknownErr
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return &user, utils.Success
+	return &user, nil
 }
 
-// GetUserList gets a list of users from the database, and returns the list and a status code.
-func GetUserList(pageSize, pageNum int) ([]model.User, int) {
-	var users []model.User
-	err := db.DB.Select("id", "username", "email", "created_at", "last_login_at").
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&users).Error
-	if err != nil {
-		return nil, utils.UnknownErr
-	}
-	return users, utils.Success
+// GetUserList gets a page of the users that match a query from the database, and returns the list and an error.
+func (r *gormUserRepository) GetUserList(query Query, page Page) (*List[model.User], error) {
+	return findPage(r.db.Model(&model.User{}), UserSchema, query, page, accountListColumns)
+}
+
+// accountListColumns selects the account columns of the user lists.
+func accountListColumns(query *gorm.DB) *gorm.DB {
+	return query.Select("id", "username", "email", "role", "display_name", "avatar_url", "created_at", "last_login_at")
 }
 
-// GetUserListByUsername gets a list of users from the database by username, and returns the list and a status code.
-func GetUserListByUsername(username string, pageSize, pageNum int) ([]model.User, int) {
-	var users []model.User
-	err := db.DB.Select("id", "username", "email", "created_at", "last_login_at").
-		Where("username like ?", "%"+username+"%").
-		Offset((pageNum - 1) * pageSize).
-		Limit(pageSize).
-		Order("created_at DESC").
-		Find(&users).Error
+// UpdateUser edits the username and email of a user in the database, and returns an error.
+// The password, role and profile have their own methods.
+func (r *gormUserRepository) UpdateUser(id int, data *model.User) error {
+	var user model.User
+	err := r.db.Where("id = ?", id).First(&user).Error
 	if err != nil {
-		return nil, utils.UnknownErr
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.NewError(utils.ErrorUserNotExist)
+		}
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+
+	if err := r.CheckUsername(id, data.Username); err != nil {
+		return err
 	}
-	return users, utils.Success
+	if err := r.CheckEmail(id, data.Email); err != nil {
+		return err
+	}
+
+	return updateVersioned(r.db, &model.User{}, id, data.Version, map[string]interface{}{
+		"username": data.Username,
+		"email":    data.Email,
+	}, utils.ErrorUserNotExist)
 }
 
-// UpdateUser edits a user in the database, and returns a status code.
-func UpdateUser(id int, data *model.User) int {
+// UpdateUserPassword edits a user's password in the database, and returns an error.
+func (r *gormUserRepository) UpdateUserPassword(id int, data *model.User) error {
 	var user model.User
-	err := db.DB.Where("id = ?", id).First(&user).Error
+	err := r.db.Where("id = ?", id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorUserNotExist
+			return utils.NewError(utils.ErrorUserNotExist)
 		}
-		return utils.UnknownErr
+		return utils.WrapError(utils.UnknownErr, err)
 	}
 
-	if code := CheckUsername(id, data.Username); code != utils.Success {
-		return code
+	if data.Password == "" {
+		return utils.NewError(utils.ErrorPasswordEmpty)
 	}
-	if code := CheckEmail(id, data.Email); code != utils.Success {
-		return code
+
+	err = r.db.Model(&user).Updates(map[string]interface{}{
+		"password":      data.Password,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	if data.Password == "" {
-		return utils.ErrorPasswordEmpty
+	return nil
+}
+
+// DeleteUser deletes a user from the database, and returns an error.
+func (r *gormUserRepository) DeleteUser(id int) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		if err := keepAdmin(tx, id); err != nil {
+			return err
+		}
+		if err := deleteUserComments(tx, id, false); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&model.User{}).Error
+	})
+}
+
+// keepAdmin returns ErrorLastAdmin if the user is the only admin left, whom a delete or a role change would remove.
+// It locks the admins, so that two admins who remove each other at the same time cannot both succeed.
+func keepAdmin(tx *gorm.DB, id int) error {
+	var ids []uint
+	err := tx.Model(&model.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ?", model.RoleAdmin).Pluck("id", &ids).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	if len(ids) == 1 && ids[0] == uint(id) {
+		return utils.NewError(utils.ErrorLastAdmin)
 	}
+	return nil
+}
 
-	data.ID = uint(id)
-	err = db.DB.Model(&user).Updates(data).Error
+// GetUserWithPasswordByUsername gets a user's information and password from the database, and returns the user and an error.
+func (r *gormUserRepository) GetUserWithPasswordByUsername(username string) (*model.User, error) {
+	var user model.User
+	err := r.db.Where("username = ?", username).First(&user).Error
 	if err != nil {
-		return utils.UnknownErr
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewError(utils.ErrorUserNotExist)
+		}
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return &user, nil
 }
 
-// UpdateUserPassword edits a user's password in the database, and returns a status code.
-func UpdateUserPassword(id int, data *model.User) int {
+// GetUserTOTP gets a user's two-factor settings from the database, and returns the user and an error.
+func (r *gormUserRepository) GetUserTOTP(id int) (*model.User, error) {
 	var user model.User
-	err := db.DB.Where("id = ?", id).First(&user).Error
+	err := r.db.Select("id", "username", "totp_secret", "totp_enabled").
+		Where("id = ?", id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return utils.ErrorUserNotExist
+			return nil, utils.NewError(utils.ErrorUserNotExist)
 		}
-		return utils.UnknownErr
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
+	return &user, nil
+}
 
-	if data.Password == "" {
-		return utils.ErrorPasswordEmpty
+// SetUserTOTPSecret stores a pending two-factor secret for a user, and returns an error.
+func (r *gormUserRepository) SetUserTOTPSecret(id int, secret string) error {
+	err := r.db.Model(&model.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": false, "totp_last_step": 0}).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
 	}
+	return nil
+}
+
+// EnableUserTOTP turns on two-factor authentication for a user and stores the recovery code hashes, and returns an error.
+func (r *gormUserRepository) EnableUserTOTP(id int, codeHashes []string) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", id).Update("totp_enabled", true).Error
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return (&gormUserRepository{db: tx}).ReplaceRecoveryCodes(id, codeHashes)
+	})
+}
 
-	data.ID = uint(id)
-	err = db.DB.Model(&user).Updates(data).Error
+// UseTOTPStep records the time step of an accepted two-factor code, and returns ErrorTOTPCodeWrong if a code of
+// that step or a later one was accepted already.
+func (r *gormUserRepository) UseTOTPStep(id int, step int64) error {
+	// The condition is part of the update, so that two requests with the same code cannot both pass.
+	result := r.db.Model(&model.User{}).Where("id = ? AND totp_last_step < ?", id, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrorTOTPCodeWrong)
+	}
+	return nil
+}
+
+// DisableUserTOTP turns off two-factor authentication for a user and removes the recovery codes, and returns an error.
+func (r *gormUserRepository) DisableUserTOTP(id int) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false}).Error
+		if err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		return (&gormUserRepository{db: tx}).ReplaceRecoveryCodes(id, nil)
+	})
+}
+
+// GetUserStatus gets a user's role and account state from the database, and returns the user and an error.
+func (r *gormUserRepository) GetUserStatus(id int) (*model.User, error) {
+	var user model.User
+	err := r.db.Select("id", "username", "role", "disabled", "password_reset_required", "totp_enabled", "token_version").
+		Where("id = ?", id).First(&user).Error
 	if err != nil {
-		return utils.UnknownErr
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewError(utils.ErrorUserNotExist)
+		}
+		return nil, utils.WrapError(utils.UnknownErr, err)
 	}
-	return utils.Success
+	return &user, nil
 }
 
-// DeleteUser deletes a user from the database, and returns a status code.
-func DeleteUser(id int) int {
-	if err := db.DB.Where("user_id = ?", id).Delete(&model.Comment{}).Error; err != nil {
-		return utils.UnknownErr
+// GetUserStatusList gets a page of the users that match a query from the database with their status for admins,
+// and returns the list and an error.
+func (r *gormUserRepository) GetUserStatusList(query Query, page Page) (*List[model.User], error) {
+	return findPage(r.db.Model(&model.User{}), AdminUserSchema, query, page, func(query *gorm.DB) *gorm.DB {
+		return query.Select("id", "username", "email", "role", "disabled", "disabled_reason", "password_reset_required", "created_at", "last_login_at")
+	})
+}
+
+// UpdateUserRole changes a user's role in the database, and returns an error.
+func (r *gormUserRepository) UpdateUserRole(id int, role string) error {
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		if role != model.RoleAdmin {
+			if err := keepAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		return (&gormUserRepository{db: tx}).updateUserColumns(id, map[string]interface{}{"role": role})
+	})
+}
+
+// SetUserDisabled disables or enables a user, and returns an error.
+func (r *gormUserRepository) SetUserDisabled(id int, disabled bool, reason string) error {
+	if !disabled {
+		reason = ""
 	}
+	return r.updateUserColumns(id, map[string]interface{}{"disabled": disabled, "disabled_reason": reason})
+}
 
-	if err := db.DB.Where("id = ?", id).Delete(&model.User{}).Error; err != nil {
-		return utils.UnknownErr
+// RequireUserPasswordReset makes a user choose a new password at the next login, and returns an error.
+func (r *gormUserRepository) RequireUserPasswordReset(id int) error {
+	return r.updateUserColumns(id, map[string]interface{}{
+		"password_reset_required": true,
+		"token_version":           gorm.Expr("token_version + 1"),
+	})
+}
+
+// ResetUserPassword sets a user's new password and clears a required reset, and returns an error.
+func (r *gormUserRepository) ResetUserPassword(id int, password string) error {
+	if password == "" {
+		return utils.NewError(utils.ErrorPasswordEmpty)
 	}
+	return r.updateUserColumns(id, map[string]interface{}{
+		"password":                password,
+		"password_reset_required": false,
+		"token_version":           gorm.Expr("token_version + 1"),
+	})
+}
 
-	return utils.Success
+func (r *gormUserRepository) updateUserColumns(id int, columns map[string]interface{}) error {
+	result := r.db.Model(&model.User{}).Where("id = ?", id).Updates(columns)
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// Nothing changed either because the user does not exist or because the values were already set.
+		var count int64
+		if err := r.db.Model(&model.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return utils.WrapError(utils.UnknownErr, err)
+		}
+		if count == 0 {
+			return utils.NewError(utils.ErrorUserNotExist)
+		}
+	}
+	return nil
 }
 
-// GetUserWithPasswordByUsername gets a user's information and password from the database, and returns the user and a status code.
-func GetUserWithPasswordByUsername(username string) (*model.User, int) {
+// DeleteUserByAdmin deletes a user and moves the user's articles and comments to another author, and returns an error.
+// Without a new author, a soft delete keeps the content, and a hard delete removes the comments and leaves the articles without an author.
+// A hard delete also removes everything else that belongs to the user.
+func (r *gormUserRepository) DeleteUserByAdmin(id int, hard bool, reassignTo int) error {
+	if _, err := r.GetUserStatus(id); err != nil {
+		return err
+	}
+	if reassignTo > 0 {
+		if reassignTo == id {
+			return utils.NewError(utils.ErrorInvalidParam)
+		}
+		if _, err := r.GetUserStatus(reassignTo); err != nil {
+			return err
+		}
+	}
+
+	return inTransaction(r.db, func(tx *gorm.DB) error {
+		if err := keepAdmin(tx, id); err != nil {
+			return err
+		}
+		if reassignTo > 0 {
+			if err := tx.Model(&model.Article{}).Where("user_id = ?", id).Update("user_id", reassignTo).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.Comment{}).Where("user_id = ?", id).Update("user_id", reassignTo).Error; err != nil {
+				return err
+			}
+		}
+
+		if !hard {
+			return tx.Where("id = ?", id).Delete(&model.User{}).Error
+		}
+
+		if err := tx.Model(&model.Article{}).Where("user_id = ?", id).Update("user_id", nil).Error; err != nil {
+			return err
+		}
+		if err := deleteUserComments(tx, id, true); err != nil {
+			return err
+		}
+		for _, owned := range []interface{}{&model.RecoveryCode{}, &model.UserIdentity{}, &model.PersonalAccessToken{}, &model.SocialLink{}} {
+			if err := tx.Unscoped().Where("user_id = ?", id).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id = ?", id).Delete(&model.User{}).Error
+	})
+}
+
+// GetUserProfile gets the public profile of a user from the database, and returns the user and an error.
+// Disabled users have no public profile.
+func (r *gormUserRepository) GetUserProfile(id int) (*model.User, error) {
 	var user model.User
-	err := db.DB.Where("username = ?", username).First(&user).Error
+	err := r.db.Select("id", "username", "display_name", "bio", "avatar_url", "website", "created_at").
+		Preload("SocialLinks").
+		Where("id = ? AND disabled = ?", id, false).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, utils.ErrorUserNotExist
+			return nil, utils.NewError(utils.ErrorUserNotExist)
 		}
-		return nil, utils.UnknownErr
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	return &user, nil
+}
+
+// UpdateUserProfile edits a user's profile and replaces the social links in the database, and returns an error.
+func (r *gormUserRepository) UpdateUserProfile(id int, data *model.User) error {
+	if _, err := r.GetUserStatus(id); err != nil {
+		return err
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"display_name": data.DisplayName,
+			"bio":          data.Bio,
+			"avatar_url":   data.AvatarURL,
+			"website":      data.Website,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&model.SocialLink{}).Error; err != nil {
+			return err
+		}
+		if len(data.SocialLinks) == 0 {
+			return nil
+		}
+		links := make([]*model.SocialLink, 0, len(data.SocialLinks))
+		for _, link := range data.SocialLinks {
+			links = append(links, &model.SocialLink{Platform: link.Platform, URL: link.URL, UserID: uint(id)})
+		}
+		return tx.Create(&links).Error
+	})
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
 	}
-	return &user, utils.Success
+	return nil
 }
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// CreateUserIdentity links an external account to a user, and returns an error.
+func (r *gormIdentityRepository) CreateUserIdentity(identity *model.UserIdentity) error {
+	err := r.db.Create(identity).Error
+	if err != nil {
+		return utils.WrapError(utils.UnknownErr, err)
+	}
+	return nil
+}
+
+// GetUserIdentity gets a linked external account by provider and subject, and returns the identity and an error.
+func (r *gormIdentityRepository) GetUserIdentity(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.NewError(utils.ErrorIdentityNotExist)
+		}
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	return &identity, nil
+}
+
+// GetUserIdentityList gets the external accounts linked to a user, and returns the list and an error.
+func (r *gormIdentityRepository) GetUserIdentityList(userID int) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	if err != nil {
+		return nil, utils.WrapError(utils.UnknownErr, err)
+	}
+	return identities, nil
+}
+
+// DeleteUserIdentity unlinks an external account from a user, and returns an error.
+func (r *gormIdentityRepository) DeleteUserIdentity(userID, id int) error {
+	result := r.db.Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&model.UserIdentity{})
+	if result.Error != nil {
+		return utils.WrapError(utils.UnknownErr, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(utils.ErrorIdentityNotExist)
+	}
+	return nil
+}
@@ -10,85 +10,97 @@ import (
 )
 
 func TestCreateUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser",
 		Password: "TestPassword",
-	}); code != utils.ErrorEmailEmpty {
+	}); !utils.IsCode(err, utils.ErrorEmailEmpty) {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Email:    "Test@email.com",
 		Password: "TestPassword",
-	}); code != utils.ErrorUsernameEmpty {
+	}); !utils.IsCode(err, utils.ErrorUsernameEmpty) {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser",
 		Email:    "Test@email.com",
-	}); code != utils.ErrorPasswordEmpty {
+	}); !utils.IsCode(err, utils.ErrorPasswordEmpty) {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser1",
 		Email:    "Test1@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser2",
 		Email:    "Test2@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser1",
 		Email:    "Test@email.com",
 		Password: "TestPassword",
-	}); code != utils.ErrorUsernameUsed {
+	}); !utils.IsCode(err, utils.ErrorUsernameUsed) {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser",
 		Email:    "Test1@email.com",
 		Password: "TestPassword",
-	}); code != utils.ErrorEmailUsed {
+	}); !utils.IsCode(err, utils.ErrorEmailUsed) {
+		t.Fatal("CreateUser failed")
+	}
+
+	// Only the first user ever becomes admin, also after all users are deleted, which the last admin guard
+	// prevents, but databases from before it may have
+	if err := db.DB.Exec("UPDATE users SET deleted_at = CURRENT_TIMESTAMP").Error; err != nil {
+		t.Fatal("Delete users failed")
+	}
+	user := model.User{Username: "TestCreateUser3", Email: "Test3@email.com", Password: "TestPassword"}
+	if err := repos.Users.CreateUser(&user); err != nil || user.Role == model.RoleAdmin {
 		t.Fatal("CreateUser failed")
 	}
 }
 
 func TestGetUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestGetUser1",
 		Email:    "Test1@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestGetUser2",
 		Email:    "Test2@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUser(1)
-	if code != utils.Success {
+	user, err := repos.Users.GetUser(1)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 	if user.Username != "TestGetUser1" {
@@ -98,8 +110,8 @@ func TestGetUser(t *testing.T) {
 		t.Fatal("GetUser failed")
 	}
 
-	user, code = GetUser(2)
-	if code != utils.Success {
+	user, err = repos.Users.GetUser(2)
+	if err != nil {
 		t.Fatal("GetUser failed")
 	}
 	if user.Username != "TestGetUser2" {
@@ -109,210 +121,395 @@ func TestGetUser(t *testing.T) {
 		t.Fatal("GetUser failed")
 	}
 
-	if _, code = GetUser(3); code != utils.ErrorUserNotExist {
+	if _, err = repos.Users.GetUser(3); !utils.IsCode(err, utils.ErrorUserNotExist) {
 		t.Fatal("GetUser failed")
 	}
 }
 
 func TestGetUserList(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
 	for i := 0; i < 10; i++ {
-		if code := CreateUser(&model.User{
+		if err := repos.Users.CreateUser(&model.User{
 			Username: "TestGetUserList" + strconv.Itoa(i),
 			Email:    "Test" + strconv.Itoa(i) + "@email.com",
 			Password: "TestPassword",
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateUser failed")
 		}
 	}
 
-	users, code := GetUserList(3, 2)
-	if code != utils.Success {
+	users, err := repos.Users.GetUserList(Query{}, Page{Size: 3, Num: 2})
+	if err != nil {
 		t.Fatal("GetUserList failed")
 	}
-	if len(users) != 3 {
+	if len(users.Items) != 3 {
 		t.Fatal("GetUserList failed")
 	}
 
-	users, code = GetUserList(3, 4)
-	if code != utils.Success {
+	users, err = repos.Users.GetUserList(Query{}, Page{Size: 3, Num: 4})
+	if err != nil {
 		t.Fatal("GetUserList failed")
 	}
-	if len(users) != 1 {
+	if len(users.Items) != 1 {
 		t.Fatal("GetUserList failed")
 	}
 }
 
 func TestGetUserListByUsername(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
 	for i := 0; i < 10; i++ {
-		if code := CreateUser(&model.User{
+		if err := repos.Users.CreateUser(&model.User{
 			Username: "TestUsername" + strconv.Itoa(i),
 			Email:    "Test" + strconv.Itoa(i) + "@email.com",
 			Password: "TestPassword",
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateUser failed")
 		}
 	}
 
 	for i := 0; i < 10; i++ {
-		if code := CreateUser(&model.User{
+		if err := repos.Users.CreateUser(&model.User{
 			Username: "JustUsername" + strconv.Itoa(i),
 			Email:    "Just" + strconv.Itoa(i) + "@email.com",
 			Password: "TestPassword",
-		}); code != utils.Success {
+		}); err != nil {
 			t.Fatal("CreateUser failed")
 		}
 	}
 
-	users, code := GetUserListByUsername("Test", 3, 2)
-	if code != utils.Success {
+	users, err := repos.Users.GetUserList(Query{Filters: []Filter{{Field: "username", Op: OpContains, Value: "Test"}}}, Page{Size: 3, Num: 2})
+	if err != nil {
 		t.Fatal("GetUserList failed")
 	}
-	if len(users) != 3 {
+	if len(users.Items) != 3 {
 		t.Fatal("GetUserList failed")
 	}
 
-	users, code = GetUserListByUsername("Test", 3, 4)
-	if code != utils.Success {
+	users, err = repos.Users.GetUserList(Query{Filters: []Filter{{Field: "username", Op: OpContains, Value: "Test"}}}, Page{Size: 3, Num: 4})
+	if err != nil {
 		t.Fatal("GetUserList failed")
 	}
-	if len(users) != 1 {
+	if len(users.Items) != 1 {
 		t.Fatal("GetUserList failed")
 	}
+	// Wildcards in the value are matched literally.
+	if err := repos.Users.CreateUser(&model.User{
+		Username: "Test_Name",
+		Email:    "Test_Name@email.com",
+		Password: "TestPassword",
+	}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+	for value, count := range map[string]int{"t_N": 1, "%": 0, "!": 0} {
+		users, err = repos.Users.GetUserList(Query{Filters: []Filter{{Field: "username", Op: OpContains, Value: value}}}, Page{Size: 30, Num: 1})
+		if err != nil {
+			t.Fatal("GetUserList failed")
+		}
+		if len(users.Items) != count {
+			t.Fatalf("GetUserList failed: %d users contain %q", len(users.Items), value)
+		}
+	}
+
+	// The public list cannot be filtered on the email.
+	_, err = repos.Users.GetUserList(Query{Filters: []Filter{{Field: "email", Op: OpContains, Value: "Test"}}}, Page{Size: 3, Num: 1})
+	if !utils.IsCode(err, utils.ErrorInvalidParam) {
+		t.Fatal("GetUserList filtered on email")
+	}
+	users, err = repos.Users.GetUserStatusList(Query{Filters: []Filter{{Field: "email", Op: OpContains, Value: "Just"}}}, Page{Size: 30, Num: 1})
+	if err != nil || len(users.Items) != 10 {
+		t.Fatal("GetUserStatusList failed")
+	}
 }
 
 func TestUpdateUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser1",
 		Email:    "Test1@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser2",
 		Email:    "Test2@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := UpdateUser(1, &model.User{
+	if err := repos.Users.UpdateUser(1, &model.User{
 		Username: "TestUpdateUser",
-	}); code != utils.ErrorEmailEmpty {
+	}); !utils.IsCode(err, utils.ErrorEmailEmpty) {
 		t.Fatal("UpdateUser failed")
 	}
 
-	if code := UpdateUser(1, &model.User{
+	if err := repos.Users.UpdateUser(1, &model.User{
 		Email: "Test@email.com",
-	}); code != utils.ErrorUsernameEmpty {
+	}); !utils.IsCode(err, utils.ErrorUsernameEmpty) {
 		t.Fatal("UpdateUser failed")
 	}
 
-	if code := UpdateUser(1, &model.User{
+	if err := repos.Users.UpdateUser(1, &model.User{
 		Username: "TestCreateUser2",
 		Email:    "Test@email.com",
 		Password: "TestPassword",
-	}); code != utils.ErrorUsernameUsed {
+	}); !utils.IsCode(err, utils.ErrorUsernameUsed) {
 		t.Fatal("UpdateUser failed")
 	}
 
-	if code := UpdateUser(1, &model.User{
+	if err := repos.Users.UpdateUser(1, &model.User{
 		Username: "TestUpdateUser",
 		Email:    "Test2@email.com",
 		Password: "TestPassword",
-	}); code != utils.ErrorEmailUsed {
+	}); !utils.IsCode(err, utils.ErrorEmailUsed) {
 		t.Fatal("UpdateUser failed")
 	}
 
-	if code := UpdateUser(1, &model.User{
+	if err := repos.Users.UpdateUser(1, &model.User{
 		Username: "TestUpdateUser",
 		Email:    "Test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("UpdateUser failed")
 	}
 }
 
 func TestUpdateUserPassword(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestUsername",
 		Email:    "Test@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := UpdateUserPassword(1, &model.User{
+	if err := repos.Users.UpdateUserPassword(1, &model.User{
 		Password: "TestPassword1",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("UpdateUserPassword failed")
 	}
 }
 
 func TestDeleteUser(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser1",
 		Email:    "Test1@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestCreateUser2",
 		Email:    "Test2@email.com",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	if code := DeleteUser(1); code != utils.Success {
+	if err := repos.Users.DeleteUser(2); err != nil {
+		t.Fatal("DeleteUser failed")
+	}
+
+	if err := repos.Users.DeleteUser(2); err != nil {
 		t.Fatal("DeleteUser failed")
 	}
 
-	if code := DeleteUser(1); code != utils.Success {
+	_, err := repos.Users.GetUser(2)
+	if !utils.IsCode(err, utils.ErrorUserNotExist) {
 		t.Fatal("DeleteUser failed")
 	}
 
-	_, code := GetUser(1)
-	if code != utils.ErrorUserNotExist {
+	// The first user is the only admin
+	if err := repos.Users.DeleteUser(1); !utils.IsCode(err, utils.ErrorLastAdmin) {
 		t.Fatal("DeleteUser failed")
 	}
 }
 
 func TestGetUserWithPasswordByUsername(t *testing.T) {
-	config.InitConfig()
+	config.InitTestConfig()
 	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
 
-	if code := CreateUser(&model.User{
+	if err := repos.Users.CreateUser(&model.User{
 		Username: "TestUsername",
 		Email:    "TestEmail",
 		Password: "TestPassword",
-	}); code != utils.Success {
+	}); err != nil {
 		t.Fatal("CreateUser failed")
 	}
 
-	user, code := GetUserWithPasswordByUsername("TestUsername")
-	if code != utils.Success {
+	user, err := repos.Users.GetUserWithPasswordByUsername("TestUsername")
+	if err != nil {
 		t.Fatal("GetUserPassword failed")
 	}
 	if user.Password != "TestPassword" {
 		t.Fatal("GetUserPassword failed")
 	}
 }
+
+func TestEnableUserTOTP(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
+
+	if err := repos.Users.CreateUser(&model.User{
+		Username: "TestUsername",
+		Email:    "Test@email.com",
+		Password: "TestPassword",
+	}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+
+	if err := repos.Users.SetUserTOTPSecret(1, "TestSecret"); err != nil {
+		t.Fatal("SetUserTOTPSecret failed")
+	}
+
+	user, err := repos.Users.GetUserTOTP(1)
+	if err != nil {
+		t.Fatal("GetUserTOTP failed")
+	}
+	if user.TOTPSecret != "TestSecret" || user.TOTPEnabled {
+		t.Fatal("SetUserTOTPSecret failed")
+	}
+
+	if err := repos.Users.EnableUserTOTP(1, []string{"hash1", "hash2"}); err != nil {
+		t.Fatal("EnableUserTOTP failed")
+	}
+
+	user, err = repos.Users.GetUserTOTP(1)
+	if err != nil {
+		t.Fatal("GetUserTOTP failed")
+	}
+	if !user.TOTPEnabled {
+		t.Fatal("EnableUserTOTP failed")
+	}
+
+	// A time step is accepted once, and earlier steps not at all
+	if err := repos.Users.UseTOTPStep(1, 100); err != nil {
+		t.Fatal("UseTOTPStep failed")
+	}
+	for _, step := range []int64{100, 99} {
+		if err := repos.Users.UseTOTPStep(1, step); !utils.IsCode(err, utils.ErrorTOTPCodeWrong) {
+			t.Fatal("UseTOTPStep accepted a used step")
+		}
+	}
+	if err := repos.Users.UseTOTPStep(1, 101); err != nil {
+		t.Fatal("UseTOTPStep failed")
+	}
+
+	if err := repos.Users.DisableUserTOTP(1); err != nil {
+		t.Fatal("DisableUserTOTP failed")
+	}
+
+	user, err = repos.Users.GetUserTOTP(1)
+	if err != nil {
+		t.Fatal("GetUserTOTP failed")
+	}
+	if user.TOTPEnabled || user.TOTPSecret != "" {
+		t.Fatal("DisableUserTOTP failed")
+	}
+	if count, _ := repos.Users.CountRecoveryCodes(1); count != 0 {
+		t.Fatal("DisableUserTOTP failed")
+	}
+}
+
+func TestDeleteUserByAdmin(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
+
+	for _, username := range []string{"TestAdmin", "TestUsername"} {
+		if err := repos.Users.CreateUser(&model.User{
+			Username: username,
+			Email:    username + "@email.com",
+			Password: "TestPassword",
+		}); err != nil {
+			t.Fatal("CreateUser failed")
+		}
+	}
+
+	author := uint(2)
+	if err := repos.Articles.CreateArticle(&model.Article{Title: "test", UserID: &author}); err != nil {
+		t.Fatal("CreateArticle failed")
+	}
+	if err := repos.Comments.CreateComment(&model.Comment{Content: "test", ArticleID: 1, UserID: 2}); err != nil {
+		t.Fatal("CreateComment failed")
+	}
+
+	if err := repos.Users.DeleteUserByAdmin(2, true, 2); !utils.IsCode(err, utils.ErrorInvalidParam) {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+	if err := repos.Users.DeleteUserByAdmin(2, true, 3); !utils.IsCode(err, utils.ErrorUserNotExist) {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+	if err := repos.Users.DeleteUserByAdmin(2, true, 1); err != nil {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+
+	article, err := repos.Articles.GetArticle(1, View{})
+	if err != nil || article.UserID == nil || *article.UserID != 1 {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+	comment, err := repos.Comments.GetComment(1, View{})
+	if err != nil || comment.UserID != 1 {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+	if _, err := repos.Users.GetUser(2); !utils.IsCode(err, utils.ErrorUserNotExist) {
+		t.Fatal("DeleteUserByAdmin failed")
+	}
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	config.InitTestConfig()
+	db.InitTestDB()
+	repos := NewGormRepositories(db.DB)
+
+	if err := repos.Users.CreateUser(&model.User{
+		Username: "TestUsername",
+		Email:    "Test@email.com",
+		Password: "TestPassword",
+	}); err != nil {
+		t.Fatal("CreateUser failed")
+	}
+
+	for _, platform := range []string{"github", "mastodon"} {
+		if err := repos.Users.UpdateUserProfile(1, &model.User{
+			DisplayName: "Test",
+			SocialLinks: []*model.SocialLink{{Platform: platform, URL: "https://example.com/" + platform}},
+		}); err != nil {
+			t.Fatal("UpdateUserProfile failed")
+		}
+	}
+
+	user, err := repos.Users.GetUserProfile(1)
+	if err != nil || user.DisplayName != "Test" || user.Email != "" {
+		t.Fatal("GetUserProfile failed")
+	}
+	if len(user.SocialLinks) != 1 || user.SocialLinks[0].Platform != "mastodon" {
+		t.Fatal("UpdateUserProfile failed")
+	}
+
+	if err := repos.Users.UpdateUserProfile(2, &model.User{}); !utils.IsCode(err, utils.ErrorUserNotExist) {
+		t.Fatal("UpdateUserProfile failed")
+	}
+}
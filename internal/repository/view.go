@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"blog-go/internal/model"
+	"blog-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// View selects the fields and the relations of the items that a repository returns, by their names in the API.
+type View struct {
+	// Fields are the fields to select. Without fields, single items have all fields, and list items all but
+	// the large ones.
+	Fields []string
+	// Expand are the relations to load. If it is nil, the default relations of the resource are loaded.
+	Expand []string
+}
+
+// Relation is a relation that views can expand.
+type Relation struct {
+	// Default relations are loaded by views without Expand.
+	Default bool
+	// ItemOnly relations can only be expanded on single items, since they load many rows per item.
+	ItemOnly bool
+
+	preload func(db *gorm.DB) *gorm.DB
+	// columns are the columns of the item that the relation needs.
+	columns []string
+}
+
+// Expanded returns the relations that a view loads.
+func (s *Schema[T]) Expanded(view View) []string {
+	if view.Expand != nil {
+		return view.Expand
+	}
+	var names []string
+	for name, relation := range s.Relations {
+		if relation.Default {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// checkView returns ErrorInvalidParam if a view selects fields or relations that the schema does not allow.
+func (s *Schema[T]) checkView(view View, list bool) error {
+	for _, field := range view.Fields {
+		if _, ok := s.Columns[field]; !ok {
+			return utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("cannot select %s", field))
+		}
+	}
+	for _, name := range view.Expand {
+		if relation, ok := s.Relations[name]; !ok || (list && relation.ItemOnly) {
+			return utils.WrapError(utils.ErrorInvalidParam, fmt.Errorf("cannot expand %s", name))
+		}
+	}
+	return nil
+}
+
+// selectView adds the columns and the preloads of a view to a GORM query. defaults are the fields without
+// Fields in the view, and sorts the fields that the cursors need.
+func (s *Schema[T]) selectView(db *gorm.DB, view View, defaults []string, sorts []Sort) *gorm.DB {
+	fields := view.Fields
+	if len(fields) == 0 {
+		fields = defaults
+	}
+	columns := append([]string{}, s.required...)
+	for _, field := range fields {
+		columns = append(columns, s.Columns[field])
+	}
+	for _, sort := range sorts {
+		columns = append(columns, s.Fields[sort.Field].column)
+	}
+	for _, name := range s.Expanded(view) {
+		relation := s.Relations[name]
+		columns = append(columns, relation.columns...)
+		db = relation.preload(db)
+	}
+	return db.Select(unique(columns))
+}
+
+// selects reports whether a view selects a field, for the in-memory repositories.
+func selects(view View, defaults []string, field string) bool {
+	fields := view.Fields
+	if len(fields) == 0 {
+		fields = defaults
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+var (
+	// articleFields are the fields of single articles, and articleListFields of the article lists.
+	articleFields     = []string{"title", "content", "user_id", "comment_count", "read_count", "created_at", "updated_at"}
+	articleListFields = []string{"title", "user_id", "comment_count", "read_count", "created_at", "updated_at"}
+	commentFields     = []string{"content", "article_id", "user_id", "created_at", "updated_at"}
+)
+
+func init() {
+	// Articles keep their version for the ETags.
+	ArticleSchema.required = []string{"articles.id", "articles.version"}
+	ArticleSchema.Columns = map[string]string{
+		"title":         "articles.title",
+		"content":       "articles.content",
+		"user_id":       "articles.user_id",
+		"comment_count": "articles.comment_count",
+		"read_count":    "articles.read_count",
+		"created_at":    "articles.created_at",
+		"updated_at":    "articles.updated_at",
+	}
+	ArticleSchema.Relations = map[string]Relation{
+		"categories": {Default: true, preload: func(db *gorm.DB) *gorm.DB {
+			return db.Preload("Categories")
+		}},
+		"author": {columns: []string{"articles.user_id"}, preload: func(db *gorm.DB) *gorm.DB {
+			return db.Preload("User", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "username")
+			})
+		}},
+		"comments": {ItemOnly: true, preload: func(db *gorm.DB) *gorm.DB {
+			return db.Preload("Comments", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "content", "article_id", "user_id", "created_at", "updated_at").Order("created_at DESC, id DESC")
+			})
+		}},
+	}
+
+	CommentSchema.required = []string{"comments.id"}
+	CommentSchema.Columns = map[string]string{
+		"content":    "comments.content",
+		"article_id": "comments.article_id",
+		"user_id":    "comments.user_id",
+		"created_at": "comments.created_at",
+		"updated_at": "comments.updated_at",
+	}
+	CommentSchema.Relations = map[string]Relation{
+		"article": {Default: true, columns: []string{"comments.article_id"}, preload: func(db *gorm.DB) *gorm.DB {
+			return db.Preload("Article", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "title")
+			})
+		}},
+		"user": {Default: true, columns: []string{"comments.user_id"}, preload: func(db *gorm.DB) *gorm.DB {
+			return db.Preload("User", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "username")
+			})
+		}},
+	}
+}
+
+// expandArticle loads the relations of a view on an article copy, like the GORM preloads.
+func (s *memoryStore) expandArticle(article *model.Article, view View) {
+	article.Categories, article.User, article.Comments = nil, nil, nil
+	for _, name := range ArticleSchema.Expanded(view) {
+		switch name {
+		case "categories":
+			article.Categories = s.articleCategoryList(article.ID)
+		case "author":
+			if article.UserID != nil {
+				if user, ok := s.users[*article.UserID]; ok {
+					article.User = &model.User{Username: user.Username}
+					article.User.ID = user.ID
+				}
+			}
+		case "comments":
+			article.Comments = make([]*model.Comment, 0)
+			for _, comment := range s.comments {
+				if comment.ArticleID == article.ID {
+					found := *comment
+					article.Comments = append(article.Comments, &found)
+				}
+			}
+			sortNewestFirst(article.Comments)
+		}
+	}
+}
+
+// expandComment copies a comment with the relations of a view, like the GORM preloads.
+func (s *memoryStore) expandComment(comment *model.Comment, view View) *model.Comment {
+	found := *comment
+	for _, name := range CommentSchema.Expanded(view) {
+		switch name {
+		case "article":
+			if article, ok := s.articles[comment.ArticleID]; ok {
+				found.Article = &model.Article{Title: article.Title}
+				found.Article.ID = article.ID
+			}
+		case "user":
+			if user, ok := s.users[comment.UserID]; ok {
+				found.User = &model.User{Username: user.Username}
+				found.User.ID = user.ID
+			}
+		}
+	}
+	return &found
+}
+
+func sortNewestFirst(comments []*model.Comment) {
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.After(comments[j].CreatedAt)
+		}
+		return comments[i].ID > comments[j].ID
+	})
+}
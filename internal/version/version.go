@@ -0,0 +1,18 @@
+// Package version holds the build information of the binary, which the build sets with
+//
+//	go build -ldflags "-X blog-go/internal/version.Version=v1.2.0 -X blog-go/internal/version.Commit=$(git rev-parse HEAD) -X blog-go/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "time"
+
+var (
+	// Version is the release of the binary, "dev" for local builds.
+	Version = "dev"
+	// Commit is the git commit that the binary was built from.
+	Commit = "unknown"
+	// BuildTime is when the binary was built, in RFC 3339.
+	BuildTime = ""
+)
+
+// StartTime is when the process started.
+var StartTime = time.Now()
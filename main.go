@@ -1,13 +1,81 @@
 package main
 
 import (
+	"blog-go/api/handler"
 	"blog-go/config"
 	"blog-go/internal/db"
+	"blog-go/internal/lockout"
+	"blog-go/internal/logging"
+	"blog-go/internal/metrics"
+	"blog-go/internal/migrate"
+	"blog-go/internal/oauth"
+	"blog-go/internal/repository"
+	"blog-go/internal/tracing"
 	"blog-go/routes"
+	"blog-go/utils"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	config.InitConfig()
+	if err := logging.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// blog-go migrate up | down [steps] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		db.Connect()
+		if err := migrate.Run(db.DB, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	db.InitDB()
-	routes.InitRouter()
+	lockout.InitLockout(db.DB)
+	oauth.InitProviders()
+
+	app := handler.NewApp(repository.NewGormRepositories(db.DB))
+	app.HealthChecks = []handler.HealthCheck{
+		{Name: "database", Check: db.Ping},
+		{Name: "migrations", Check: db.CheckMigrations},
+		{Name: "storage", Check: utils.CheckStorage},
+	}
+	if err := registerMetrics(app); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server := routes.NewServer(routes.NewRouter(app))
+
+	// SIGINT and SIGTERM drain the requests in flight before the database is closed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := routes.Serve(ctx, server, shutdownTracing, db.Close); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// registerMetrics adds the connection pool stats and the business gauges to the metrics, and returns an error.
+func registerMetrics(app *handler.App) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	if err := metrics.RegisterDB(sqlDB); err != nil {
+		return err
+	}
+	return metrics.RegisterGauges(config.GetMetricsConfig().GaugeInterval, app.Gauges()...)
 }
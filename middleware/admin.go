@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"blog-go/internal/model"
+	"blog-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware only lets admins through. It must run after JWTAuthMiddleware,
+// which reads the role from the database on every request, so that a demotion takes effect immediately.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("role")
+		if !exists {
+			utils.ResponseAuthWrong(c)
+			c.Abort()
+			return
+		}
+		if role != model.RoleAdmin {
+			utils.ResponseError(c, utils.NewError(utils.ErrorPermissionDenied))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation is the schedule of routes that will be removed.
+type Deprecation struct {
+	// Since is when the routes were deprecated.
+	Since time.Time
+	// Sunset is when the routes stop working.
+	Sunset time.Time
+	// Successor is the path of the routes that replace them, if any.
+	Successor string
+}
+
+// Deprecated announces the deprecation of the routes in the Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+// with a link to the successor, so that clients can move before the routes are removed.
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(d.Since.Unix(), 10)
+	sunset := d.Sunset.UTC().Format(http.TimeFormat)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunset)
+		if d.Successor != "" {
+			c.Header("Link", "<"+d.Successor+">; rel=\"successor-version\"")
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"blog-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorHandler renders the last error of a request that has no response yet.
+// Handlers and middlewares add errors with utils.ResponseError, and the AppError decides the status and the body.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		utils.RenderError(c, c.Errors.Last().Err)
+	}
+}
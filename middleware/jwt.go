@@ -2,7 +2,11 @@ package middleware
 
 import (
 	"blog-go/config"
+	"blog-go/internal/logging"
+	"blog-go/internal/model"
+	"blog-go/internal/repository"
 	"blog-go/utils"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,35 +15,125 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var jwtKey = []byte(config.GetServerConfig().JwtKey)
+// twoFactorTokenExpiry is how long a user has to submit the second factor after a correct password.
+const twoFactorTokenExpiry = 5 * time.Minute
+
+// passwordResetTokenExpiry is how long a user has to choose a new password after a login with a forced reset.
+const passwordResetTokenExpiry = 15 * time.Minute
+
+// jwtKey reads the key on every use, since the config is loaded after package initialization.
+func jwtKey() []byte {
+	return []byte(config.GetServerConfig().JwtKey)
+}
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID           uint   `json:"user_id"`
+	Username         string `json:"username"`
+	TwoFactorPending bool   `json:"2fa_pending,omitempty"`
+	PasswordReset    bool   `json:"password_reset,omitempty"`
+	// TokenVersion is the user's token version at issue, a password change revokes the tokens of earlier versions.
+	TokenVersion uint `json:"token_version,omitempty"`
 	jwt.StandardClaims
 }
 
 // GenerateToken generates token
-func GenerateToken(userID uint, username string) (string, error) {
-	claims := Claims{
-		UserID:   userID,
-		Username: username,
+func GenerateToken(userID uint, username string, tokenVersion uint) (string, error) {
+	return signToken(Claims{
+		UserID:       userID,
+		Username:     username,
+		TokenVersion: tokenVersion,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(72 * time.Hour).Unix(),
 			Issuer:    "your_app_name",
 		},
+	})
+}
+
+// GenerateTwoFactorToken generates a short-lived token that only proves the password was correct.
+// It is rejected by JWTAuthMiddleware and must be exchanged for a full token with a valid second factor.
+// A password change revokes it like a full token.
+func GenerateTwoFactorToken(userID uint, username string, tokenVersion uint) (string, error) {
+	return signToken(Claims{
+		UserID:           userID,
+		Username:         username,
+		TwoFactorPending: true,
+		TokenVersion:     tokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(twoFactorTokenExpiry).Unix(),
+			Issuer:    "your_app_name",
+		},
+	})
+}
+
+// ParseTwoFactorToken parses a token generated by GenerateTwoFactorToken.
+func ParseTwoFactorToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.TwoFactorPending {
+		return nil, errors.New("not a two-factor token")
+	}
+	return claims, nil
+}
+
+// GeneratePasswordResetToken generates a short-lived token for a user who has to choose a new password.
+// It is rejected by JWTAuthMiddleware and can only be exchanged for a full token together with the new password.
+func GeneratePasswordResetToken(userID uint, username string) (string, error) {
+	return signToken(Claims{
+		UserID:        userID,
+		Username:      username,
+		PasswordReset: true,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(passwordResetTokenExpiry).Unix(),
+			Issuer:    "your_app_name",
+		},
+	})
+}
+
+// ParsePasswordResetToken parses a token generated by GeneratePasswordResetToken.
+func ParsePasswordResetToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
 	}
+	if !claims.PasswordReset {
+		return nil, errors.New("not a password reset token")
+	}
+	return claims, nil
+}
 
+func signToken(claims Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(jwtKey())
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-// JWTAuthMiddleware is a middleware to handle JWT token
-func JWTAuthMiddleware() gin.HandlerFunc {
+func parseToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtKey(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// JWTAuthMiddleware is a middleware to handle JWT token.
+// It also accepts personal access tokens, which are limited to the scopes checked by RequireScope.
+// The user is looked up on every request, so that disabling a user or forcing a password reset takes effect immediately.
+func JWTAuthMiddleware(users repository.UserRepository, tokens repository.AccessTokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
@@ -50,29 +144,97 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := authHeader[7:]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtKey, nil
-		})
-		if err != nil {
+		if strings.HasPrefix(tokenString, utils.AccessTokenPrefix) {
+			authenticateAccessToken(c, users, tokens, tokenString)
+			return
+		}
+
+		claims, err := parseToken(tokenString)
+		if err != nil || claims.TwoFactorPending || claims.PasswordReset {
 			utils.ResponseAuthWrong(c)
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			c.Set("userID", claims.UserID)
-			c.Set("username", claims.Username)
-		} else {
+		user, ok := checkUserStatus(c, users, claims.UserID)
+		if !ok {
+			return
+		}
+		if user.TokenVersion != claims.TokenVersion {
+			// The password was changed after the token was issued.
 			utils.ResponseAuthWrong(c)
 			c.Abort()
 			return
 		}
 
+		c.Set("userID", claims.UserID)
+		c.Set("username", claims.Username)
+
 		c.Next()
 	}
 }
+
+// authenticateAccessToken authenticates a request with a personal access token.
+func authenticateAccessToken(c *gin.Context, users repository.UserRepository, tokens repository.AccessTokenRepository, tokenString string) {
+	token, err := tokens.GetPersonalAccessTokenByHash(utils.HashAccessToken(tokenString))
+	if utils.IsCode(err, utils.ErrorAccessTokenNotExist) {
+		utils.ResponseAuthWrong(c)
+		c.Abort()
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, err)
+		c.Abort()
+		return
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		utils.ResponseAuthWrong(c)
+		c.Abort()
+		return
+	}
+
+	if _, ok := checkUserStatus(c, users, token.UserID); !ok {
+		return
+	}
+
+	// Recording the last use is best effort and does not fail the request.
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > time.Minute {
+		if err := tokens.TouchPersonalAccessToken(token.ID); err != nil {
+			logging.FromContext(c.Request.Context()).WithError(err).Warn("Touch Access Token Error")
+		}
+	}
+
+	c.Set("userID", token.UserID)
+	c.Set("username", token.User.Username)
+	c.Set("tokenScopes", token.ScopeList())
+	c.Next()
+}
+
+// checkUserStatus rejects users that were deleted, disabled or have to reset their password,
+// and stores the role for AdminMiddleware. It writes the error response and returns false if the request must stop.
+func checkUserStatus(c *gin.Context, users repository.UserRepository, userID uint) (*model.User, bool) {
+	user, err := users.GetUserStatus(int(userID))
+	if utils.IsCode(err, utils.ErrorUserNotExist) {
+		utils.ResponseAuthWrong(c)
+		c.Abort()
+		return nil, false
+	}
+	if err != nil {
+		utils.ResponseError(c, err)
+		c.Abort()
+		return nil, false
+	}
+	if user.Disabled {
+		utils.ResponseError(c, utils.NewError(utils.ErrorUserDisabled))
+		c.Abort()
+		return nil, false
+	}
+	if user.PasswordResetRequired {
+		utils.ResponseError(c, utils.NewError(utils.ErrorPasswordReset))
+		c.Abort()
+		return nil, false
+	}
+
+	c.Set("role", user.Role)
+	return user, true
+}
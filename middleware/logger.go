@@ -1,46 +1,17 @@
 package middleware
 
 import (
+	"blog-go/internal/logging"
 	"fmt"
-	"os"
-	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
-	"github.com/rifflock/lfshook"
 	"github.com/sirupsen/logrus"
 )
 
+// Logger logs every request once it is served, with the logger of the request that RequestID sets up. Server
+// errors are logged as errors and client errors as warnings, with the causes of the errors of the request.
 func Logger() gin.HandlerFunc {
-	logger := logrus.New()
-
-	logger.Formatter = &logrus.JSONFormatter{}
-	logger.SetLevel(logrus.DebugLevel)
-
-	logPath := "log"
-	logFileName := "blog-go.log"
-	fileName := path.Join(logPath, logFileName)
-
-	_ = os.MkdirAll(logPath, 0755)
-	writer, err := rotatelogs.New(
-		fileName+".%Y%m%d",
-		rotatelogs.WithLinkName(fileName),
-		rotatelogs.WithMaxAge(time.Duration(168)*time.Hour),
-		rotatelogs.WithRotationTime(time.Duration(24)*time.Hour),
-	)
-	if err != nil {
-		logger.Errorf("config local file system logger error. %+v", err)
-	}
-	logger.AddHook(lfshook.NewHook(lfshook.WriterMap{
-		logrus.InfoLevel:  writer,
-		logrus.FatalLevel: writer,
-		logrus.DebugLevel: writer,
-		logrus.WarnLevel:  writer,
-		logrus.ErrorLevel: writer,
-		logrus.PanicLevel: writer,
-	}, &logrus.JSONFormatter{}))
-
 	return func(c *gin.Context) {
 		startTime := time.Now()
 
@@ -48,7 +19,7 @@ func Logger() gin.HandlerFunc {
 
 		latencyTime := time.Since(startTime).Milliseconds()
 		statusCode := c.Writer.Status()
-		fields := logger.WithFields(logrus.Fields{
+		fields := logging.FromContext(c.Request.Context()).WithFields(logrus.Fields{
 			"status_code":  statusCode,
 			"latency_time": fmt.Sprintf("%dms", latencyTime),
 			"client_ip":    c.ClientIP(),
@@ -56,8 +27,7 @@ func Logger() gin.HandlerFunc {
 			"req_uri":      c.Request.RequestURI,
 		})
 		if len(c.Errors) > 0 {
-			fields.Error(c.Errors.String())
-			return
+			fields = fields.WithField("errors", c.Errors.String())
 		}
 		switch {
 		case statusCode >= 500:
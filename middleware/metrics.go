@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"blog-go/internal/metrics"
+	"blog-go/utils"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts the requests and observes their latency by route template, so that the paths of different IDs
+// share their series. Requests that match no route are counted as "unmatched".
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(startTime).Seconds())
+	}
+}
+
+// MetricsAuth only lets the scrapers through that send the token as a bearer token.
+func MetricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authHeader, "Bearer ")), []byte(token)) != 1 {
+			utils.ResponseAuthWrong(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
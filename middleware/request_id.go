@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"blog-go/internal/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header that carries the ID of a request, from the client or a proxy, and back in the
+// response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs that are taken from the client, so that they cannot forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID takes the ID of a request from the X-Request-ID header, or generates one if the header is missing or
+// invalid, and echoes it in the response. It puts a logger with the request ID and the trace of the request in the
+// context of the request, which logging.FromContext returns to the handlers and the repositories.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set("requestID", id)
+
+		ctx := c.Request.Context()
+		entry := logging.FromContext(ctx).WithField("request_id", id)
+		if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String("http.request.id", id))
+			entry = entry.WithFields(logrus.Fields{
+				"trace_id": span.SpanContext().TraceID().String(),
+				"span_id":  span.SpanContext().SpanID().String(),
+			})
+		}
+		c.Request = c.Request.WithContext(logging.NewContext(ctx, entry))
+
+		c.Next()
+	}
+}
+
+// newRequestID returns a random ID of 16 bytes in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"blog-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope lets personal access tokens through only if they were granted the scope.
+// Logged in users have all scopes. It must run after JWTAuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isToken := c.Get("tokenScopes")
+		if !isToken {
+			c.Next()
+			return
+		}
+
+		list, _ := scopes.([]string)
+		for _, s := range list {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+
+		utils.ResponseError(c, utils.NewError(utils.ErrorTokenScope))
+		c.Abort()
+	}
+}
+
+// SessionOnly rejects personal access tokens, for routes that manage the account itself.
+// It must run after JWTAuthMiddleware.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("tokenScopes"); isToken {
+			utils.ResponseError(c, utils.NewError(utils.ErrorTokenScope))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,79 +1,195 @@
 package routes
 
 import (
+	"net/http"
+	"time"
+
 	"blog-go/api/handler"
 	"blog-go/config"
+	"blog-go/internal/metrics"
+	"blog-go/internal/model"
 	"blog-go/middleware"
+	"blog-go/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	_ "blog-go/docs"
 )
 
-func InitRouter() {
+// apiVersion is a version of the API, which is served under /api/<name>. Versions are registered side by side, so
+// that a new version can change the responses of its routes while clients still use the old ones.
+type apiVersion struct {
+	name string
+	// routes registers the routes of the version on its group.
+	routes func(api *gin.RouterGroup, app *handler.App)
+	// deprecation is set when the whole version is going to be removed.
+	deprecation *middleware.Deprecation
+}
+
+// versions are the versions of the API. A new version adds its own routes function, which can share the handlers
+// of the routes that did not change.
+var versions = []apiVersion{
+	{name: "v1", routes: v1Routes},
+}
+
+var (
+	// unversioned is the schedule of the /api alias of v1, which clients used before the versions.
+	unversioned = middleware.Deprecation{
+		Since:     time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC),
+		Successor: "/api/v1",
+	}
+	// legacyList is the schedule of the list routes by path parameter, which the filters of the lists replace.
+	legacyList = middleware.Deprecation{
+		Since:  time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+)
+
+// NewRouter registers the routes of the app, and returns the handler that NewServer serves and tests can pass to
+// httptest.
+func NewRouter(app *handler.App) http.Handler {
 	gin.SetMode(config.GetConfig().Server.Mode)
+	// Binding a request body checks its validate tags.
+	binding.Validator = utils.StructValidator{}
 	r := gin.New()
-	r.Use(gin.Recovery(), middleware.Logger())
+	// Gin trusts the X-Forwarded-For of every peer by default, only configured proxies may set the client IP.
+	if err := r.SetTrustedProxies(config.GetServerConfig().TrustedProxies); err != nil {
+		panic(err)
+	}
+	// The request span comes first, so that the logger of the request has its trace ID next to the request ID.
+	r.Use(gin.Recovery(), middleware.Tracing(), middleware.RequestID(), middleware.Logger(), middleware.Metrics(), middleware.ErrorHandler())
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Auth group
-	auth := r.Group("/api")
-	auth.Use(middleware.JWTAuthMiddleware())
+	// Probes of the load balancer and the orchestrator, outside of the API versions
+	r.GET("/healthz", app.Healthz)
+	r.GET("/readyz", app.Readyz)
+	r.GET("/version", app.GetVersion)
+	// The metrics are only served to the scrapers that know the token.
+	if token := config.GetMetricsConfig().Token; token != "" {
+		r.GET("/metrics", middleware.MetricsAuth(token),
+			gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})))
+	}
+
+	for _, version := range versions {
+		api := r.Group("/api/" + version.name)
+		if version.deprecation != nil {
+			api.Use(middleware.Deprecated(*version.deprecation))
+		}
+		version.routes(api, app)
+	}
+	// The unversioned routes serve v1 until the clients have moved to /api/v1.
+	v1Routes(r.Group("/api", middleware.Deprecated(unversioned)), app)
+
+	return r
+}
+
+// v1Routes registers the routes of v1.
+func v1Routes(api *gin.RouterGroup, app *handler.App) {
+	// Auth group, personal access tokens need the scope of the route
+	auth := api.Group("")
+	auth.Use(middleware.JWTAuthMiddleware(app.Users, app.AccessTokens))
 	{
 		// Upload
-		auth.POST("upload", handler.UploadFile)
+		auth.POST("upload", middleware.RequireScope(model.ScopeMediaWrite), app.UploadFile)
+
+		// Article
+		auth.POST("article", middleware.RequireScope(model.ScopeArticlesWrite), app.CreateArticle)
+		auth.PUT("article/:id", middleware.RequireScope(model.ScopeArticlesWrite), app.UpdateArticle)
+		auth.PATCH("article/:id", middleware.RequireScope(model.ScopeArticlesWrite), app.PatchArticle)
+		auth.DELETE("article/:id", middleware.RequireScope(model.ScopeArticlesWrite), app.DeleteArticle)
+
+		// Category
+		auth.POST("category", middleware.RequireScope(model.ScopeCategoriesWrite), app.CreateCategory)
+		auth.PUT("category/:id", middleware.RequireScope(model.ScopeCategoriesWrite), middleware.AdminMiddleware(), app.UpdateCategory)
+		auth.PATCH("category/:id", middleware.RequireScope(model.ScopeCategoriesWrite), middleware.AdminMiddleware(), app.PatchCategory)
+		auth.DELETE("category/:id", middleware.RequireScope(model.ScopeCategoriesWrite), middleware.AdminMiddleware(), app.DeleteCategory)
 
 		// Comment
-		auth.PUT("comment/:id", handler.UpdateComment)
-		auth.DELETE("comment/:id", handler.DeleteComment)
+		auth.POST("comment", middleware.RequireScope(model.ScopeCommentsWrite), app.CreateComment)
+		auth.PUT("comment/:id", middleware.RequireScope(model.ScopeCommentsWrite), app.UpdateComment)
+		auth.DELETE("comment/:id", middleware.RequireScope(model.ScopeCommentsWrite), app.DeleteComment)
+	}
 
+	// Account group, only for logged in users
+	account := api.Group("")
+	account.Use(middleware.JWTAuthMiddleware(app.Users, app.AccessTokens), middleware.SessionOnly())
+	{
 		// User
-		auth.PUT("user/:id", handler.UpdateUser)
-		auth.PUT("user/:id/password", handler.UpdateUserPassword)
-		auth.DELETE("user/:id", handler.DeleteUser)
+		account.PUT("user/:id", app.UpdateUser)
+		account.PATCH("user/:id", app.PatchUser)
+		account.PUT("user/:id/password", app.UpdateUserPassword)
+		account.PUT("user/:id/profile", app.UpdateUserProfile)
+		account.DELETE("user/:id", app.DeleteUser)
+		account.GET("user/:id/totp", app.GetTOTPStatus)
+		account.POST("user/:id/totp", app.EnrollTOTP)
+		account.POST("user/:id/totp/confirm", app.ConfirmTOTP)
+		account.DELETE("user/:id/totp", app.DisableTOTP)
+		account.POST("user/:id/totp/recovery-codes", app.RegenerateRecoveryCodes)
+		account.GET("user/:id/identities", app.GetUserIdentityList)
+		account.POST("user/:id/identities", app.LinkUserIdentity)
+		account.DELETE("user/:id/identities/:identity_id", app.DeleteUserIdentity)
+
+		// Personal access token
+		account.POST("user/tokens", app.CreateAccessToken)
+		account.GET("user/tokens", app.GetAccessTokenList)
+		account.DELETE("user/tokens/:id", app.DeleteAccessToken)
+	}
+
+	// Admin group
+	admin := api.Group("/admin")
+	admin.Use(middleware.JWTAuthMiddleware(app.Users, app.AccessTokens), middleware.SessionOnly(), middleware.AdminMiddleware())
+	{
+		admin.POST("login/unlock", app.UnlockLogin)
+
+		// User
+		admin.GET("users", app.GetAdminUserList)
+		admin.PUT("user/:id/role", app.UpdateUserRole)
+		admin.POST("user/:id/disable", app.DisableUser)
+		admin.POST("user/:id/enable", app.EnableUser)
+		admin.POST("user/:id/password-reset", app.RequirePasswordReset)
+		admin.DELETE("user/:id", app.AdminDeleteUser)
+
+		// Audit trail
+		admin.GET("audit-events", app.GetAuditEventList)
+		admin.GET("audit-events/export", app.ExportAuditEvents)
 	}
 
 	// Public group
-	public := r.Group("/api")
+	public := api.Group("")
 	{
-		public.POST("login", handler.Login)
+		public.POST("login", app.Login)
+		public.POST("login/2fa", app.LoginTwoFactor)
+		public.POST("login/password-reset", app.LoginPasswordReset)
+		public.GET("oauth/:provider/login", app.OAuthLogin)
+		public.GET("oauth/:provider/callback", app.OAuthCallback)
 
 		// Article
-		public.POST("article", handler.CreateArticle)
-		public.GET("article/:id", handler.GetArticle)
-		public.GET("articles", handler.GetArticleList)
-		public.GET("articles/category/:id", handler.GetArticleListByCategory)
-		public.GET("articles/:title", handler.GetArticleListByTitle)
-		public.PUT("article/:id", handler.UpdateArticle)
-		public.DELETE("article/:id", handler.DeleteArticle)
+		public.GET("article/:id", app.GetArticle)
+		public.GET("articles", app.GetArticleList)
+		public.GET("articles/category/:id", middleware.Deprecated(legacyList), app.GetArticleListByCategory)
+		public.GET("articles/:title", middleware.Deprecated(legacyList), app.GetArticleListByTitle)
 
 		// Category
-		public.POST("category", handler.CreateCategory)
-		public.GET("category/:id", handler.GetCategory)
-		public.GET("categories", handler.GetCategoryList)
-		public.PUT("category/:id", handler.UpdateCategory)
-		public.DELETE("category/:id", handler.DeleteCategory)
+		public.GET("category/:id", app.GetCategory)
+		public.GET("categories", app.GetCategoryList)
 
 		// Comment
-		public.POST("comment", handler.CreateComment)
-		public.GET("comment/:id", handler.GetComment)
-		public.GET("comments", handler.GetCommentList)
-		public.GET("comments/article/:id", handler.GetCommentListByArticle)
+		public.GET("comment/:id", app.GetComment)
+		public.GET("comments", app.GetCommentList)
+		public.GET("comments/article/:id", middleware.Deprecated(legacyList), app.GetCommentListByArticle)
 
 		// User
-		public.POST("user", handler.CreateUser)
-		public.GET("user/:id", handler.GetUser)
-		public.GET("users", handler.GetUserList)
-		public.GET("users/:username", handler.GetUserListByUsername)
-
-	}
-
-	err := r.Run(config.GetConfig().Server.Port)
-	if err != nil {
-		panic(err)
-		return
+		public.POST("user", app.CreateUser)
+		public.GET("user/:id", app.GetUser)
+		public.GET("user/:id/profile", app.GetUserProfile)
+		public.GET("author/:id", app.GetAuthorPage)
+		public.GET("users", app.GetUserList)
+		public.GET("users/:username", middleware.Deprecated(legacyList), app.GetUserListByUsername)
 	}
 }
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"blog-go/config"
+)
+
+// Default timeouts of the server, for the ones the config leaves unset.
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultShutdownTimeout   = 15 * time.Second
+)
+
+// NewServer creates the HTTP server of a handler on the configured port, with the configured timeouts.
+func NewServer(handler http.Handler) *http.Server {
+	serverConfig := config.GetServerConfig()
+	return &http.Server{
+		Addr:              serverConfig.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: orDefault(serverConfig.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       orDefault(serverConfig.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      orDefault(serverConfig.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       orDefault(serverConfig.IdleTimeout, defaultIdleTimeout),
+	}
+}
+
+// Serve serves until ctx is done, which main ties to SIGINT and SIGTERM. It then stops accepting connections, waits
+// for the requests in flight, and runs the shutdown functions in order: background workers are flushed first, and
+// the database is closed last. Shutting down takes at most the configured shutdown timeout. It returns an error if
+// the server fails or does not drain in time, or the first error of the shutdown functions.
+func Serve(ctx context.Context, server *http.Server, shutdown ...func(context.Context) error) error {
+	failed := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-failed:
+	case <-ctx.Done():
+	}
+
+	timeout := orDefault(config.GetServerConfig().ShutdownTimeout, defaultShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	for _, fn := range shutdown {
+		if fnErr := fn(shutdownCtx); err == nil {
+			err = fnErr
+		}
+	}
+	return err
+}
+
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// AccessTokenPrefix marks personal access tokens, so that they can be told apart from JWTs
+// and found by secret scanners.
+const AccessTokenPrefix = "blog_pat_"
+
+// GenerateAccessToken generates a random personal access token.
+func GenerateAccessToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAccessToken hashes a personal access token for storage and lookup.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
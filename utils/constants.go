@@ -5,19 +5,32 @@ const (
 	UnknownErr = 500
 
 	// User module error
-	ErrorUsernameUsed     = 1001
-	ErrorPasswordWrong    = 1002
-	ErrorUserNotExist     = 1003
-	ErrorTokenExist       = 1004
-	ErrorTokenRuntime     = 1005
-	ErrorTokenWrong       = 1006
-	ErrorTokenTypeWrong   = 1007
-	ErrorUserNoRight      = 1008
-	ErrorEmailUsed        = 1009
-	ErrorUsernameEmpty    = 1010
-	ErrorEmailEmpty       = 1011
-	ErrorPasswordEmpty    = 1012
-	ErrorPermissionDenied = 1013
+	ErrorUsernameUsed        = 1001
+	ErrorPasswordWrong       = 1002
+	ErrorUserNotExist        = 1003
+	ErrorTokenExist          = 1004
+	ErrorTokenRuntime        = 1005
+	ErrorTokenWrong          = 1006
+	ErrorTokenTypeWrong      = 1007
+	ErrorUserNoRight         = 1008
+	ErrorEmailUsed           = 1009
+	ErrorUsernameEmpty       = 1010
+	ErrorEmailEmpty          = 1011
+	ErrorPasswordEmpty       = 1012
+	ErrorPermissionDenied    = 1013
+	ErrorTOTPCodeWrong       = 1014
+	ErrorTOTPNotEnabled      = 1015
+	ErrorTOTPEnabled         = 1016
+	ErrorTOTPNotEnrolled     = 1017
+	ErrorLoginFailed         = 1018
+	ErrorLoginLocked         = 1019
+	ErrorAccessTokenNotExist = 1020
+	ErrorTokenScope          = 1021
+	ErrorUserDisabled        = 1022
+	ErrorPasswordReset       = 1023
+	ErrorModifySelf          = 1024
+	ErrorPasswordUnchanged   = 1025
+	ErrorLastAdmin           = 1026
 
 	// Article module error
 	ErrorArticleNotExist = 2001
@@ -31,53 +44,23 @@ const (
 	ErrorCommentNotExist = 4001
 
 	// Common error
-	ErrorInvalidParam = 5001
+	ErrorInvalidParam     = 5001
+	ErrorValidation       = 5002
+	ErrorVersionConflict  = 5003
+	ErrorUnsupportedMedia = 5004
 
 	// Upload error
 	ErrorUploadSaveFile = 6001
-)
-
-var codeMsg = map[int]string{
-	Success:    "OK",
-	UnknownErr: "Unknown error",
-
-	// User module error
-	ErrorUsernameUsed:     "Username has been used",
-	ErrorPasswordWrong:    "Password is wrong",
-	ErrorUserNotExist:     "User does not exist",
-	ErrorTokenExist:       "Token does not exist",
-	ErrorTokenRuntime:     "Token has expired",
-	ErrorTokenWrong:       "Token is wrong",
-	ErrorTokenTypeWrong:   "Token format is wrong",
-	ErrorUserNoRight:      "User has no right",
-	ErrorEmailUsed:        "Email has been used",
-	ErrorUsernameEmpty:    "Username is empty",
-	ErrorEmailEmpty:       "Email is empty",
-	ErrorPasswordEmpty:    "Password is empty",
-	ErrorPermissionDenied: "Permission denied",
-
-	// Article module error
-	ErrorArticleNotExist: "Article does not exist",
-
-	// Category module error
-	ErrorCategoryNameUsed:  "Category name has been used",
-	ErrorCategoryNotExist:  "Category does not exist",
-	ErrorCategoryNameEmpty: "Category name is empty",
 
-	// Comment module error
-	ErrorCommentNotExist: "Comment does not exist",
-
-	// Common error
-	ErrorInvalidParam: "Invalid parameter",
-
-	// Upload error
-	ErrorUploadSaveFile: "Failed to save file",
-}
+	// OAuth error
+	ErrorOAuthProviderNotExist = 7001
+	ErrorOAuthStateWrong       = 7002
+	ErrorOAuthExchange         = 7003
+	ErrorIdentityNotExist      = 7004
+	ErrorIdentityLinked        = 7005
+)
 
+// GetMsg returns the message of a status code in the default locale. The messages are in the catalogs under locales.
 func GetMsg(code int) string {
-	msg, ok := codeMsg[code]
-	if ok {
-		return msg
-	}
-	return codeMsg[UnknownErr]
+	return Translate(DefaultLocale, code)
 }
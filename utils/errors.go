@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AppError is an error with the status code and the HTTP status of its response.
+// Repositories and handlers return it, and the error middleware renders it.
+type AppError struct {
+	Code    int
+	Status  int
+	Message string
+	// Err is the cause, which is logged but not sent to the client.
+	Err error
+	// Fields are the details of an invalid request, per field.
+	Fields []FieldError
+}
+
+// FieldError is the reason a field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// codeStatus is the HTTP status of each status code. Codes missing here are server errors.
+var codeStatus = map[int]int{
+	// User module error
+	ErrorUsernameUsed:        http.StatusConflict,
+	ErrorPasswordWrong:       http.StatusUnauthorized,
+	ErrorUserNotExist:        http.StatusNotFound,
+	ErrorTokenExist:          http.StatusUnauthorized,
+	ErrorTokenRuntime:        http.StatusUnauthorized,
+	ErrorTokenWrong:          http.StatusUnauthorized,
+	ErrorTokenTypeWrong:      http.StatusUnauthorized,
+	ErrorUserNoRight:         http.StatusForbidden,
+	ErrorEmailUsed:           http.StatusConflict,
+	ErrorUsernameEmpty:       http.StatusBadRequest,
+	ErrorEmailEmpty:          http.StatusBadRequest,
+	ErrorPasswordEmpty:       http.StatusBadRequest,
+	ErrorPermissionDenied:    http.StatusForbidden,
+	ErrorTOTPCodeWrong:       http.StatusUnauthorized,
+	ErrorTOTPNotEnabled:      http.StatusConflict,
+	ErrorTOTPEnabled:         http.StatusConflict,
+	ErrorTOTPNotEnrolled:     http.StatusConflict,
+	ErrorLoginFailed:         http.StatusUnauthorized,
+	ErrorLoginLocked:         http.StatusTooManyRequests,
+	ErrorAccessTokenNotExist: http.StatusNotFound,
+	ErrorTokenScope:          http.StatusForbidden,
+	ErrorUserDisabled:        http.StatusForbidden,
+	ErrorPasswordReset:       http.StatusForbidden,
+	ErrorModifySelf:          http.StatusForbidden,
+	ErrorPasswordUnchanged:   http.StatusBadRequest,
+	ErrorLastAdmin:           http.StatusConflict,
+
+	// Article module error
+	ErrorArticleNotExist: http.StatusNotFound,
+
+	// Category module error
+	ErrorCategoryNameUsed:  http.StatusConflict,
+	ErrorCategoryNotExist:  http.StatusNotFound,
+	ErrorCategoryNameEmpty: http.StatusBadRequest,
+
+	// Comment module error
+	ErrorCommentNotExist: http.StatusNotFound,
+
+	// Common error
+	ErrorInvalidParam:     http.StatusBadRequest,
+	ErrorValidation:       http.StatusUnprocessableEntity,
+	ErrorVersionConflict:  http.StatusPreconditionFailed,
+	ErrorUnsupportedMedia: http.StatusUnsupportedMediaType,
+
+	// OAuth error
+	ErrorOAuthProviderNotExist: http.StatusNotFound,
+	ErrorOAuthStateWrong:       http.StatusBadRequest,
+	ErrorOAuthExchange:         http.StatusBadGateway,
+	ErrorIdentityNotExist:      http.StatusNotFound,
+	ErrorIdentityLinked:        http.StatusConflict,
+}
+
+// NewError creates the error of a status code.
+func NewError(code int) *AppError {
+	status, ok := codeStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return &AppError{Code: code, Status: status, Message: GetMsg(code)}
+}
+
+// WrapError creates the error of a status code caused by err.
+func WrapError(code int, err error) *AppError {
+	appErr := NewError(code)
+	appErr.Err = err
+	return appErr
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an AppError with the same status code, so that errors.Is(err, NewError(code)) works.
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// AsAppError returns err as an AppError. Other errors become unknown errors caused by err.
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return WrapError(UnknownErr, err)
+}
+
+// IsCode reports whether err is an AppError with the status code.
+func IsCode(err error, code int) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Code == code
+}
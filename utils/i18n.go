@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when the client asks for no supported locale, and for messages missing in a catalog.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalog holds the messages of a locale: the message of each status code,
+// and a template of each validation rule with {field} and {param} placeholders.
+type catalog struct {
+	Codes      map[string]string `json:"codes"`
+	Validation map[string]string `json:"validation"`
+}
+
+var (
+	catalogs = map[string]*catalog{}
+	// locales are the supported locales, and matcher picks one of them for the client's preferences.
+	locales []string
+	matcher language.Matcher
+)
+
+func init() {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	// The default locale comes first, so that the matcher falls back to it.
+	tags := []language.Tag{language.MustParse(DefaultLocale)}
+	locales = []string{DefaultLocale}
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			panic("locale " + entry.Name() + ": " + err.Error())
+		}
+
+		locale := strings.TrimSuffix(entry.Name(), ".json")
+		catalogs[locale] = &c
+		if locale != DefaultLocale {
+			tags = append(tags, language.MustParse(locale))
+			locales = append(locales, locale)
+		}
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// Locale returns the supported locale for a request, from the lang query parameter
+// or else from the Accept-Language header.
+func Locale(c *gin.Context) string {
+	if lang := c.Query("lang"); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			return MatchLocale(tag)
+		}
+	}
+	tags, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	if err != nil {
+		return DefaultLocale
+	}
+	return MatchLocale(tags...)
+}
+
+// MatchLocale returns the supported locale that best matches the preferred languages.
+func MatchLocale(preferred ...language.Tag) string {
+	if len(preferred) == 0 {
+		return DefaultLocale
+	}
+	_, index, confidence := matcher.Match(preferred...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return locales[index]
+}
+
+// Translate returns the message of a status code in a locale.
+// Messages missing in the locale are taken from the default locale, and unknown codes get the message of UnknownErr.
+func Translate(locale string, code int) string {
+	key := strconv.Itoa(code)
+	for _, l := range []string{locale, DefaultLocale} {
+		if c, ok := catalogs[l]; ok {
+			if msg, ok := c.Codes[key]; ok {
+				return msg
+			}
+		}
+	}
+	if code != UnknownErr {
+		return Translate(locale, UnknownErr)
+	}
+	return "Unknown error"
+}
+
+// translateRule returns the message of a failed validation rule in a locale, trying the keys in order.
+func translateRule(locale, field, param string, keys ...string) string {
+	keys = append(keys, "default")
+	for _, l := range []string{locale, DefaultLocale} {
+		c, ok := catalogs[l]
+		if !ok {
+			continue
+		}
+		for _, key := range keys {
+			if tmpl, ok := c.Validation[key]; ok {
+				return strings.NewReplacer("{field}", field, "{param}", param).Replace(tmpl)
+			}
+		}
+	}
+	return field + " is invalid"
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCatalogs(t *testing.T) {
+	defaults := catalogs[DefaultLocale]
+	for locale, c := range catalogs {
+		for key := range defaults.Codes {
+			if _, ok := c.Codes[key]; !ok {
+				t.Fatalf("Catalog Error: %s has no message for code %s", locale, key)
+			}
+		}
+		for key := range defaults.Validation {
+			if _, ok := c.Validation[key]; !ok {
+				t.Fatalf("Catalog Error: %s has no message for rule %s", locale, key)
+			}
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := []struct {
+		url            string
+		acceptLanguage string
+		want           string
+	}{
+		{"/", "", "en"},
+		{"/", "zh-CN,zh;q=0.9,en;q=0.8", "zh-CN"},
+		{"/", "zh", "zh-CN"},
+		{"/", "fr-FR,en;q=0.5", "en"},
+		{"/", "fr-FR", "en"},
+		{"/?lang=zh-CN", "en", "zh-CN"},
+		{"/?lang=en", "zh-CN", "en"},
+		{"/?lang=!!", "zh-CN", "zh-CN"},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", test.url, nil)
+		if test.acceptLanguage != "" {
+			c.Request.Header.Set("Accept-Language", test.acceptLanguage)
+		}
+		if got := Locale(c); got != test.want {
+			t.Fatalf("Locale Error: %s with %q is %s, want %s", test.url, test.acceptLanguage, got, test.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if msg := Translate("zh-CN", ErrorArticleNotExist); msg != "文章不存在" {
+		t.Fatalf("Translate Error: %v", msg)
+	}
+	if msg := Translate("de", ErrorArticleNotExist); msg != "Article does not exist" {
+		t.Fatalf("Translate Error: %v", msg)
+	}
+	if msg := Translate("en", -1); msg != "Unknown error" {
+		t.Fatalf("Translate Error: %v", msg)
+	}
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,12 +14,14 @@ type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// Errors are the failed rules of an invalid request body.
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
 func ResponseSuccess(c *gin.Context, data interface{}) {
 	response := gin.H{
 		"status":  Success,
-		"message": GetMsg(Success),
+		"message": Translate(Locale(c), Success),
 	}
 	if data != nil {
 		response["data"] = data
@@ -23,23 +29,55 @@ func ResponseSuccess(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, response)
 }
 
+// ResponseInvalidParam fails the request with ErrorInvalidParam.
 func ResponseInvalidParam(c *gin.Context) {
-	c.JSON(http.StatusBadRequest, gin.H{
-		"status":  ErrorInvalidParam,
-		"message": GetMsg(ErrorInvalidParam),
-	})
+	ResponseError(c, NewError(ErrorInvalidParam))
 }
 
-func ResponseError(c *gin.Context, code int) {
-	c.JSON(http.StatusInternalServerError, gin.H{
-		"status":  code,
-		"message": GetMsg(code),
-	})
+// ResponseBindError fails a request whose body could not be bound: with ErrorValidation and the failed rules
+// if the body broke the validate tags, with the error itself if it is an AppError, and with ErrorInvalidParam otherwise.
+func ResponseBindError(c *gin.Context, err error) {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		ResponseError(c, appErr)
+		return
+	}
+	fields := FieldErrors(err, Locale(c))
+	if fields == nil {
+		ResponseError(c, WrapError(ErrorInvalidParam, err))
+		return
+	}
+	appErr = WrapError(ErrorValidation, err)
+	appErr.Fields = fields
+	ResponseError(c, appErr)
+}
+
+// ResponseError fails the request with an error, which the error middleware renders.
+func ResponseError(c *gin.Context, err error) {
+	_ = c.Error(err)
 }
 
+// ResponseAuthWrong fails the request with ErrorTokenWrong.
 func ResponseAuthWrong(c *gin.Context) {
-	c.JSON(http.StatusUnauthorized, gin.H{
-		"status":  ErrorTokenWrong,
-		"message": GetMsg(ErrorTokenWrong),
-	})
+	ResponseError(c, NewError(ErrorTokenWrong))
+}
+
+// ResponseLoginLocked fails the request with ErrorLoginLocked, and tells the client when to retry.
+func ResponseLoginLocked(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ResponseError(c, NewError(ErrorLoginLocked))
+}
+
+// RenderError writes the response of an error with its HTTP status, and the message in the locale of the request.
+// The cause is left out.
+func RenderError(c *gin.Context, err error) {
+	appErr := AsAppError(err)
+	response := gin.H{
+		"status":  appErr.Code,
+		"message": Translate(Locale(c), appErr.Code),
+	}
+	if len(appErr.Fields) > 0 {
+		response["errors"] = appErr.Fields
+	}
+	c.JSON(appErr.Status, response)
 }
@@ -2,35 +2,68 @@ package utils
 
 import (
 	"blog-go/config"
+	"blog-go/internal/tracing"
+	"context"
 	"mime/multipart"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func UploadFile(file *multipart.FileHeader) (string, int) {
+// CheckStorage checks that the OSS bucket of the uploads exists for the readiness probe, and returns the bucket and
+// an error. Without an OSS server the uploads are disabled, which is not an error.
+func CheckStorage(ctx context.Context) (string, error) {
+	aliyunOSSConfig := config.GetAliyunOSSConfig()
+	if aliyunOSSConfig.AliyunServer == "" {
+		return "not configured", nil
+	}
+	ossClient, err := oss.New(aliyunOSSConfig.AliyunServer, aliyunOSSConfig.AccessKey, aliyunOSSConfig.SecretKey)
+	if err != nil {
+		return "", err
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "oss.GetBucketInfo", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	if _, err := ossClient.GetBucketInfo(aliyunOSSConfig.Bucket, oss.WithContext(ctx)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	return aliyunOSSConfig.Bucket, nil
+}
+
+// UploadFile saves a file to the OSS bucket in a span of the trace in ctx, and returns its URL and an error.
+func UploadFile(ctx context.Context, file *multipart.FileHeader) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "oss.PutObject", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int64("oss.object.size", file.Size)))
+	defer span.End()
+
 	aliyunOSSConfig := config.GetAliyunOSSConfig()
 	ossClient, err := oss.New(aliyunOSSConfig.AliyunServer, aliyunOSSConfig.AccessKey, aliyunOSSConfig.SecretKey)
 	if err != nil {
-		return "", UnknownErr
+		return "", WrapError(ErrorUploadSaveFile, err)
 	}
 
 	bucket, err := ossClient.Bucket(config.GetAliyunOSSConfig().Bucket)
 	if err != nil {
-		return "", UnknownErr
+		return "", WrapError(ErrorUploadSaveFile, err)
 	}
 
 	f, err := file.Open()
 	if err != nil {
-		return "", UnknownErr
+		return "", WrapError(ErrorUploadSaveFile, err)
 	}
 	defer func(f multipart.File) {
 		_ = f.Close()
 	}(f)
 
-	err = bucket.PutObject(file.Filename, f)
+	err = bucket.PutObject(file.Filename, f, oss.WithContext(ctx))
 	if err != nil {
-		return "", UnknownErr
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", WrapError(ErrorUploadSaveFile, err)
 	}
 
-	return aliyunOSSConfig.AliyunServer + "/" + file.Filename, Success
+	return aliyunOSSConfig.AliyunServer + "/" + file.Filename, nil
 }
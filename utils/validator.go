@@ -2,28 +2,95 @@ package utils
 
 import (
 	"errors"
-	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-func Validate(data interface{}) ([]string, error) {
-	var errs []string
-	validate := validator.New()
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// Errors name the fields as clients send them.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// StructValidator checks the validate tags of the requests that gin binds. The router installs it as binding.Validator,
+// so that every handler validates its request body through binding.
+type StructValidator struct{}
+
+// ValidateStruct checks a struct or a pointer to a struct, and ignores other values.
+func (StructValidator) ValidateStruct(obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	return validate.Struct(obj)
+}
+
+// Engine returns the underlying validator.
+func (StructValidator) Engine() interface{} {
+	return validate
+}
+
+// Validate checks the validate tags of a struct, and returns the failed rules with messages in the locale.
+func Validate(data interface{}, locale string) ([]FieldError, error) {
 	err := validate.Struct(data)
-	if err != nil {
-		var invalidValidationError *validator.InvalidValidationError
-		if errors.As(err, &invalidValidationError) {
-			fmt.Println(err)
-			return nil, err
+	if err == nil {
+		return nil, nil
+	}
+	fields := FieldErrors(err, locale)
+	if fields == nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// FieldErrors returns the failed rules of a validation error with messages in the locale,
+// or nil if err does not come from the validate tags.
+func FieldErrors(err error, locale string) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		// The namespace starts with the name of the struct type, which clients do not know.
+		field := fieldErr.Namespace()
+		if i := strings.IndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
 		}
 
-		for _, err := range err.(validator.ValidationErrors) {
-			var element string
-			element = fmt.Sprintf("Field validation for '%s' failed on the '%s' tag", err.Field(), err.Tag())
-			errs = append(errs, element)
+		keys := []string{fieldErr.Tag()}
+		if fieldErr.Kind() == reflect.String {
+			// Length rules on strings count characters.
+			keys = append([]string{fieldErr.Tag() + "_string"}, keys...)
 		}
-		return errs, nil
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    fieldErr.Tag(),
+			Message: translateRule(locale, field, fieldErr.Param(), keys...),
+		})
 	}
-	return nil, nil
+	return fields
+}
+
+// NewFieldError creates the reason that a field of a request breaks a rule, with the message in the locale.
+func NewFieldError(locale, field, rule, param string) FieldError {
+	return FieldError{Field: field, Rule: rule, Message: translateRule(locale, field, param, rule)}
 }
@@ -0,0 +1,43 @@
+package utils
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	type link struct {
+		URL string `json:"url" validate:"required"`
+	}
+	type user struct {
+		Username string `json:"username" validate:"required,min=4"`
+		Email    string `json:"email" validate:"required,email"`
+		Age      int    `json:"age" validate:"min=18"`
+		Links    []link `json:"links" validate:"dive"`
+	}
+
+	errs, err := Validate(&user{Username: "abc", Email: "x", Age: 3, Links: []link{{}}}, "en")
+	if err != nil {
+		t.Fatalf("Validate Error: %v", err)
+	}
+	want := []FieldError{
+		{Field: "username", Rule: "min", Message: "username must be at least 4 characters long"},
+		{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+		{Field: "age", Rule: "min", Message: "age must be 18 or greater"},
+		{Field: "links[0].url", Rule: "required", Message: "links[0].url is required"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Validate Error: %v", errs)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Fatalf("Validate Error: %v", errs[i])
+		}
+	}
+
+	errs, _ = Validate(&user{Email: "a@b.c", Age: 18}, "zh-CN")
+	if len(errs) != 1 || errs[0].Message != "username 为必填字段" {
+		t.Fatalf("Validate Error: %v", errs)
+	}
+
+	if errs, err := Validate(&user{Username: "abcd", Email: "a@b.c", Age: 18}, "en"); err != nil || errs != nil {
+		t.Fatalf("Validate Error: %v %v", errs, err)
+	}
+}